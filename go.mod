@@ -3,7 +3,7 @@ module github.com/olitez/go-netconf
 go 1.16
 
 require (
-	github.com/beevik/etree v1.1.0 // indirect
+	github.com/beevik/etree v1.1.0
 	github.com/google/go-cmp v0.5.6
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
 )
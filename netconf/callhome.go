@@ -0,0 +1,161 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// callHomeSSHPort is the port NETCONF devices use to call home over SSH
+	// (RFC 8071)
+	callHomeSSHPort = 4334
+)
+
+// callHomeHandshakeTimeout bounds the SSH handshake and hello exchange of an
+// incoming connection, so a stalled device doesn't hold the listener
+var callHomeHandshakeTimeout = 30 * time.Second
+
+// CallHomeSession is a NETCONF session established from a device initiated
+// connection.
+type CallHomeSession struct {
+	*Session
+	// RemoteAddr is the address the device connected from
+	RemoteAddr net.Addr
+	// HostKey is the SSH host key presented by the device
+	HostKey ssh.PublicKey
+}
+
+// CallHomeListener accepts NETCONF Call Home connections (RFC 8071) and runs
+// the SSH client side of the handshake on each of them.
+type CallHomeListener struct {
+	listener net.Listener
+	config   *ssh.ClientConfig
+	sessions chan *CallHomeSession
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// ListenCallHome binds addr and starts accepting Call Home connections.
+//
+// addr can omit the port in which case the IANA assigned NETCONF Call Home
+// SSH port of 4334 is used. config is used for every incoming connection, its
+// HostKeyCallback decides which devices are accepted.
+func ListenCallHome(addr string, config *ssh.ClientConfig) (*CallHomeListener, error) {
+	if !strings.Contains(addr, ":") {
+		addr = fmt.Sprintf("%s:%d", addr, callHomeSSHPort)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &CallHomeListener{
+		listener: ln,
+		config:   config,
+		sessions: make(chan *CallHomeSession),
+		done:     make(chan struct{}),
+	}
+
+	l.wg.Add(1)
+	go l.acceptLoop()
+	return l, nil
+}
+
+// Addr returns the address the listener is bound to.
+func (l *CallHomeListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Sessions returns a channel yielding a ready NETCONF session for every
+// device that successfully calls home, devices failing the SSH handshake or
+// the hello exchange are disconnected. The channel is closed once the
+// listener is closed.
+func (l *CallHomeListener) Sessions() <-chan *CallHomeSession {
+	return l.sessions
+}
+
+// Close stops accepting connections. Sessions already handed out are not
+// affected and must be closed by the caller, connections still in the middle
+// of their handshake are closed once it completes or times out.
+func (l *CallHomeListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.listener.Close()
+		go func() {
+			l.wg.Wait()
+			close(l.sessions)
+		}()
+	})
+	return err
+}
+
+func (l *CallHomeListener) acceptLoop() {
+	defer l.wg.Done()
+
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		l.wg.Add(1)
+		go l.handle(conn)
+	}
+}
+
+func (l *CallHomeListener) handle(conn net.Conn) {
+	defer l.wg.Done()
+
+	// Record the host key the device presents so callers can tell devices
+	// apart, while still honoring the configured callback.
+	var hostKey ssh.PublicKey
+	config := *l.config
+	if l.config.HostKeyCallback != nil {
+		config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return l.config.HostKeyCallback(hostname, remote, key)
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(callHomeHandshakeTimeout))
+	t, err := connToTransport(conn, &config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s, err := NewSessionContext(context.Background(), t)
+	if err != nil {
+		t.Close()
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	cs := &CallHomeSession{
+		Session:    s,
+		RemoteAddr: conn.RemoteAddr(),
+		HostKey:    hostKey,
+	}
+
+	select {
+	case l.sessions <- cs:
+	case <-l.done:
+		cs.Close()
+	}
+}
@@ -0,0 +1,155 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestListenCallHome(t *testing.T) {
+	config := SSHConfigPassword("test", "test")
+	l, err := ListenCallHome("127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	hostKeys := []ssh.Signer{newSSHTestHostKey(t), newSSHTestHostKey(t)}
+	for _, hostKey := range hostKeys {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+		go serveSSHTestDevice(conn, hostKey)
+	}
+
+	seen := map[string]bool{}
+	for range hostKeys {
+		select {
+		case s := <-l.Sessions():
+			if s.SessionID() != 7 {
+				t.Errorf("unexpected session-id (want %d, got %d)", 7, s.SessionID())
+			}
+			if s.HostKey == nil {
+				t.Fatalf("host key not recorded")
+			}
+			seen[string(s.HostKey.Marshal())] = true
+			s.Close()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for call home session")
+		}
+	}
+
+	for _, hostKey := range hostKeys {
+		if !seen[string(hostKey.PublicKey().Marshal())] {
+			t.Errorf("no session for host key %x", hostKey.PublicKey().Marshal())
+		}
+	}
+
+	if err := l.Close(); err != nil {
+		t.Errorf("unexpected error on close: %v", err)
+	}
+	if _, ok := <-l.Sessions(); ok {
+		t.Errorf("sessions channel not closed")
+	}
+}
+
+func TestListenCallHomeRejectHostKey(t *testing.T) {
+	trusted := newSSHTestHostKey(t)
+	config := SSHConfigPassword("test", "test")
+	config.HostKeyCallback = ssh.FixedHostKey(trusted.PublicKey())
+
+	l, err := ListenCallHome("127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	untrusted := newSSHTestHostKey(t)
+	errCh := make(chan error, 1)
+	go func() { errCh <- serveSSHTestDevice(conn, untrusted) }()
+
+	select {
+	case s := <-l.Sessions():
+		t.Errorf("unexpected session from untrusted device %v", bytes.TrimSpace(ssh.MarshalAuthorizedKey(s.HostKey)))
+	case err := <-errCh:
+		if err == nil {
+			t.Errorf("expected handshake to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for handshake")
+	}
+}
+
+func TestListenCallHomeHelloError(t *testing.T) {
+	l, err := ListenCallHome("127.0.0.1:0", SSHConfigPassword("test", "test"))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serveSSHTestDeviceRequests(conn, newSSHTestHostKey(t), sshTestBadHello, ssh.DiscardRequests)
+	}()
+
+	select {
+	case s := <-l.Sessions():
+		t.Errorf("unexpected session %d from a device failing the hello", s.SessionID())
+	case <-errCh:
+		// the device was disconnected
+	case <-time.After(5 * time.Second):
+		t.Fatalf("device not disconnected")
+	}
+}
+
+func TestListenCallHomeHandshakeTimeout(t *testing.T) {
+	orig := callHomeHandshakeTimeout
+	callHomeHandshakeTimeout = 50 * time.Millisecond
+	defer func() { callHomeHandshakeTimeout = orig }()
+
+	l, err := ListenCallHome("127.0.0.1:0", SSHConfigPassword("test", "test"))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	// a device which never starts the SSH handshake
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	time.Sleep(10 * time.Millisecond)
+	l.Close()
+	select {
+	case _, ok := <-l.Sessions():
+		if ok {
+			t.Errorf("unexpected session")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("sessions channel not closed, handshake still running")
+	}
+}
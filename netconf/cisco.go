@@ -0,0 +1,18 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import "fmt"
+
+// Cisco specific operations, not part of the NETCONF standard.
+
+// MethodCommitWithComment files a commit request with the remote host
+// recording comment with the commit, as supported by Cisco IOS XR. Standard
+// devices reject the comment, see MethodCommitStandard.
+func MethodCommitWithComment(comment string) RawMethod {
+	return RawMethod(fmt.Sprintf("<commit><comment>%s</comment></commit>", escapeText(comment)))
+}
@@ -0,0 +1,54 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Vendor specific operations running CLI commands, for operational commands
+// without YANG model or during a migration from screen scraping.
+
+// MethodCommand files a Junos command request with the remote host running
+// the CLI command cmd, such as "show interfaces terse", with text output.
+func MethodCommand(cmd string) RawMethod {
+	return RawMethod(fmt.Sprintf(`<command format="text">%s</command>`, escapeText(cmd)))
+}
+
+// MethodCiscoCommand files a Cisco IOS get request with the remote host
+// running the exec command cmd, such as "show version", with text output.
+func MethodCiscoCommand(cmd string) RawMethod {
+	return RawMethod(fmt.Sprintf(`<get><filter><oper-data-format-text-block><exec>%s</exec></oper-data-format-text-block></filter></get>`,
+		escapeText(cmd)))
+}
+
+// CommandOutput returns the text output of a MethodCommand or
+// MethodCiscoCommand reply, found in the output element for Junos and the
+// response element for Cisco.
+func (r *RPCReply) CommandOutput() (string, error) {
+	for _, path := range []string{"//output", "//response"} {
+		if els := r.Data.FindElements(path); len(els) > 0 {
+			var buf strings.Builder
+			for _, el := range els {
+				buf.WriteString(el.Text())
+			}
+			return strings.Trim(buf.String(), "\n"), nil
+		}
+	}
+	return "", fmt.Errorf("no command output in reply")
+}
+
+// Command runs the Junos CLI command cmd and returns its text output.
+func (s *Session) Command(ctx context.Context, cmd string) (string, error) {
+	reply, err := s.ExecContext(ctx, MethodCommand(cmd))
+	if err != nil {
+		return "", err
+	}
+	return reply.CommandOutput()
+}
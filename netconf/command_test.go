@@ -0,0 +1,91 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMethodCommand(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		{MethodCommand("show interfaces terse | match ge-"), `<command format="text">show interfaces terse | match ge-</command>`},
+		{MethodCommand("show route <x>"), `<command format="text">show route &lt;x&gt;</command>`},
+		{MethodCiscoCommand("show version"), `<get><filter><oper-data-format-text-block><exec>show version</exec></oper-data-format-text-block></filter></get>`},
+	}
+
+	for _, tc := range tt {
+		if got := string(tc.method); got != tc.expected {
+			t.Errorf("got %s, expected %s", got, tc.expected)
+		}
+	}
+}
+
+func TestRPCReplyCommandOutput(t *testing.T) {
+	tt := []struct {
+		name     string
+		rawXML   string
+		expected string
+		err      bool
+	}{
+		{
+			name: "junos",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><output>
+Interface               Admin Link Proto    Local
+ge-0/0/0                up    up
+</output></rpc-reply>`,
+			expected: "Interface               Admin Link Proto    Local\nge-0/0/0                up    up",
+		},
+		{
+			name: "cisco",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><cli-oper-data-block><item><exec>show version</exec><response>Cisco IOS Software, Version 15.2
+uptime is 1 week</response></item></cli-oper-data-block></data></rpc-reply>`,
+			expected: "Cisco IOS Software, Version 15.2\nuptime is 1 week",
+		},
+		{
+			name:   "none",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`,
+			err:    true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reply, err := newRPCReply([]byte(tc.rawXML), false, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, err := reply.CommandOutput()
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("got %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	s, trans := newMemorySession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><output>Hostname: r1</output></rpc-reply>`)
+
+	got, err := s.Command(context.Background(), "show version")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "Hostname: r1" {
+		t.Errorf("got %s, expected %s", got, "Hostname: r1")
+	}
+	if !strings.Contains(string(trans.Sent()[1]), `<command format="text">show version</command>`) {
+		t.Errorf("unexpected request %s", trans.Sent()[1])
+	}
+}
@@ -1,11 +1,20 @@
 package netconf
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
+// sshStandardPort is the port known_hosts entries without port refer to
+const sshStandardPort = "22"
+
 //Credential things to login on some host
 type Credential interface {
 	Config() *ssh.ClientConfig
@@ -16,28 +25,431 @@ type Credential interface {
 type PlainPassword struct {
 	User     string
 	Password string
+	// HostKey verifies the host key of the server, such as the callback
+	// returned by KnownHostsCallback. Host keys are not checked when nil.
+	HostKey ssh.HostKeyCallback
 }
 
 func (p PlainPassword) String() string { return fmt.Sprintf("%s plain password", p.User) }
 
 //Config build an ssh.ClientConfig from credential
 func (p PlainPassword) Config() *ssh.ClientConfig {
-	return SSHConfigPassword(p.User, p.Password)
+	cfg, _ := p.ConfigErr()
+	return cfg
+}
+
+// ConfigErr builds an ssh.ClientConfig from the credential. It never fails
+// and is provided for symmetry with the other credentials.
+func (p PlainPassword) ConfigErr() (*ssh.ClientConfig, error) {
+	cfg := SSHConfigPassword(p.User, p.Password)
+	if p.HostKey != nil {
+		cfg.HostKeyCallback = p.HostKey
+	}
+	return cfg, nil
 }
 
 //PublicKey privat-public key login credential
 type PublicKey struct {
 	User string
 	File string
+	// HostKey verifies the host key of the server, such as the callback
+	// returned by KnownHostsCallback. Host keys are not checked when nil.
+	HostKey ssh.HostKeyCallback
 }
 
 func (p PublicKey) String() string { return fmt.Sprintf("%s public key", p.User) }
 
-//Config build an ssh.ClientConfig from credential
+//Config build an ssh.ClientConfig from credential, it panics if the key can't
+//be loaded, see ConfigErr
 func (p PublicKey) Config() *ssh.ClientConfig {
+	cfg, err := p.ConfigErr()
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// ConfigErr builds an ssh.ClientConfig from the credential, returning an
+// error if the key file can't be read or parsed.
+func (p PublicKey) ConfigErr() (*ssh.ClientConfig, error) {
 	cfg, err := SSHConfigPubKeyFile(p.User, p.File)
+	if err != nil {
+		return nil, err
+	}
+	if p.HostKey != nil {
+		cfg.HostKeyCallback = p.HostKey
+	}
+	return cfg, nil
+}
+
+// PublicKeyWithPassphrase login credential using a private key file
+// encrypted with a passphrase
+type PublicKeyWithPassphrase struct {
+	User       string
+	File       string
+	Passphrase string
+	// HostKey verifies the host key of the server, such as the callback
+	// returned by KnownHostsCallback. Host keys are not checked when nil.
+	HostKey ssh.HostKeyCallback
+}
+
+func (p PublicKeyWithPassphrase) String() string {
+	return fmt.Sprintf("%s public key with passphrase", p.User)
+}
+
+// Config builds an ssh.ClientConfig from the credential, it panics if the key
+// can't be loaded, see ConfigErr.
+func (p PublicKeyWithPassphrase) Config() *ssh.ClientConfig {
+	cfg, err := p.ConfigErr()
 	if err != nil {
 		panic(err)
 	}
 	return cfg
 }
+
+// ConfigErr builds an ssh.ClientConfig from the credential. See
+// SSHConfigPubKeyFileWithPassphrase for the errors returned.
+func (p PublicKeyWithPassphrase) ConfigErr() (*ssh.ClientConfig, error) {
+	cfg, err := SSHConfigPubKeyFileWithPassphrase(p.User, p.File, p.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if p.HostKey != nil {
+		cfg.HostKeyCallback = p.HostKey
+	}
+	return cfg, nil
+}
+
+// PublicKeyBytes login credential using a PEM encoded private key held in
+// memory, encrypted with Passphrase if not empty
+type PublicKeyBytes struct {
+	User       string
+	PEM        []byte
+	Passphrase string
+	// HostKey verifies the host key of the server, such as the callback
+	// returned by KnownHostsCallback. Host keys are not checked when nil.
+	HostKey ssh.HostKeyCallback
+}
+
+func (p PublicKeyBytes) String() string { return fmt.Sprintf("%s public key", p.User) }
+
+// Config builds an ssh.ClientConfig from the credential, it panics if the key
+// can't be parsed, see ConfigErr.
+func (p PublicKeyBytes) Config() *ssh.ClientConfig {
+	cfg, err := p.ConfigErr()
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// ConfigErr builds an ssh.ClientConfig from the credential. See
+// SSHConfigPubKeyFileWithPassphrase for the errors returned.
+func (p PublicKeyBytes) ConfigErr() (*ssh.ClientConfig, error) {
+	cfg, err := SSHConfigPubKeyBytes(p.User, p.PEM, p.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if p.HostKey != nil {
+		cfg.HostKeyCallback = p.HostKey
+	}
+	return cfg, nil
+}
+
+// KeyboardInteractive login credential answering the keyboard-interactive
+// challenges of the server with Answer
+type KeyboardInteractive struct {
+	User   string
+	Answer func(name, instruction string, questions []string, echos []bool) ([]string, error)
+	// HostKey verifies the host key of the server, such as the callback
+	// returned by KnownHostsCallback. Host keys are not checked when nil.
+	HostKey ssh.HostKeyCallback
+}
+
+// KeyboardInteractivePassword returns a KeyboardInteractive credential
+// answering every prompt with password, for the common single password prompt.
+func KeyboardInteractivePassword(user, password string) KeyboardInteractive {
+	return KeyboardInteractive{
+		User: user,
+		Answer: func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = password
+			}
+			return answers, nil
+		},
+	}
+}
+
+func (k KeyboardInteractive) String() string {
+	return fmt.Sprintf("%s keyboard-interactive", k.User)
+}
+
+// Config builds an ssh.ClientConfig from the credential, it panics if Answer
+// is nil, see ConfigErr.
+func (k KeyboardInteractive) Config() *ssh.ClientConfig {
+	cfg, err := k.ConfigErr()
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// ConfigErr builds an ssh.ClientConfig from the credential, returning an
+// error if Answer is nil.
+func (k KeyboardInteractive) ConfigErr() (*ssh.ClientConfig, error) {
+	if k.Answer == nil {
+		return nil, fmt.Errorf("keyboard-interactive credential without Answer")
+	}
+
+	cfg := &ssh.ClientConfig{
+		User: k.User,
+		Auth: []ssh.AuthMethod{
+			ssh.KeyboardInteractive(k.Answer),
+		},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	if k.HostKey != nil {
+		cfg.HostKeyCallback = k.HostKey
+	}
+	return cfg, nil
+}
+
+// SSHAgent login credential using the keys of the running ssh-agent
+type SSHAgent struct {
+	User string
+	// HostKey verifies the host key of the server, such as the callback
+	// returned by KnownHostsCallback. It is required, use
+	// ssh.InsecureIgnoreHostKey explicitly not to check host keys.
+	HostKey ssh.HostKeyCallback
+}
+
+func (a SSHAgent) String() string { return fmt.Sprintf("%s ssh-agent", a.User) }
+
+// Config builds an ssh.ClientConfig from the credential, it panics if the
+// agent can't be used, see ConfigErr.
+func (a SSHAgent) Config() *ssh.ClientConfig {
+	cfg, err := a.ConfigErr()
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// ConfigErr builds an ssh.ClientConfig from the credential, returning an
+// error if HostKey is nil, SSH_AUTH_SOCK is unset, the agent can't be reached
+// or holds no keys.
+func (a SSHAgent) ConfigErr() (*ssh.ClientConfig, error) {
+	if a.HostKey == nil {
+		return nil, fmt.Errorf("ssh-agent credential requires a HostKey callback")
+	}
+	cfg, err := SSHConfigPubKeyAgent(a.User)
+	if err != nil {
+		return nil, err
+	}
+	cfg.HostKeyCallback = a.HostKey
+	return cfg, nil
+}
+
+// CredentialChain combines credentials so their authentication methods are
+// tried in order on a single connection, e.g. key, then agent, then password.
+// The user and host key callback come from the first usable member, members
+// whose configuration fails are skipped.
+type CredentialChain []Credential
+
+func (c CredentialChain) String() string {
+	members := make([]string, len(c))
+	for i, cred := range c {
+		members[i] = cred.String()
+	}
+	return fmt.Sprintf("chain of %s", strings.Join(members, ", "))
+}
+
+// Config builds an ssh.ClientConfig from the chain, it panics if no member is
+// usable, see ConfigErr.
+func (c CredentialChain) Config() *ssh.ClientConfig {
+	cfg, err := c.ConfigErr()
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// ConfigErr builds an ssh.ClientConfig with the authentication methods of all
+// the usable members, returning an error if there are none or if members have
+// different users.
+func (c CredentialChain) ConfigErr() (*ssh.ClientConfig, error) {
+	var cfg *ssh.ClientConfig
+	var errs []string
+	for _, cred := range c {
+		memberCfg, err := credentialConfig(cred)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", cred, err))
+			continue
+		}
+
+		if cfg == nil {
+			merged := *memberCfg
+			merged.Auth = append([]ssh.AuthMethod(nil), memberCfg.Auth...)
+			cfg = &merged
+			continue
+		}
+		if memberCfg.User != cfg.User {
+			return nil, fmt.Errorf("credential chain mixes users %q and %q", cfg.User, memberCfg.User)
+		}
+		cfg.Auth = append(cfg.Auth, memberCfg.Auth...)
+	}
+
+	if cfg == nil {
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("empty credential chain")
+		}
+		return nil, fmt.Errorf("no usable credential in chain: %s", strings.Join(errs, "; "))
+	}
+	return cfg, nil
+}
+
+// credentialConfig returns the configuration of cred using its ConfigErr
+// method when available, and recovering from a panic in Config otherwise.
+func credentialConfig(cred Credential) (cfg *ssh.ClientConfig, err error) {
+	if c, ok := cred.(interface {
+		ConfigErr() (*ssh.ClientConfig, error)
+	}); ok {
+		return c.ConfigErr()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			cfg, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	cfg = cred.Config()
+	if cfg == nil {
+		return nil, fmt.Errorf("no configuration")
+	}
+	return cfg, nil
+}
+
+// Algorithms restricts or extends the SSH algorithms negotiated with the
+// server. Empty lists keep the golang.org/x/crypto/ssh defaults.
+type Algorithms struct {
+	Ciphers      []string
+	KeyExchanges []string
+	MACs         []string
+}
+
+// LegacyAlgorithms returns the default algorithms extended with the
+// deprecated ones still required by old devices: CBC and RC4 ciphers, SHA-1
+// Diffie-Hellman key exchanges and SHA-1 MACs. These are weak and should only
+// be used for devices that support nothing else.
+func LegacyAlgorithms() Algorithms {
+	return Algorithms{
+		Ciphers: []string{
+			"aes128-gcm@openssh.com", "chacha20-poly1305@openssh.com",
+			"aes128-ctr", "aes192-ctr", "aes256-ctr",
+			"aes128-cbc", "3des-cbc",
+			"arcfour256", "arcfour128", "arcfour",
+		},
+		KeyExchanges: []string{
+			"curve25519-sha256@libssh.org",
+			"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+			"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+			"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+		},
+		MACs: []string{
+			"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256", "hmac-sha1", "hmac-sha1-96",
+		},
+	}
+}
+
+// Apply sets the algorithms of cfg, such as the one returned by
+// SSHConfigPassword.
+func (a Algorithms) Apply(cfg *ssh.ClientConfig) {
+	if len(a.Ciphers) > 0 {
+		cfg.Ciphers = a.Ciphers
+	}
+	if len(a.KeyExchanges) > 0 {
+		cfg.KeyExchanges = a.KeyExchanges
+	}
+	if len(a.MACs) > 0 {
+		cfg.MACs = a.MACs
+	}
+}
+
+// WithAlgorithms returns a credential using the algorithms algs with the
+// configuration of cred.
+func WithAlgorithms(cred Credential, algs Algorithms) Credential {
+	return algorithmsCredential{cred, algs}
+}
+
+type algorithmsCredential struct {
+	cred Credential
+	algs Algorithms
+}
+
+func (c algorithmsCredential) String() string { return c.cred.String() }
+
+func (c algorithmsCredential) Config() *ssh.ClientConfig {
+	cfg, err := c.ConfigErr()
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+func (c algorithmsCredential) ConfigErr() (*ssh.ClientConfig, error) {
+	cfg, err := credentialConfig(c.cred)
+	if err != nil {
+		return nil, err
+	}
+	c.algs.Apply(cfg)
+	return cfg, nil
+}
+
+// KnownHostsCallback returns a host key callback verifying host keys against
+// the OpenSSH known_hosts file at path, for use as the HostKey of a
+// credential. A leading ~ in path is expanded to the home directory, and
+// hashed entries are supported.
+//
+// Hosts are looked up with their port, as [host]:830 for NETCONF. A host
+// missing from the file under that port is looked up under the standard SSH
+// port, as devices generally use the same host key for both.
+//
+// A host key that is unknown or doesn't match is rejected with a
+// *knownhosts.KeyError, its Want field being empty for unknown hosts. The SSH
+// handshake doesn't preserve the error type, wrap the callback to implement
+// trust on first use.
+func KnownHostsCallback(path string) (ssh.HostKeyCallback, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		host, port, err := net.SplitHostPort(hostname)
+		if err != nil {
+			host, port = hostname, sshStandardPort
+			hostname = net.JoinHostPort(host, port)
+		}
+
+		err = check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if port == sshStandardPort || !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return err
+		}
+
+		// unknown under port, fall back to the standard port
+		if ferr := check(net.JoinHostPort(host, sshStandardPort), remote, key); !errors.As(ferr, &keyErr) || len(keyErr.Want) > 0 {
+			return ferr
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,107 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Datastore names a configuration datastore, such as the target of a lock or
+// the source of get-config.
+//
+// The Session operations reject unknown datastores before sending anything,
+// so a typo such as Datastore("runing") fails with a descriptive error rather
+// than an opaque rpc-error. Vendor specific datastores must be listed in
+// Session.VendorDatastores. Names read at run time, e.g. from a configuration
+// file, should go through ParseDatastore. The Method helpers leave out names
+// which aren't valid element names, see datastoreElement.
+type Datastore string
+
+// Datastores defined by RFC 6241 and, for intended and operational, by the
+// NMDA (RFC 8342) which only get-data and edit-data accept.
+const (
+	Running     Datastore = "running"
+	Candidate   Datastore = "candidate"
+	Startup     Datastore = "startup"
+	Intended    Datastore = "intended"
+	Operational Datastore = "operational"
+)
+
+// knownDatastores are the datastores accepted by ParseDatastore
+var knownDatastores = []Datastore{Running, Candidate, Startup, Intended, Operational}
+
+// validateDatastore checks ds is a standard datastore or one listed in
+// VendorDatastores, and that it is a valid element name as it is sent as one.
+// Escaping would only make an invalid name malformed.
+func (s *Session) validateDatastore(ds Datastore) error {
+	if !isNCName(string(ds)) {
+		return fmt.Errorf("invalid datastore name %q", ds)
+	}
+	return s.checkKnownDatastore(ds)
+}
+
+// validateDatastoreIdentity checks the datastore of get-data and edit-data,
+// an identity which may be qualified with a prefix, as in "ds:operational" or
+// "acme:scratch" listed in VendorDatastores. The ds prefix is the one of the
+// standard datastores, see datastoreIdentity.
+func (s *Session) validateDatastoreIdentity(ds Datastore) error {
+	name := string(ds)
+	if i := strings.Index(name, ":"); i >= 0 {
+		if !isNCName(name[:i]) || !isNCName(name[i+1:]) {
+			return fmt.Errorf("invalid datastore identity %q", ds)
+		}
+	} else if !isNCName(name) {
+		return fmt.Errorf("invalid datastore identity %q", ds)
+	}
+	return s.checkKnownDatastore(Datastore(strings.TrimPrefix(name, "ds:")))
+}
+
+// checkKnownDatastore checks ds is a standard datastore or one listed in
+// VendorDatastores.
+func (s *Session) checkKnownDatastore(ds Datastore) error {
+	for _, vendor := range s.VendorDatastores {
+		if ds == vendor {
+			return nil
+		}
+	}
+	if _, err := ParseDatastore(string(ds)); err != nil {
+		return fmt.Errorf("%v, list vendor specific datastores in Session.VendorDatastores", err)
+	}
+	return nil
+}
+
+// isNCName reports whether name is an XML name without colon (NCName), as
+// element local names and prefixes are.
+func isNCName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || unicode.IsMark(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ParseDatastore returns the datastore named name, or an error if it isn't one
+// of the standard datastores.
+func ParseDatastore(name string) (Datastore, error) {
+	names := make([]string, len(knownDatastores))
+	for i, d := range knownDatastores {
+		if string(d) == name {
+			return d, nil
+		}
+		names[i] = string(d)
+	}
+	return "", fmt.Errorf("unknown datastore %q, expected one of %s", name, strings.Join(names, ", "))
+}
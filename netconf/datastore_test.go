@@ -0,0 +1,124 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseDatastore(t *testing.T) {
+	tt := []struct {
+		name     string
+		expected Datastore
+		err      bool
+	}{
+		{name: "running", expected: Running},
+		{name: "candidate", expected: Candidate},
+		{name: "operational", expected: Operational},
+		{name: "runing", err: true},
+		{name: "", err: true},
+		{name: "Running", err: true},
+	}
+
+	for _, tc := range tt {
+		got, err := ParseDatastore(tc.name)
+		if (err != nil) != tc.err {
+			t.Errorf("%q: unexpected error: %v", tc.name, err)
+		}
+		if got != tc.expected {
+			t.Errorf("got %s, expected %s", got, tc.expected)
+		}
+		if err != nil && !strings.Contains(err.Error(), "running, candidate, startup, intended, operational") {
+			t.Errorf("error doesn't list the datastores: %v", err)
+		}
+	}
+}
+
+func TestDatastoreMethods(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		{MethodLock(Candidate), "<lock><target><candidate/></target></lock>"},
+		{MethodGetConfig(Datastore("scratch")), "<get-config><source><scratch/></source></get-config>"},
+		{MethodGetData(Operational, "", ""), `<get-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda" xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores"><datastore>ds:operational</datastore></get-data>`},
+	}
+
+	for _, tc := range tt {
+		if got := string(tc.method); got != tc.expected {
+			t.Errorf("got %s, expected %s", got, tc.expected)
+		}
+	}
+}
+
+func TestValidateDatastore(t *testing.T) {
+	invalid := []Datastore{"candidate foo", "running/><kill-session", "a&b", "acme:scratch", "1st"}
+	vs := &Session{VendorDatastores: append([]Datastore{"scratch-pad", "acme:scratch"}, invalid...)}
+
+	tt := []struct {
+		ds  Datastore
+		err string
+	}{
+		{ds: Running},
+		{ds: Operational},
+		{ds: "scratch-pad"},
+		{ds: Datastore("runing"), err: "Session.VendorDatastores"},
+		{ds: Datastore("scratch-pads"), err: "Session.VendorDatastores"},
+		{ds: "", err: "invalid datastore name"},
+	}
+
+	for _, tc := range tt {
+		err := vs.validateDatastore(tc.ds)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", tc.ds, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: got %v, expected an error containing %q", tc.ds, err, tc.err)
+		}
+	}
+
+	// names are validated rather than escaped, even when listed
+	for _, ds := range invalid {
+		if err := vs.validateDatastore(ds); err == nil || !strings.Contains(err.Error(), "invalid datastore name") {
+			t.Errorf("%q: got %v, expected an invalid datastore name error", ds, err)
+		}
+	}
+
+	// get-data and edit-data take datastore identities, qualified or not
+	for _, ds := range []Datastore{Operational, "ds:running", "ds:operational", "acme:scratch"} {
+		if err := vs.validateDatastoreIdentity(ds); err != nil {
+			t.Errorf("%q: unexpected error: %v", ds, err)
+		}
+	}
+	for _, ds := range []Datastore{"acme:<x>", "ds:runing", "acme:running"} {
+		if err := vs.validateDatastoreIdentity(ds); err == nil {
+			t.Errorf("%q: expected an error", ds)
+		}
+	}
+
+	// vendor datastores are only accepted by the sessions listing them
+	if err := (&Session{}).validateDatastore("scratch-pad"); err == nil {
+		t.Errorf("expected an error for a datastore not listed")
+	}
+
+	// the Session operations check the datastore before sending anything
+	s, trans := newMemorySession(t, testOkReply)
+	if _, err := s.EditConfig(context.Background(), "runing", "<top/>", EditConfigOptions{}); err == nil {
+		t.Errorf("expected an error for an unknown datastore")
+	}
+	if err := s.WithLock(context.Background(), "runing", func() error { return nil }); err == nil {
+		t.Errorf("expected an error for an unknown datastore")
+	}
+	if sent := sentOperations(trans); len(sent) != 0 {
+		t.Errorf("unexpected requests %v", sent)
+	}
+}
@@ -0,0 +1,212 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Diff returns the changes of the candidate configuration not yet committed
+// to running, empty if there are none.
+//
+// On Junos the native rollback compare output is returned. Otherwise both
+// configurations are retrieved, which requires the :candidate capability, and
+// compared element by element, see DiffConfig.
+func (s *Session) Diff(ctx context.Context) (string, error) {
+	if s.isJunos() {
+		reply, err := s.ExecContext(ctx, MethodCompare())
+		if err != nil {
+			return "", err
+		}
+		out := reply.Data.FindElement("//configuration-output")
+		if out == nil {
+			return "", fmt.Errorf("no configuration-output in reply")
+		}
+		return strings.Trim(out.Text(), "\n"), nil
+	}
+
+	if !hasCapability(s.serverCapabilities, capCandidate) {
+		return "", fmt.Errorf("diff requires the :candidate capability")
+	}
+	running, err := s.ExecContext(ctx, MethodGetConfig(Running))
+	if err != nil {
+		return "", err
+	}
+	candidate, err := s.ExecContext(ctx, MethodGetConfig(Candidate))
+	if err != nil {
+		return "", err
+	}
+	return DiffConfig(running.DataElement(), candidate.DataElement()), nil
+}
+
+// DiffConfig compares the configurations a and b, typically the data
+// elements of get-config replies, and returns their differences in a unified
+// diff style, empty if they are equal:
+//
+//	--- a
+//	+++ b
+//	@@ /interfaces/interface[name='eth0'] @@
+//	-<mtu>1500</mtu>
+//	+<mtu>9000</mtu>
+//
+// Each hunk is headed by the path of the element whose children differ.
+// Elements are matched by namespace and name. Those appearing several times
+// under the same parent, such as list entries, are matched by their first
+// child, commonly the list key, or by their text for leaf-lists, and then by
+// position among the entries with the same key, shown as [2], [3], etc. in the
+// path. Attributes are not compared.
+func DiffConfig(a, b *etree.Element) string {
+	var d configDiff
+	d.elements("", a, b)
+	if len(d.hunks) == 0 {
+		return ""
+	}
+
+	var buf strings.Builder
+	buf.WriteString("--- a\n+++ b\n")
+	for _, h := range d.hunks {
+		fmt.Fprintf(&buf, "@@ %s @@\n", h.path)
+		for _, line := range h.lines {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.String()
+}
+
+type diffHunk struct {
+	path  string
+	lines []string
+}
+
+// configDiff collects the hunks of DiffConfig.
+type configDiff struct {
+	hunks []diffHunk
+}
+
+// elements compares the children of a and b, either of which may be nil,
+// found at path.
+func (d *configDiff) elements(path string, a, b *etree.Element) {
+	var aChildren, bChildren []*etree.Element
+	if a != nil {
+		aChildren = a.ChildElements()
+	}
+	if b != nil {
+		bChildren = b.ChildElements()
+	}
+
+	// elements appearing several times on either side are matched by key
+	multi := make(map[string]bool)
+	for _, children := range [][]*etree.Element{aChildren, bChildren} {
+		seen := make(map[string]bool)
+		for _, el := range children {
+			name := diffName(el)
+			multi[name] = multi[name] || seen[name]
+			seen[name] = true
+		}
+	}
+
+	aKeys, aSegments := diffKeys(aChildren, multi)
+	bKeys, _ := diffKeys(bChildren, multi)
+	bByKey := make(map[string]*etree.Element, len(bChildren))
+	for i, el := range bChildren {
+		bByKey[bKeys[i]] = el
+	}
+	aByKey := make(map[string]*etree.Element, len(aChildren))
+	for i, el := range aChildren {
+		aByKey[aKeys[i]] = el
+	}
+
+	type pair struct {
+		path string
+		a, b *etree.Element
+	}
+	var lines []string
+	var nested []pair
+	for i, el := range aChildren {
+		other, ok := bByKey[aKeys[i]]
+		switch {
+		case !ok:
+			lines = append(lines, prefixLines("-", el)...)
+		case len(el.ChildElements()) == 0 && len(other.ChildElements()) == 0:
+			if strings.TrimSpace(el.Text()) != strings.TrimSpace(other.Text()) {
+				lines = append(lines, prefixLines("-", el)...)
+				lines = append(lines, prefixLines("+", other)...)
+			}
+		default:
+			nested = append(nested, pair{path + "/" + aSegments[i], el, other})
+		}
+	}
+	for i, el := range bChildren {
+		if _, ok := aByKey[bKeys[i]]; !ok {
+			lines = append(lines, prefixLines("+", el)...)
+		}
+	}
+
+	if len(lines) > 0 {
+		p := path
+		if p == "" {
+			p = "/"
+		}
+		d.hunks = append(d.hunks, diffHunk{path: p, lines: lines})
+	}
+	for _, n := range nested {
+		d.elements(n.path, n.a, n.b)
+	}
+}
+
+// diffName returns the namespace and name of el.
+func diffName(el *etree.Element) string {
+	return el.NamespaceURI() + " " + el.Tag
+}
+
+// diffKeys returns the keys matching children with the elements of the other
+// configuration, unique among children, and the path segments identifying
+// them. Entries with the same key are told apart by their position.
+func diffKeys(children []*etree.Element, multi map[string]bool) (keys, segments []string) {
+	seen := make(map[string]int)
+	for _, el := range children {
+		segment := diffSegment(el, multi[diffName(el)])
+		name := el.NamespaceURI() + " " + segment
+		if n := seen[name]; n > 0 {
+			segment = fmt.Sprintf("%s[%d]", segment, n+1)
+		}
+		seen[name]++
+		keys = append(keys, el.NamespaceURI()+" "+segment)
+		segments = append(segments, segment)
+	}
+	return keys, segments
+}
+
+// diffSegment returns the path segment identifying el among its siblings.
+func diffSegment(el *etree.Element, multi bool) string {
+	if !multi {
+		return el.Tag
+	}
+	if children := el.ChildElements(); len(children) > 0 {
+		return fmt.Sprintf("%s[%s='%s']", el.Tag, children[0].Tag, strings.TrimSpace(children[0].Text()))
+	}
+	return fmt.Sprintf("%s[.='%s']", el.Tag, strings.TrimSpace(el.Text()))
+}
+
+// prefixLines returns el indented as XML with each line prefixed.
+func prefixLines(prefix string, el *etree.Element) []string {
+	doc := etree.NewDocument()
+	doc.SetRoot(el.Copy())
+	doc.Indent(2)
+	text, _ := doc.WriteToString()
+
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return lines
+}
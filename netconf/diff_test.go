@@ -0,0 +1,169 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/google/go-cmp/cmp"
+)
+
+func testConfigElement(t *testing.T, config string) *etree.Element {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString("<data>" + config + "</data>"); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	return doc.Root()
+}
+
+func TestDiffConfig(t *testing.T) {
+	tt := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{
+			name: "equal",
+			a:    `<system><hostname>r1</hostname></system>`,
+			b:    "<system>\n  <hostname>r1</hostname>\n</system>",
+		},
+		{
+			name: "leaf changed",
+			a:    `<interfaces><interface><name>eth0</name><mtu>1500</mtu></interface><interface><name>eth1</name><mtu>1500</mtu></interface></interfaces>`,
+			b:    `<interfaces><interface><name>eth0</name><mtu>9000</mtu></interface><interface><name>eth1</name><mtu>1500</mtu></interface></interfaces>`,
+			expected: `--- a
++++ b
+@@ /interfaces/interface[name='eth0'] @@
+-<mtu>1500</mtu>
++<mtu>9000</mtu>
+`,
+		},
+		{
+			name: "entries added and removed",
+			a:    `<interfaces><interface><name>eth0</name></interface><interface><name>eth1</name><description>old</description></interface></interfaces>`,
+			b:    `<interfaces><interface><name>eth0</name></interface><interface><name>eth2</name><enabled>true</enabled></interface></interfaces>`,
+			expected: `--- a
++++ b
+@@ /interfaces @@
+-<interface>
+-  <name>eth1</name>
+-  <description>old</description>
+-</interface>
++<interface>
++  <name>eth2</name>
++  <enabled>true</enabled>
++</interface>
+`,
+		},
+		{
+			name: "leaf-list and container",
+			a:    `<system><dns><server>192.0.2.1</server><server>192.0.2.2</server></dns></system>`,
+			b:    `<system><dns><server>192.0.2.1</server><server>192.0.2.3</server></dns><ntp><enabled>true</enabled></ntp></system>`,
+			expected: `--- a
++++ b
+@@ /system @@
++<ntp>
++  <enabled>true</enabled>
++</ntp>
+@@ /system/dns @@
+-<server>192.0.2.2</server>
++<server>192.0.2.3</server>
+`,
+		},
+		{
+			name: "duplicate keys",
+			a:    `<routes><route><prefix>10.0.0.0/8</prefix><next-hop>192.0.2.1</next-hop></route><route><prefix>10.0.0.0/8</prefix><next-hop>192.0.2.2</next-hop></route></routes>`,
+			b:    `<routes><route><prefix>10.0.0.0/8</prefix><next-hop>192.0.2.1</next-hop></route><route><prefix>10.0.0.0/8</prefix><next-hop>192.0.2.3</next-hop></route></routes>`,
+			expected: `--- a
++++ b
+@@ /routes/route[prefix='10.0.0.0/8'][2] @@
+-<next-hop>192.0.2.2</next-hop>
++<next-hop>192.0.2.3</next-hop>
+`,
+		},
+		{
+			name: "duplicate entry removed",
+			a:    `<dns><server>192.0.2.1</server><server>192.0.2.1</server></dns>`,
+			b:    `<dns><server>192.0.2.1</server></dns>`,
+			expected: `--- a
++++ b
+@@ /dns @@
+-<server>192.0.2.1</server>
+`,
+		},
+		{
+			name: "namespaces",
+			a:    `<system xmlns="urn:a"><hostname>r1</hostname></system><system xmlns="urn:b"><hostname>r1</hostname></system>`,
+			b:    `<system xmlns="urn:a"><hostname>r1</hostname></system><system xmlns="urn:c"><hostname>r1</hostname></system>`,
+			expected: `--- a
++++ b
+@@ / @@
+-<system xmlns="urn:b">
+-  <hostname>r1</hostname>
+-</system>
++<system xmlns="urn:c">
++  <hostname>r1</hostname>
++</system>
+`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := DiffConfig(testConfigElement(t, tc.a), testConfigElement(t, tc.b))
+			if diff := cmp.Diff(tc.expected, got); diff != "" {
+				t.Errorf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	s, trans := newMemorySession(t,
+		`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><system xmlns="urn:system"><hostname>r1</hostname></system></data></rpc-reply>`,
+		`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><system xmlns="urn:system"><hostname>r2</hostname></system></data></rpc-reply>`,
+	)
+	if _, err := s.Diff(context.Background()); err == nil {
+		t.Errorf("expected error without :candidate capability")
+	}
+
+	s.serverCapabilities = append(s.serverCapabilities, capCandidate)
+	got, err := s.Diff(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "--- a\n+++ b\n@@ /system @@\n-<hostname>r1</hostname>\n+<hostname>r2</hostname>\n"
+	if got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+	if diff := cmp.Diff([]string{"get-config", "get-config"}, sentOperations(trans)); diff != "" {
+		t.Errorf("unexpected operations (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiffJunos(t *testing.T) {
+	s, trans := newMemorySession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:junos="http://xml.juniper.net/junos/18.1R1/junos"><configuration-information><configuration-output>
+[edit system]
+-  host-name r1;
++  host-name r2;
+</configuration-output></configuration-information></rpc-reply>`)
+	s.serverCapabilities = append(s.serverCapabilities, junosCapabilityPrefix+"1.0")
+
+	got, err := s.Diff(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "[edit system]\n-  host-name r1;\n+  host-name r2;"
+	if got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+	if diff := cmp.Diff([]string{"get-configuration"}, sentOperations(trans)); diff != "" {
+		t.Errorf("unexpected operations (-want +got):\n%s", diff)
+	}
+}
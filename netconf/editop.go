@@ -0,0 +1,83 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// editOperations are the operations an edit-config element can carry
+var editOperations = []string{"merge", "replace", "create", "delete", "remove"}
+
+// EditOp adds the operation attribute (RFC 6241 section 7.2) to the top level
+// element of the XML fragment element, declaring the NETCONF namespace for it.
+// The prefix is nc unless the fragment uses it for another namespace.
+//
+//	cfg, err := EditOp(`<interface><name>eth0</name></interface>`, "delete")
+//	MethodEditConfig("candidate", `<interfaces xmlns="...">`+cfg+`</interfaces>`)
+func EditOp(element, operation string) (string, error) {
+	if !contains(editOperations, operation) {
+		return "", fmt.Errorf("invalid operation %q", operation)
+	}
+
+	d := xml.NewDecoder(strings.NewReader(element))
+	prefixes := map[string]string{}
+	var start *xml.StartElement
+	var end int64
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			break
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start == nil {
+			el = el.Copy()
+			start = &el
+			end = d.InputOffset()
+		}
+		for _, attr := range el.Attr {
+			if attr.Name.Space == "xmlns" {
+				prefixes[attr.Name.Local] = attr.Value
+			}
+		}
+	}
+	if start == nil {
+		return "", fmt.Errorf("no element in %q", element)
+	}
+
+	// Reuse a prefix the element already binds to the base namespace,
+	// otherwise pick one unused in the fragment.
+	var prefix, decl string
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" && attr.Value == baseNS {
+			prefix = attr.Name.Local
+		}
+	}
+	if prefix == "" {
+		prefix = "nc"
+		for i := 1; ; i++ {
+			if _, used := prefixes[prefix]; !used {
+				break
+			}
+			prefix = "nc" + strconv.Itoa(i)
+		}
+		decl = fmt.Sprintf(` xmlns:%s="%s"`, prefix, baseNS)
+	}
+
+	// Insert the attributes before the end of the start tag
+	i := int(end) - 1
+	if strings.HasSuffix(element[:end], "/>") {
+		i--
+	}
+	return fmt.Sprintf(`%s%s %s:operation="%s"%s`, element[:i], decl, prefix, operation, element[i:]), nil
+}
@@ -0,0 +1,56 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import "testing"
+
+func TestEditOp(t *testing.T) {
+	tt := []struct {
+		element   string
+		operation string
+		expected  string
+	}{
+		{
+			`<interface><name>eth0</name></interface>`,
+			"delete",
+			`<interface xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" nc:operation="delete"><name>eth0</name></interface>`,
+		},
+		{
+			`<interface/>`,
+			"remove",
+			`<interface xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" nc:operation="remove"/>`,
+		},
+		{
+			`<if:interface xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" xmlns:nc="urn:example:nc"><nc1:x xmlns:nc1="urn:example:nc1"/></if:interface>`,
+			"replace",
+			`<if:interface xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" xmlns:nc="urn:example:nc" xmlns:nc2="urn:ietf:params:xml:ns:netconf:base:1.0" nc2:operation="replace"><nc1:x xmlns:nc1="urn:example:nc1"/></if:interface>`,
+		},
+		{
+			`<interface xmlns:base="urn:ietf:params:xml:ns:netconf:base:1.0"><name>eth0</name></interface>`,
+			"create",
+			`<interface xmlns:base="urn:ietf:params:xml:ns:netconf:base:1.0" base:operation="create"><name>eth0</name></interface>`,
+		},
+	}
+
+	for _, tc := range tt {
+		got, err := EditOp(tc.element, tc.operation)
+		if err != nil {
+			t.Errorf("EditOp(%q): unexpected error: %v", tc.element, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("got %s, expected %s", got, tc.expected)
+		}
+	}
+
+	if _, err := EditOp("<interface/>", "erase"); err == nil {
+		t.Errorf("expected error for invalid operation")
+	}
+	if _, err := EditOp("eth0", "delete"); err == nil {
+		t.Errorf("expected error without element")
+	}
+}
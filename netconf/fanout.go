@@ -0,0 +1,110 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultFanOutConcurrency is the number of devices FanOut works on at once
+// when MaxConcurrency is zero
+const defaultFanOutConcurrency = 16
+
+// FanOutTarget is a device FanOut connects to over SSH, see DialSSH.
+type FanOutTarget struct {
+	Target     string
+	Credential Credential
+}
+
+// FanOutResult is the outcome of FanOut for a device, Err reports both the
+// connection failures and the rpc-errors.
+type FanOutResult struct {
+	Reply *RPCReply
+	Err   error
+}
+
+// FanOutOptions controls how FanOut works through the devices.
+type FanOutOptions struct {
+	// MaxConcurrency is the maximum number of devices connected to at once,
+	// 16 when zero
+	MaxConcurrency int
+	// Dial establishes the sessions instead of the SSH dial of the target
+	// when set
+	Dial func(ctx context.Context, target FanOutTarget) (*Session, error)
+}
+
+// FanOut connects to each target, executes method and closes the session,
+// working on up to opts.MaxConcurrency devices concurrently. It returns the
+// result of every target keyed by FanOutTarget.Target, a failure of a device
+// doesn't affect the others. Once ctx is done the requests in flight are
+// aborted and the devices not yet reached fail with ctx.Err().
+//
+//	results := FanOut(ctx, targets, MethodEditConfig(Candidate, config), FanOutOptions{})
+//	for host, res := range results {
+//		if res.Err != nil {
+//			log.Printf("%s: %v", host, res.Err)
+//		}
+//	}
+func FanOut(ctx context.Context, targets []FanOutTarget, method RPCMethod, opts FanOutOptions) map[string]FanOutResult {
+	limit := opts.MaxConcurrency
+	if limit <= 0 {
+		limit = defaultFanOutConcurrency
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]FanOutResult, len(targets))
+		sem     = make(chan struct{}, limit)
+	)
+	for _, target := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			results[target.Target] = FanOutResult{Err: ctx.Err()}
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(target FanOutTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res := fanOutTarget(ctx, target, method, opts)
+			mu.Lock()
+			results[target.Target] = res
+			mu.Unlock()
+		}(target)
+	}
+	wg.Wait()
+	return results
+}
+
+// fanOutTarget executes method on a single device for FanOut.
+func fanOutTarget(ctx context.Context, target FanOutTarget, method RPCMethod, opts FanOutOptions) FanOutResult {
+	if err := ctx.Err(); err != nil {
+		return FanOutResult{Err: err}
+	}
+
+	var s *Session
+	var err error
+	if opts.Dial != nil {
+		s, err = opts.Dial(ctx, target)
+	} else {
+		s, err = dialCredential(ctx, target.Target, target.Credential)
+	}
+	if err != nil {
+		return FanOutResult{Err: err}
+	}
+	defer s.Close()
+
+	reply, err := s.ExecContext(ctx, method)
+	return FanOutResult{Reply: reply, Err: err}
+}
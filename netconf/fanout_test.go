@@ -0,0 +1,91 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFanOut(t *testing.T) {
+	errDial := errors.New("connection refused")
+
+	var active, maxActive int32
+	opts := FanOutOptions{
+		MaxConcurrency: 2,
+		Dial: func(ctx context.Context, target FanOutTarget) (*Session, error) {
+			n := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			switch target.Target {
+			case "unreachable":
+				return nil, errDial
+			case "locked":
+				s, _ := newMemorySession(t, testLockDeniedReply)
+				return s, nil
+			}
+			s, _ := newMemorySession(t, testOkReply)
+			return s, nil
+		},
+	}
+
+	targets := []FanOutTarget{{Target: "r1"}, {Target: "r2"}, {Target: "unreachable"}, {Target: "locked"}, {Target: "r3"}}
+	results := FanOut(context.Background(), targets, MethodCommitStandard(), opts)
+
+	if len(results) != len(targets) {
+		t.Fatalf("got %d results, expected %d", len(results), len(targets))
+	}
+	for _, host := range []string{"r1", "r2", "r3"} {
+		if res := results[host]; res.Err != nil || res.Reply == nil || !res.Reply.Ok {
+			t.Errorf("%s: unexpected result %+v", host, res)
+		}
+	}
+	if res := results["unreachable"]; !errors.Is(res.Err, errDial) {
+		t.Errorf("unreachable: got %v, expected %v", res.Err, errDial)
+	}
+	var rpcErr *RPCError
+	if res := results["locked"]; !errors.As(res.Err, &rpcErr) || rpcErr.Tag != "lock-denied" {
+		t.Errorf("locked: got %v, expected a lock-denied rpc-error", res.Err)
+	}
+	if m := atomic.LoadInt32(&maxActive); m > 2 {
+		t.Errorf("got %d devices at once, expected at most 2", m)
+	}
+}
+
+func TestFanOutContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var dialed int32
+	opts := FanOutOptions{
+		Dial: func(ctx context.Context, target FanOutTarget) (*Session, error) {
+			atomic.AddInt32(&dialed, 1)
+			s, _ := newMemorySession(t, testOkReply)
+			return s, nil
+		},
+	}
+
+	results := FanOut(ctx, []FanOutTarget{{Target: "r1"}, {Target: "r2"}}, MethodCommitStandard(), opts)
+	for host, res := range results {
+		if !errors.Is(res.Err, context.Canceled) {
+			t.Errorf("%s: got %v, expected %v", host, res.Err, context.Canceled)
+		}
+	}
+	if n := atomic.LoadInt32(&dialed); n != 0 {
+		t.Errorf("got %d devices dialed, expected none", n)
+	}
+}
@@ -0,0 +1,94 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SubtreeFilter builds the content of a subtree filter (RFC 6241 section 6)
+// to be used with get and get-config.
+//
+//	f := NewSubtreeFilter()
+//	f.Container("interfaces", "urn:ietf:params:xml:ns:yang:ietf-interfaces").
+//		Container("interface", "").
+//		Leaf("name", "eth0").
+//		Leaf("enabled", "")
+//	MethodGet("subtree", f.Build())
+type SubtreeFilter struct {
+	name     string
+	ns       string
+	value    string
+	leaf     bool
+	parent   *SubtreeFilter
+	children []*SubtreeFilter
+}
+
+// NewSubtreeFilter returns an empty filter to add the top level nodes to.
+func NewSubtreeFilter() *SubtreeFilter {
+	return &SubtreeFilter{}
+}
+
+// Container adds a containment node named name, qualified by the namespace ns
+// when not empty, and returns it so nodes can be nested into it. A container
+// without children selects the whole subtree.
+func (f *SubtreeFilter) Container(name, ns string) *SubtreeFilter {
+	c := &SubtreeFilter{name: name, ns: ns, parent: f}
+	f.children = append(f.children, c)
+	return c
+}
+
+// Leaf adds a leaf node to f and returns f to allow chaining. An empty value
+// adds a selection node returning the leaf, otherwise a content match node
+// restricting the siblings returned to the ones with the leaf equal to value.
+func (f *SubtreeFilter) Leaf(name, value string) *SubtreeFilter {
+	f.children = append(f.children, &SubtreeFilter{name: name, value: value, leaf: true, parent: f})
+	return f
+}
+
+// Parent returns the node f was added to, or f itself for the top level.
+func (f *SubtreeFilter) Parent() *SubtreeFilter {
+	if f.parent == nil {
+		return f
+	}
+	return f.parent
+}
+
+// Build returns the XML of the whole filter f belongs to.
+func (f *SubtreeFilter) Build() string {
+	root := f
+	for root.parent != nil {
+		root = root.parent
+	}
+
+	var buf bytes.Buffer
+	for _, c := range root.children {
+		c.write(&buf)
+	}
+	return buf.String()
+}
+
+func (f *SubtreeFilter) write(buf *bytes.Buffer) {
+	buf.WriteString("<" + f.name)
+	if f.ns != "" {
+		fmt.Fprintf(buf, ` xmlns="%s"`, escapeText(f.ns))
+	}
+
+	switch {
+	case f.leaf && f.value != "":
+		fmt.Fprintf(buf, ">%s</%s>", escapeText(f.value), f.name)
+	case len(f.children) == 0:
+		buf.WriteString("/>")
+	default:
+		buf.WriteString(">")
+		for _, c := range f.children {
+			c.write(buf)
+		}
+		fmt.Fprintf(buf, "</%s>", f.name)
+	}
+}
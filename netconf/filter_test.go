@@ -0,0 +1,66 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"testing"
+)
+
+func TestSubtreeFilter(t *testing.T) {
+	tt := []struct {
+		name     string
+		build    func() string
+		expected string
+	}{
+		{
+			name:     "empty",
+			build:    func() string { return NewSubtreeFilter().Build() },
+			expected: "",
+		},
+		{
+			name: "selection",
+			build: func() string {
+				f := NewSubtreeFilter()
+				f.Container("interfaces", "urn:ietf:params:xml:ns:yang:ietf-interfaces")
+				return f.Build()
+			},
+			expected: `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"/>`,
+		},
+		{
+			name: "nested",
+			build: func() string {
+				return NewSubtreeFilter().
+					Container("interfaces", "urn:ietf:params:xml:ns:yang:ietf-interfaces").
+					Container("interface", "").
+					Leaf("name", "eth0").
+					Leaf("enabled", "").
+					Build()
+			},
+			expected: `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth0</name><enabled/></interface></interfaces>`,
+		},
+		{
+			name: "siblings",
+			build: func() string {
+				f := NewSubtreeFilter()
+				top := f.Container("top", "urn:top")
+				top.Container("a", "").Leaf("x", "1")
+				top.Container("b", "urn:b").Leaf("y", `<&">`).Parent().Leaf("c", "")
+				return f.Build()
+			},
+			expected: `<top xmlns="urn:top"><a><x>1</x></a><b xmlns="urn:b"><y>&lt;&amp;&#34;&gt;</y></b><c/></top>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			out := tc.build()
+			if out != tc.expected {
+				t.Errorf("unexpected filter (want %q, got %q)", tc.expected, out)
+			}
+		})
+	}
+}
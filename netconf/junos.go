@@ -0,0 +1,205 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Junos specific operations, not part of the NETCONF standard.
+
+// junosCapabilityPrefix prefixes the capabilities advertised by Junos devices
+const junosCapabilityPrefix = "http://xml.juniper.net/netconf/junos/"
+
+// isJunos reports whether the server is a Junos device.
+func (s *Session) isJunos() bool {
+	for _, c := range s.serverCapabilities {
+		if strings.HasPrefix(c, junosCapabilityPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// junosLoadActions and junosLoadFormats are the values of the action and
+	// format attributes of load-configuration
+	junosLoadActions = []string{"merge", "replace", "override", "update", "set"}
+	junosLoadFormats = []string{"text", "xml", "json"}
+)
+
+// validateLoadConfiguration checks action and format are a combination
+// accepted by load-configuration.
+func validateLoadConfiguration(action, format string) error {
+	if !contains(junosLoadActions, action) {
+		return fmt.Errorf("invalid load-configuration action %q", action)
+	}
+	if !contains(junosLoadFormats, format) {
+		return fmt.Errorf("invalid load-configuration format %q", format)
+	}
+	if action == "set" && format != "text" {
+		return fmt.Errorf("load-configuration action set requires the text format, got %s", format)
+	}
+	return nil
+}
+
+// MethodLoadConfiguration files a Junos load-configuration request with the
+// remote host. action is one of merge, replace, override, update or set, and
+// format one of text, xml or json. config is the content of the configuration
+// element matching the format, configuration-set for the set action, and is
+// escaped except for the xml format. See Session.LoadConfiguration for a
+// validating variant.
+func MethodLoadConfiguration(action, format, config string) RawMethod {
+	var wrapper string
+	switch {
+	case action == "set":
+		wrapper = "configuration-set"
+	case format == "xml":
+		return RawMethod(fmt.Sprintf(`<load-configuration action="%s" format="xml"><configuration>%s</configuration></load-configuration>`,
+			escapeText(action), config))
+	default:
+		wrapper = "configuration-" + format
+	}
+	return RawMethod(fmt.Sprintf(`<load-configuration action="%s" format="%s"><%s>%s</%s></load-configuration>`,
+		escapeText(action), escapeText(format), wrapper, escapeText(config), wrapper))
+}
+
+// LoadConfiguration loads config into the Junos candidate configuration,
+// rejecting invalid action and format combinations before anything is sent.
+// See MethodLoadConfiguration for the arguments.
+func (s *Session) LoadConfiguration(ctx context.Context, action, format, config string) (*RPCReply, error) {
+	if err := validateLoadConfiguration(action, format); err != nil {
+		return nil, err
+	}
+	return s.ExecContext(ctx, MethodLoadConfiguration(action, format, config))
+}
+
+// MethodSetConfig files a Junos load-configuration request with the remote
+// host loading set commands. See MethodLoadConfiguration for the other
+// actions and formats.
+func MethodSetConfig(config string) RawMethod {
+	return RawMethod(fmt.Sprintf(`<load-configuration action="set" format="text"><configuration-set>%s</configuration-set></load-configuration>`, config))
+}
+
+// MethodCompare files a Junos get-configuration request with the remote host
+// comparing the candidate configuration with the running one (rollback 0),
+// in text format.
+func MethodCompare() RawMethod {
+	return RawMethod(`<get-configuration compare="rollback" rollback="0" format="text"/>`)
+}
+
+// MethodCommit files a Junos commit-configuration request with the remote
+// host, logging msg as the commit comment. See MethodCommitStandard for other
+// devices.
+func MethodCommit(msg string) RawMethod {
+	return RawMethod(fmt.Sprintf(`<commit-configuration><log>%s</log></commit-configuration>`, msg))
+}
+
+// MethodCommitCheck files a Junos commit-configuration request with the remote
+// host checking the candidate configuration without committing it.
+func MethodCommitCheck() RawMethod {
+	return RawMethod(`<commit-configuration><check/></commit-configuration>`)
+}
+
+// JunosCommitResults holds the commit-results of a Junos commit-configuration
+// reply.
+type JunosCommitResults struct {
+	// Success is true when the routing engines reported commit-success, or
+	// commit-check-success for a check, and no error
+	Success bool
+	// Errors are the error and warning elements of the results, which Junos
+	// doesn't report as rpc-error
+	Errors []RPCError
+}
+
+// JunosCommitResults parses the commit-results of a Junos commit-configuration
+// reply.
+func (r *RPCReply) JunosCommitResults() (*JunosCommitResults, error) {
+	results := r.Data.FindElement("//commit-results")
+	if results == nil {
+		return nil, fmt.Errorf("no commit-results in reply")
+	}
+
+	res := &JunosCommitResults{Errors: junosErrors(results)}
+	success := results.FindElement(".//commit-success") != nil ||
+		results.FindElement(".//commit-check-success") != nil
+	res.Success = success && replyError(res.Errors, false) == nil
+	return res, nil
+}
+
+// junosErrors returns the Junos error and warning elements below el as
+// RPCError, e.g.:
+//
+//	<xnm:error><edit-path>[edit interfaces]</edit-path><statement>ge-0/0/0</statement><message>...</message></xnm:error>
+func junosErrors(el *etree.Element) []RPCError {
+	var errs []RPCError
+	for _, e := range el.FindElements(".//*") {
+		severity := e.Tag
+		if severity != "error" && severity != "warning" {
+			continue
+		}
+
+		rpcErr := RPCError{
+			Type:     "application",
+			Tag:      "operation-failed",
+			Severity: severity,
+		}
+		for _, child := range e.ChildElements() {
+			text := strings.TrimSpace(child.Text())
+			switch child.Tag {
+			case "message":
+				rpcErr.Message = text
+			case "edit-path":
+				rpcErr.Path = text
+			default:
+				if rpcErr.Info == nil {
+					rpcErr.Info = make(map[string]string)
+				}
+				rpcErr.Info[child.Tag] = text
+			}
+		}
+		errs = append(errs, rpcErr)
+	}
+	return errs
+}
+
+// junosResultElements hold the outcome of Junos operations, with failures
+// reported as error elements instead of rpc-error
+var junosResultElements = []string{"commit-results", "load-configuration-results"}
+
+// junosReplyErrors returns the errors and warnings inside the Junos result
+// elements of a reply. Only the direct children of rpc-reply are checked, so
+// elements of the same name in the data of other replies are left alone.
+func junosReplyErrors(doc *etree.Document) []RPCError {
+	root := doc.Root()
+	if root == nil {
+		return nil
+	}
+
+	var errs []RPCError
+	for _, el := range root.ChildElements() {
+		if contains(junosResultElements, el.Tag) {
+			errs = append(errs, junosErrors(el)...)
+		}
+	}
+	return errs
+}
+
+// CommitCheck checks the Junos candidate configuration without committing it.
+// A failed check returns the errors reported by Junos as *RPCError or
+// RPCErrors, the returned results hold the warnings of a passed check.
+func (s *Session) CommitCheck(ctx context.Context) (*JunosCommitResults, error) {
+	reply, err := s.ExecContext(ctx, MethodCommitCheck())
+	if err != nil {
+		return nil, err
+	}
+	return reply.JunosCommitResults()
+}
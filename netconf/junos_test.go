@@ -0,0 +1,234 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMethodLoadConfiguration(t *testing.T) {
+	tt := []struct {
+		name     string
+		action   string
+		format   string
+		config   string
+		expected string
+	}{
+		{
+			name:     "set",
+			action:   "set",
+			format:   "text",
+			config:   `set system host-name "r&1"`,
+			expected: `<load-configuration action="set" format="text"><configuration-set>set system host-name &#34;r&amp;1&#34;</configuration-set></load-configuration>`,
+		},
+		{
+			name:     "text",
+			action:   "replace",
+			format:   "text",
+			config:   "system { replace: host-name r1; }",
+			expected: `<load-configuration action="replace" format="text"><configuration-text>system { replace: host-name r1; }</configuration-text></load-configuration>`,
+		},
+		{
+			name:     "xml",
+			action:   "merge",
+			format:   "xml",
+			config:   "<system><host-name>r1</host-name></system>",
+			expected: `<load-configuration action="merge" format="xml"><configuration><system><host-name>r1</host-name></system></configuration></load-configuration>`,
+		},
+		{
+			name:     "json",
+			action:   "override",
+			format:   "json",
+			config:   `{"configuration":{}}`,
+			expected: `<load-configuration action="override" format="json"><configuration-json>{&#34;configuration&#34;:{}}</configuration-json></load-configuration>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(MethodLoadConfiguration(tc.action, tc.format, tc.config)); got != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestLoadConfigurationValidation(t *testing.T) {
+	tt := []struct {
+		action string
+		format string
+		err    bool
+	}{
+		{action: "merge", format: "xml"},
+		{action: "update", format: "json"},
+		{action: "set", format: "text"},
+		{action: "set", format: "xml", err: true},
+		{action: "set", format: "json", err: true},
+		{action: "patch", format: "text", err: true},
+		{action: "merge", format: "yaml", err: true},
+	}
+
+	s := &Session{}
+	for _, tc := range tt {
+		err := validateLoadConfiguration(tc.action, tc.format)
+		if (err != nil) != tc.err {
+			t.Errorf("%s/%s: unexpected error: %v", tc.action, tc.format, err)
+		}
+		if tc.err {
+			if _, err := s.LoadConfiguration(context.Background(), tc.action, tc.format, ""); err == nil {
+				t.Errorf("%s/%s: expected error", tc.action, tc.format)
+			}
+		}
+	}
+}
+
+func TestMethodCommitCheck(t *testing.T) {
+	expected := "<commit-configuration><check/></commit-configuration>"
+	if got := string(MethodCommitCheck()); got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+}
+
+func TestJunosCommitResults(t *testing.T) {
+	tt := []struct {
+		name     string
+		rawXML   string
+		success  bool
+		expected []RPCError
+	}{
+		{
+			name: "check success",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:junos="http://xml.juniper.net/junos/18.1R1/junos">
+<commit-results><routing-engine junos:style="normal"><name>re0</name><commit-check-success/></routing-engine></commit-results>
+</rpc-reply>`,
+			success: true,
+		},
+		{
+			name: "warning",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<commit-results><routing-engine><name>re0</name>
+<xnm:warning xmlns:xnm="http://xml.juniper.net/xnm/1.1/xnm"><message>mgd: statement has no contents; ignored</message></xnm:warning>
+<commit-success/></routing-engine></commit-results>
+</rpc-reply>`,
+			success: true,
+			expected: []RPCError{
+				{Type: "application", Tag: "operation-failed", Severity: "warning", Message: "mgd: statement has no contents; ignored"},
+			},
+		},
+		{
+			name: "error",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<commit-results><routing-engine><name>re0</name>
+<xnm:error xmlns:xnm="http://xml.juniper.net/xnm/1.1/xnm">
+<edit-path>[edit interfaces ge-0/0/0 unit 0 family inet]</edit-path>
+<statement>address 10.0.0.1/24</statement>
+<message>Cannot configure same address on two interfaces</message>
+</xnm:error>
+</routing-engine></commit-results>
+</rpc-reply>`,
+			expected: []RPCError{
+				{
+					Type:     "application",
+					Tag:      "operation-failed",
+					Severity: "error",
+					Path:     "[edit interfaces ge-0/0/0 unit 0 family inet]",
+					Message:  "Cannot configure same address on two interfaces",
+					Info:     map[string]string{"statement": "address 10.0.0.1/24"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reply, err := newRPCReply([]byte(tc.rawXML), false, "")
+			if (err != nil) == tc.success {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			res, err := reply.JunosCommitResults()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.Success != tc.success {
+				t.Errorf("got success %v, expected %v", res.Success, tc.success)
+			}
+			if diff := cmp.Diff(tc.expected, res.Errors); diff != "" {
+				t.Errorf("unexpected errors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCommitCheck(t *testing.T) {
+	s, trans := newMemorySession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><commit-results><routing-engine><name>re0</name><commit-check-success/></routing-engine></commit-results></rpc-reply>`)
+
+	res, err := s.CommitCheck(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Success {
+		t.Errorf("expected success")
+	}
+	if diff := cmp.Diff([]string{"commit-configuration"}, sentOperations(trans)); diff != "" {
+		t.Errorf("unexpected operations (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewRPCReplyJunosErrors(t *testing.T) {
+	tt := []struct {
+		name     string
+		rawXML   string
+		expected string
+	}{
+		{
+			name: "commit",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<commit-results><routing-engine><name>re0</name>
+<xnm:error xmlns:xnm="http://xml.juniper.net/xnm/1.1/xnm"><message>commit failed</message></xnm:error>
+</routing-engine></commit-results>
+</rpc-reply>`,
+			expected: "commit failed",
+		},
+		{
+			name: "load",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<load-configuration-results>
+<xnm:error xmlns:xnm="http://xml.juniper.net/xnm/1.1/xnm"><line-number>1</line-number><message>syntax error</message></xnm:error>
+<load-error-count>1</load-error-count>
+</load-configuration-results>
+</rpc-reply>`,
+			expected: "syntax error",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newRPCReply([]byte(tc.rawXML), false, "")
+			rpcErr, ok := err.(*RPCError)
+			if !ok {
+				t.Fatalf("expected *RPCError, got %v", err)
+			}
+			if rpcErr.Message != tc.expected {
+				t.Errorf("got %s, expected %s", rpcErr.Message, tc.expected)
+			}
+		})
+	}
+
+	// warnings don't fail the reply
+	rawXML := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><load-configuration-results><xnm:warning xmlns:xnm="http://xml.juniper.net/xnm/1.1/xnm"><message>statement not found</message></xnm:warning><ok/></load-configuration-results></rpc-reply>`
+	reply, err := newRPCReply([]byte(rawXML), false, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reply.Errors) != 1 || reply.Errors[0].Severity != "warning" {
+		t.Errorf("unexpected errors %v", reply.Errors)
+	}
+}
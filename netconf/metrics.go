@@ -0,0 +1,51 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives the measurements of a session, see Session.Metrics. The
+// methods are called synchronously and must be safe for concurrent use.
+type Metrics interface {
+	// ObserveRPC is called once a request completes with the operation name,
+	// such as get-config, the time spent waiting for the reply and the error
+	// returned if any
+	ObserveRPC(method string, d time.Duration, err error)
+	// IncNotification is called for every notification received with the
+	// stream of the subscription
+	IncNotification(stream string)
+}
+
+// observeRPC counts the request m started at start in the stats of the
+// session and reports it to its metrics, if any. It is meant to be deferred
+// with the address of the error returned.
+func (s *Session) observeRPC(m *RPCMessage, start time.Time, err *error) {
+	atomic.AddUint64(&s.stats.rpcs, 1)
+	if *err != nil {
+		atomic.AddUint64(&s.stats.errors, 1)
+	}
+	if s.Metrics == nil {
+		return
+	}
+
+	names := make([]string, len(m.Methods))
+	for i, method := range m.Methods {
+		names[i] = methodName(method)
+	}
+	s.Metrics.ObserveRPC(strings.Join(names, ","), time.Since(start), *err)
+}
+
+func (s *Session) observeNotification(n *Notification) {
+	atomic.AddUint64(&s.stats.notifications, 1)
+	if s.Metrics != nil {
+		s.Metrics.IncNotification(n.Stream)
+	}
+}
@@ -0,0 +1,90 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type testMetrics struct {
+	mu            sync.Mutex
+	rpcs          []string
+	notifications []string
+}
+
+func (m *testMetrics) ObserveRPC(method string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rpcs = append(m.rpcs, fmt.Sprintf("%s %v", method, err != nil))
+}
+
+func (m *testMetrics) IncNotification(stream string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifications = append(m.notifications, stream)
+}
+
+func TestMetricsRPC(t *testing.T) {
+	trans, _ := newTransportTest(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>]]>]]>`)
+	metrics := &testMetrics{}
+	s := &Session{Transport: trans, Metrics: metrics}
+
+	if _, err := s.Exec(MethodLock("candidate"), MethodGetConfig("candidate")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the transport has no more replies
+	s.ExecContext(context.Background(), MethodUnlock("candidate"))
+
+	expected := []string{"lock,get-config false", "unlock true"}
+	if diff := cmp.Diff(expected, metrics.rpcs); diff != "" {
+		t.Errorf("unexpected observations (-want +got):\n%s", diff)
+	}
+
+	// no metrics is a no-op
+	s = &Session{Transport: trans}
+	s.Exec(MethodUnlock("candidate"))
+}
+
+func TestMetricsNotification(t *testing.T) {
+	s := newServerTest(func(server *transportTest) {
+		req, err := server.Receive()
+		if err != nil {
+			return
+		}
+		id := messageIDRE.FindSubmatch(req)[1]
+		server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, id)))
+		server.Send(testNotification("2018-01-01T00:00:01Z", `<event xmlns="urn:event">1</event>`))
+		server.Send(testNotification("2018-01-01T00:00:02Z", `<notificationComplete/>`))
+		server.Receive()
+	})
+	s.serverCapabilities = []string{capNotification}
+	metrics := &testMetrics{}
+	s.Metrics = metrics
+	defer s.Close()
+
+	ch, err := s.Subscribe(context.Background(), &Subscription{Stream: "audit"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range ch {
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if diff := cmp.Diff([]string{"create-subscription false"}, metrics.rpcs); diff != "" {
+		t.Errorf("unexpected observations (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"audit", "audit"}, metrics.notifications); diff != "" {
+		t.Errorf("unexpected notifications (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,163 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MonitoringSession describes a session active on the server, as reported by
+// ietf-netconf-monitoring (RFC 6022).
+type MonitoringSession struct {
+	SessionID uint32 `xml:"session-id"`
+	// Transport is the transport identity, such as netconf-ssh
+	Transport string `xml:"transport"`
+	// Username is the login name the session authenticated as
+	Username   string    `xml:"username"`
+	SourceHost string    `xml:"source-host"`
+	LoginTime  time.Time `xml:"login-time"`
+
+	InRPCs           uint32 `xml:"in-rpcs"`
+	InBadRPCs        uint32 `xml:"in-bad-rpcs"`
+	OutRPCErrors     uint32 `xml:"out-rpc-errors"`
+	OutNotifications uint32 `xml:"out-notifications"`
+}
+
+// MonitoringDatastore describes a datastore of the server and its locks, as
+// reported by ietf-netconf-monitoring.
+type MonitoringDatastore struct {
+	Name Datastore `xml:"name"`
+	// GlobalLock is set when the whole datastore is locked
+	GlobalLock *GlobalLockState `xml:"locks>global-lock"`
+	// PartialLocks are the partial locks held on the datastore
+	PartialLocks []PartialLockState `xml:"locks>partial-lock"`
+}
+
+// GlobalLockState describes a lock on a whole datastore.
+type GlobalLockState struct {
+	LockedBySession uint32    `xml:"locked-by-session"`
+	LockedTime      time.Time `xml:"locked-time"`
+}
+
+// PartialLockState describes a partial lock, see PartialLock.
+type PartialLockState struct {
+	LockID          uint32    `xml:"lock-id"`
+	LockedBySession uint32    `xml:"locked-by-session"`
+	LockedTime      time.Time `xml:"locked-time"`
+	// Select are the XPath expressions of the partial-lock request
+	Select []string `xml:"select"`
+	// LockedNodes are the instance identifiers of the nodes locked
+	LockedNodes []string `xml:"locked-node"`
+}
+
+// schemaLocationNETCONF is the location of a schema retrievable with get-schema
+const schemaLocationNETCONF = "NETCONF"
+
+// SchemaInfo describes a schema supported by the server, as reported by
+// ietf-netconf-monitoring.
+type SchemaInfo struct {
+	Identifier string `xml:"identifier"`
+	Version    string `xml:"version"`
+	// Format is the schema format identity without its prefix, such as yang,
+	// as expected by MethodGetSchema
+	Format    string `xml:"format"`
+	Namespace string `xml:"namespace"`
+	// Location are the locations the schema can be retrieved from, NETCONF
+	// for get-schema and/or URLs
+	Location []string `xml:"location"`
+}
+
+// Retrievable reports whether the schema can be retrieved with get-schema.
+func (i SchemaInfo) Retrievable() bool {
+	return contains(i.Location, schemaLocationNETCONF)
+}
+
+// URLs returns the locations of the schema other than NETCONF.
+func (i SchemaInfo) URLs() []string {
+	var urls []string
+	for _, l := range i.Location {
+		if l != schemaLocationNETCONF {
+			urls = append(urls, l)
+		}
+	}
+	return urls
+}
+
+// Sessions retrieves the sessions active on the server, including this one,
+// e.g. to find the holder of a lock before using KillSession.
+func (s *Session) Sessions(ctx context.Context) ([]MonitoringSession, error) {
+	var v struct {
+		Sessions []MonitoringSession `xml:"sessions>session"`
+	}
+	if err := s.getNetconfState(ctx, "sessions", &v); err != nil {
+		return nil, err
+	}
+	return v.Sessions, nil
+}
+
+// Datastores retrieves the datastores of the server with their locks.
+func (s *Session) Datastores(ctx context.Context) ([]MonitoringDatastore, error) {
+	var v struct {
+		Datastores []MonitoringDatastore `xml:"datastores>datastore"`
+	}
+	if err := s.getNetconfState(ctx, "datastores", &v); err != nil {
+		return nil, err
+	}
+	return v.Datastores, nil
+}
+
+// Schemas retrieves the schemas supported by the server. Those with a NETCONF
+// location can be downloaded with GetSchema.
+func (s *Session) Schemas(ctx context.Context) ([]SchemaInfo, error) {
+	var v struct {
+		Schemas []SchemaInfo `xml:"schemas>schema"`
+	}
+	if err := s.getNetconfState(ctx, "schemas", &v); err != nil {
+		return nil, err
+	}
+	for i := range v.Schemas {
+		schema := &v.Schemas[i]
+		schema.Format = strings.TrimSpace(schema.Format)
+		if i := strings.LastIndex(schema.Format, ":"); i >= 0 {
+			schema.Format = schema.Format[i+1:]
+		}
+		for j, l := range schema.Location {
+			schema.Location[j] = strings.TrimSpace(l)
+		}
+	}
+	return v.Schemas, nil
+}
+
+// getNetconfState retrieves the container of netconf-state and decodes
+// netconf-state into v, which is left untouched if the server returned no
+// data.
+func (s *Session) getNetconfState(ctx context.Context, container string, v interface{}) error {
+	if !hasCapability(s.serverCapabilities, monitoringNS) {
+		return fmt.Errorf("%s requires the ietf-netconf-monitoring capability", container)
+	}
+
+	filter := fmt.Sprintf(`<netconf-state xmlns="%s"><%s/></netconf-state>`, monitoringNS, container)
+	return s.getState(ctx, filter, v)
+}
+
+// getState retrieves the state selected by the subtree filter and decodes the
+// first element of the data into v, which is left untouched if the server
+// returned no data.
+func (s *Session) getState(ctx context.Context, filter string, v interface{}) error {
+	reply, err := s.ExecContext(ctx, MethodGet("subtree", filter))
+	if err != nil {
+		return err
+	}
+
+	if root := reply.DataElement(); root == nil || len(root.ChildElements()) == 0 {
+		return nil
+	}
+	return reply.Unmarshal(v)
+}
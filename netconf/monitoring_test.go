@@ -0,0 +1,144 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newMonitoringSession returns a session advertising ietf-netconf-monitoring
+// and receiving replies.
+func newMonitoringSession(t *testing.T, replies ...string) (*Session, *MemoryTransport) {
+	s, trans := newMemorySession(t, replies...)
+	s.serverCapabilities = append(s.serverCapabilities, monitoringNS+"?module=ietf-netconf-monitoring&revision=2010-10-04")
+	return s, trans
+}
+
+func TestSessions(t *testing.T) {
+	s, trans := newMonitoringSession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>
+<netconf-state xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><sessions>
+<session><session-id>4</session-id><transport>netconf-ssh</transport><username>admin</username><source-host>192.0.2.1</source-host><login-time>2021-09-01T10:00:00Z</login-time><in-rpcs>12</in-rpcs><in-bad-rpcs>0</in-bad-rpcs><out-rpc-errors>1</out-rpc-errors><out-notifications>0</out-notifications></session>
+<session><session-id>7</session-id><transport>netconf-ssh</transport><username>ops</username><source-host>192.0.2.2</source-host><login-time>2021-09-01T11:30:00+02:00</login-time></session>
+</sessions></netconf-state>
+</data></rpc-reply>`)
+
+	sessions, err := s.Sessions(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []MonitoringSession{
+		{SessionID: 4, Transport: "netconf-ssh", Username: "admin", SourceHost: "192.0.2.1", LoginTime: time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC), InRPCs: 12, OutRPCErrors: 1},
+		{SessionID: 7, Transport: "netconf-ssh", Username: "ops", SourceHost: "192.0.2.2", LoginTime: time.Date(2021, 9, 1, 9, 30, 0, 0, time.UTC)},
+	}
+	if diff := cmp.Diff(expected, sessions, cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) })); diff != "" {
+		t.Errorf("unexpected sessions (-want +got):\n%s", diff)
+	}
+	if !strings.Contains(string(trans.Sent()[1]), "<sessions/>") {
+		t.Errorf("unexpected request %s", trans.Sent()[1])
+	}
+}
+
+func TestDatastores(t *testing.T) {
+	s, _ := newMonitoringSession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>
+<netconf-state xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><datastores>
+<datastore><name>running</name><locks>
+<partial-lock><lock-id>1</lock-id><locked-by-session>7</locked-by-session><locked-time>2021-09-01T10:00:00Z</locked-time><select>/if:interfaces</select><locked-node>/if:interfaces/if:interface[if:name='eth0']</locked-node></partial-lock>
+</locks></datastore>
+<datastore><name>candidate</name><locks><global-lock><locked-by-session>4</locked-by-session><locked-time>2021-09-01T10:05:00Z</locked-time></global-lock></locks></datastore>
+<datastore><name>startup</name></datastore>
+</datastores></netconf-state>
+</data></rpc-reply>`)
+
+	datastores, err := s.Datastores(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []MonitoringDatastore{
+		{
+			Name: Running,
+			PartialLocks: []PartialLockState{{
+				LockID:          1,
+				LockedBySession: 7,
+				LockedTime:      time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC),
+				Select:          []string{"/if:interfaces"},
+				LockedNodes:     []string{"/if:interfaces/if:interface[if:name='eth0']"},
+			}},
+		},
+		{
+			Name:       Candidate,
+			GlobalLock: &GlobalLockState{LockedBySession: 4, LockedTime: time.Date(2021, 9, 1, 10, 5, 0, 0, time.UTC)},
+		},
+		{Name: Startup},
+	}
+	if diff := cmp.Diff(expected, datastores); diff != "" {
+		t.Errorf("unexpected datastores (-want +got):\n%s", diff)
+	}
+}
+
+func TestMonitoringCapability(t *testing.T) {
+	s := &Session{}
+	if _, err := s.Sessions(context.Background()); err == nil {
+		t.Errorf("expected error without ietf-netconf-monitoring capability")
+	}
+
+	s, _ = newMonitoringSession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data/></rpc-reply>`)
+	datastores, err := s.Datastores(context.Background())
+	if err != nil || datastores != nil {
+		t.Errorf("unexpected result %v, %v", datastores, err)
+	}
+}
+
+func TestSchemas(t *testing.T) {
+	s, trans := newMonitoringSession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>
+<netconf-state xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><schemas>
+<schema><identifier>ietf-interfaces</identifier><version>2018-02-20</version><format xmlns:ncm="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring">ncm:yang</format><namespace>urn:ietf:params:xml:ns:yang:ietf-interfaces</namespace><location>NETCONF</location></schema>
+<schema><identifier>acme-system</identifier><version>2021-01-01</version><format>yin</format><namespace>http://example.com/acme</namespace><location>NETCONF</location><location>https://example.com/acme-system.yin</location></schema>
+<schema><identifier>acme-types</identifier><version></version><format>yang</format><namespace>http://example.com/types</namespace><location>ftp://example.com/acme-types.yang</location></schema>
+</schemas></netconf-state>
+</data></rpc-reply>`)
+
+	schemas, err := s.Schemas(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []SchemaInfo{
+		{Identifier: "ietf-interfaces", Version: "2018-02-20", Format: "yang", Namespace: "urn:ietf:params:xml:ns:yang:ietf-interfaces", Location: []string{"NETCONF"}},
+		{Identifier: "acme-system", Version: "2021-01-01", Format: "yin", Namespace: "http://example.com/acme", Location: []string{"NETCONF", "https://example.com/acme-system.yin"}},
+		{Identifier: "acme-types", Format: "yang", Namespace: "http://example.com/types", Location: []string{"ftp://example.com/acme-types.yang"}},
+	}
+	if diff := cmp.Diff(expected, schemas); diff != "" {
+		t.Errorf("unexpected schemas (-want +got):\n%s", diff)
+	}
+	if !strings.Contains(string(trans.Sent()[1]), "<schemas/>") {
+		t.Errorf("unexpected request %s", trans.Sent()[1])
+	}
+
+	tests := []struct {
+		retrievable bool
+		urls        []string
+	}{
+		{true, nil},
+		{true, []string{"https://example.com/acme-system.yin"}},
+		{false, []string{"ftp://example.com/acme-types.yang"}},
+	}
+	for i, tc := range tests {
+		if got := schemas[i].Retrievable(); got != tc.retrievable {
+			t.Errorf("%s: got retrievable %t, expected %t", schemas[i].Identifier, got, tc.retrievable)
+		}
+		if diff := cmp.Diff(tc.urls, schemas[i].URLs()); diff != "" {
+			t.Errorf("%s: unexpected urls (-want +got):\n%s", schemas[i].Identifier, diff)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconftest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("netconftest.update", false, "update the golden files of AssertRequest")
+
+// AssertRequest compares the XML request got, such as the output of
+// RPCMethod.MarshalMethod or a message recorded by netconf.MemoryTransport,
+// with the content of the golden file wantFile. Both are normalized first:
+// attributes are sorted, whitespace between elements, comments and the XML
+// declaration are ignored, so only differences meaningful to a device fail
+// the test.
+//
+// Running the tests with -netconftest.update writes got to wantFile instead.
+func AssertRequest(t testing.TB, got []byte, wantFile string) {
+	t.Helper()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(wantFile), 0755); err != nil {
+			t.Fatalf("can't create golden file directory: %v", err)
+		}
+		if err := ioutil.WriteFile(wantFile, got, 0644); err != nil {
+			t.Fatalf("can't update golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(wantFile)
+	if err != nil {
+		t.Fatalf("can't read golden file: %v", err)
+	}
+
+	normGot, err := NormalizeXML(got)
+	if err != nil {
+		t.Fatalf("invalid request: %v", err)
+	}
+	normWant, err := NormalizeXML(want)
+	if err != nil {
+		t.Fatalf("invalid golden file %s: %v", wantFile, err)
+	}
+
+	if diff := cmp.Diff(strings.Split(normWant, "\n"), strings.Split(normGot, "\n")); diff != "" {
+		t.Errorf("request differs from %s (-want +got):\n%s", wantFile, diff)
+	}
+}
+
+// NormalizeXML returns data indented one element per line with sorted
+// attributes and without insignificant whitespace, comments or XML
+// declaration. Namespace prefixes are kept as written.
+func NormalizeXML(data []byte) (string, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var buf bytes.Buffer
+	depth := 0
+	// text holds the character data of the element being read, written once
+	// its end shows whether it is a leaf
+	var text []byte
+
+	indent := func() {
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(strings.Repeat("  ", depth))
+	}
+	flushText := func() {
+		if trimmed := bytes.TrimSpace(text); len(trimmed) > 0 {
+			indent()
+			xml.EscapeText(&buf, trimmed)
+		}
+		text = nil
+	}
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			flushText()
+			indent()
+			buf.WriteString("<" + qualifiedName(tok.Name))
+
+			attrs := append([]xml.Attr(nil), tok.Attr...)
+			sort.Slice(attrs, func(i, j int) bool {
+				return qualifiedName(attrs[i].Name) < qualifiedName(attrs[j].Name)
+			})
+			for _, attr := range attrs {
+				fmt.Fprintf(&buf, ` %s="`, qualifiedName(attr.Name))
+				xml.EscapeText(&buf, []byte(attr.Value))
+				buf.WriteString(`"`)
+			}
+			buf.WriteString(">")
+			depth++
+		case xml.EndElement:
+			flushText()
+			depth--
+			indent()
+			buf.WriteString("</" + qualifiedName(tok.Name) + ">")
+		case xml.CharData:
+			text = append(text, tok...)
+		}
+	}
+
+	if depth != 0 {
+		return "", fmt.Errorf("unexpected end of document")
+	}
+	return buf.String(), nil
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
@@ -0,0 +1,65 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconftest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/olitez/go-netconf/netconf"
+)
+
+func TestAssertRequest(t *testing.T) {
+	s, trans := NewTestSession(t, []byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`))
+
+	config, err := netconf.EditOp(`<interface><name>eth0</name></interface>`, "delete")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = s.Exec(netconf.MethodEditConfigOpts("candidate", `<top xmlns="urn:example">`+config+`</top>`,
+		netconf.EditConfigOptions{DefaultOperation: "none"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	AssertRequest(t, trans.Sent()[1], filepath.Join("testdata", "edit-config.xml"))
+}
+
+func TestNormalizeXML(t *testing.T) {
+	tt := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"attribute order", `<a x="1" y="2"/>`, `<a y="2" x="1"></a>`, true},
+		{"whitespace", "<a>\n  <b> text </b>\n</a>", `<a><b>text</b></a>`, true},
+		{"declaration and comments", `<?xml version="1.0"?><!-- c --><a/>`, `<a/>`, true},
+		{"value", `<a x="1"/>`, `<a x="2"/>`, false},
+		{"text", `<a>1</a>`, `<a>2</a>`, false},
+		{"prefix", `<nc:a xmlns:nc="urn:x"/>`, `<a xmlns="urn:x"/>`, false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := NormalizeXML([]byte(tc.a))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			b, err := NormalizeXML([]byte(tc.b))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (a == b) != tc.same {
+				t.Errorf("got %q and %q", a, b)
+			}
+		})
+	}
+
+	if _, err := NormalizeXML([]byte(`<a><b></a>`)); err == nil {
+		t.Errorf("expected error for malformed XML")
+	}
+}
@@ -0,0 +1,61 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netconftest provides helpers to test code using NETCONF sessions
+// without a device.
+package netconftest
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"testing"
+
+	"github.com/olitez/go-netconf/netconf"
+)
+
+// DefaultHello is the server hello received by NewTestSession when the
+// replies don't start with one.
+var DefaultHello = []byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities>
+<session-id>1</session-id>
+</hello>`)
+
+// NewTestSession returns a session over a netconf.MemoryTransport receiving
+// replies, preceded by DefaultHello if the first reply isn't a hello. The
+// message-ids of the requests are 1, 2, 3... and the session is closed at the
+// end of the test.
+func NewTestSession(t testing.TB, replies ...[]byte) (*netconf.Session, *netconf.MemoryTransport) {
+	t.Helper()
+
+	if len(replies) == 0 || !isHello(replies[0]) {
+		replies = append([][]byte{DefaultHello}, replies...)
+	}
+
+	trans := netconf.NewMemoryTransport(replies...)
+	s, err := netconf.NewSessionContext(context.Background(), trans)
+	if err != nil {
+		t.Fatalf("hello exchange failed: %v", err)
+	}
+	s.SetMessageIDGenerator(netconf.MonotonicMessageID())
+	t.Cleanup(func() { s.Close() })
+
+	return s, trans
+}
+
+// isHello reports whether the root element of message is a hello.
+func isHello(message []byte) bool {
+	d := xml.NewDecoder(bytes.NewReader(message))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local == "hello"
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconftest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/olitez/go-netconf/netconf"
+)
+
+func TestNewTestSession(t *testing.T) {
+	s, trans := NewTestSession(t,
+		[]byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`),
+		[]byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="2"><data><top/></data></rpc-reply>`),
+	)
+
+	if s.SessionID() != 1 {
+		t.Errorf("unexpected session-id (want %d, got %d)", 1, s.SessionID())
+	}
+
+	reply, err := s.Exec(netconf.MethodLock("candidate"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reply.Ok {
+		t.Errorf("expected ok reply")
+	}
+
+	if _, err := s.Exec(netconf.MethodGetConfig("candidate")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the hello and the two requests
+	sent := trans.Sent()
+	if len(sent) != 3 {
+		t.Fatalf("got %d messages, expected %d", len(sent), 3)
+	}
+	if !strings.Contains(string(sent[2]), `<rpc message-id="2" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get-config><source><candidate/></source></get-config></rpc>`) {
+		t.Errorf("unexpected request %s", sent[2])
+	}
+
+	// no more replies
+	if _, err := s.Exec(netconf.MethodUnlock("candidate")); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestNewTestSessionHello(t *testing.T) {
+	s, _ := NewTestSession(t, []byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<capabilities><capability>urn:ietf:params:netconf:base:1.1</capability></capabilities>
+<session-id>42</session-id>
+</hello>`))
+
+	if s.SessionID() != 42 {
+		t.Errorf("unexpected session-id (want %d, got %d)", 42, s.SessionID())
+	}
+	if s.FramingVersion() != netconf.FramingV11 {
+		t.Errorf("unexpected framing %s", s.FramingVersion())
+	}
+}
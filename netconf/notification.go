@@ -0,0 +1,358 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	// notificationNS is the NETCONF event notifications (RFC 5277) namespace
+	notificationNS = "urn:ietf:params:xml:ns:netconf:notification:1.0"
+	// capNotification is advertised by servers supporting create-subscription
+	capNotification = "urn:ietf:params:netconf:capability:notification:1.0"
+	// capInterleave is advertised by servers accepting requests on a session
+	// with a subscription
+	capInterleave = "urn:ietf:params:netconf:capability:interleave:1.0"
+	// defaultStream is the stream used when none is given
+	defaultStream = "NETCONF"
+	// netmodNotificationNS is the namespace of the RFC 5277 stream list
+	netmodNotificationNS = "urn:ietf:params:xml:ns:netmod:notification"
+
+	// subscriptionStopGrace is how long after its stop time a subscription
+	// is ended if the server doesn't send notificationComplete
+	subscriptionStopGrace = 5 * time.Second
+)
+
+// ErrNoInterleave is returned for requests sent while a subscription is
+// active on a session whose server doesn't advertise the :interleave
+// capability, as the server wouldn't process them.
+var ErrNoInterleave = errors.New("server does not support requests during a subscription (:interleave)")
+
+// ErrReplayIncomplete is returned by Subscription.Err when a subscription with
+// a start time passed its stop time before the server reported the replay
+// complete, so notifications may be missing.
+var ErrReplayIncomplete = errors.New("subscription ended before the replay completed")
+
+// Notification is an event notification received on a subscription.
+type Notification struct {
+	EventTime time.Time
+	// Stream is the name of the stream the subscription was created on
+	Stream string
+	// Data holds the event content
+	Data *etree.Document
+	// Update is the decoded content of YANG-push push-update and
+	// push-change-update notifications, nil for other events and when
+	// decoding failed
+	Update *DatastoreUpdate
+	// UpdateErr is the reason a YANG-push update could not be decoded, such
+	// as an invalid patch. The notification is delivered regardless with its
+	// Data.
+	UpdateErr error
+}
+
+// Stream describes an event stream available for subscription.
+type Stream struct {
+	Name                  string    `xml:"name"`
+	Description           string    `xml:"description"`
+	ReplaySupport         bool      `xml:"replaySupport"`
+	ReplayLogCreationTime time.Time `xml:"replayLogCreationTime"`
+}
+
+// Streams retrieves the event streams supported by the server. A server
+// without streams returns an empty list.
+func (s *Session) Streams(ctx context.Context) ([]Stream, error) {
+	filter := fmt.Sprintf(`<netconf xmlns="%s"><streams/></netconf>`, netmodNotificationNS)
+	reply, err := s.ExecContext(ctx, MethodGet("subtree", filter))
+	if err != nil {
+		return nil, err
+	}
+
+	if root := reply.DataElement(); root == nil || len(root.ChildElements()) == 0 {
+		return nil, nil
+	}
+
+	var v struct {
+		Streams []Stream `xml:"streams>stream"`
+	}
+	if err := reply.Unmarshal(&v); err != nil {
+		return nil, err
+	}
+	return v.Streams, nil
+}
+
+// MethodCreateSubscription files a NETCONF create-subscription request with
+// the remote host. stream defaults to the NETCONF stream when empty, startTime
+// and stopTime are RFC 3339 date-times requesting a replay, filter is the
+// content of a subtree filter. Empty values are omitted.
+func MethodCreateSubscription(stream, startTime, stopTime string, filter string) RawMethod {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<create-subscription xmlns="%s">`, notificationNS)
+	if stream != "" {
+		fmt.Fprintf(&buf, "<stream>%s</stream>", escapeText(stream))
+	}
+	if filter != "" {
+		fmt.Fprintf(&buf, `<filter type="subtree">%s</filter>`, filter)
+	}
+	if startTime != "" {
+		fmt.Fprintf(&buf, "<startTime>%s</startTime>", escapeText(startTime))
+	}
+	if stopTime != "" {
+		fmt.Fprintf(&buf, "<stopTime>%s</stopTime>", escapeText(stopTime))
+	}
+	buf.WriteString("</create-subscription>")
+	return RawMethod(buf.String())
+}
+
+// Subscription is a subscription to an event stream, see Session.Subscribe,
+// or a dynamic subscription, see Session.EstablishSubscription. A
+// Subscription can only be used once.
+type Subscription struct {
+	// Stream is the name of the stream, NETCONF when empty
+	Stream string
+	// StartTime requests the replay of the notifications logged since then,
+	// which the stream must support
+	StartTime time.Time
+	// StopTime ends the subscription, it requires StartTime
+	StopTime time.Time
+	// Filter is the content of a subtree filter selecting the notifications
+	Filter string
+	// ID is the subscription id of a dynamic subscription, set once
+	// established
+	ID uint32
+
+	session *Session
+	// opts are the options of a dynamic subscription, nil for RFC 5277
+	opts *SubscriptionOptions
+	// messageID is the message-id of the create-subscription request
+	messageID string
+	// the fields below are guarded by the mutex of p, the pipeline of the
+	// session
+	p           *pipeline
+	ch          chan *Notification
+	replayed    bool
+	established bool
+	err         error
+	// done is closed when the subscription ends, unblocking a pending send
+	// on ch which is then closed by the reader goroutine
+	done    chan struct{}
+	sending bool
+	timer   *time.Timer
+}
+
+func (sub *Subscription) stream() string {
+	if sub.opts != nil {
+		return sub.opts.Stream
+	}
+	if sub.Stream == "" {
+		return defaultStream
+	}
+	return sub.Stream
+}
+
+// Err returns why the notification channel was closed: nil when the server
+// reported the subscription complete or its stop time passed,
+// ErrReplayIncomplete if the replay didn't complete by then, or the error
+// which ended the session. It returns nil while the subscription is active.
+func (sub *Subscription) Err() error {
+	if sub.p == nil {
+		return nil
+	}
+
+	sub.p.mu.Lock()
+	defer sub.p.mu.Unlock()
+	return sub.err
+}
+
+// ended reports whether the subscription ended. The mutex of sub.p must be
+// held.
+func (sub *Subscription) ended() bool {
+	select {
+	case <-sub.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Cancel stops delivering the notifications of the subscription and closes
+// its channel, after which Err returns nil. RFC 5277 has no operation ending a
+// subscription, so the server keeps sending notifications, which are dropped,
+// and the session can't subscribe again.
+//
+// The session stays usable for other requests only if the server advertises
+// the :interleave capability, see Session.CanInterleave. Otherwise Cancel
+// closes the session. Dynamic subscriptions don't need it, but should rather
+// be deleted with Session.DeleteSubscription for the server to stop sending
+// their notifications.
+func (sub *Subscription) Cancel() error {
+	if sub.p == nil {
+		return nil
+	}
+
+	sub.p.mu.Lock()
+	active := !sub.ended()
+	sub.p.endSubscription(sub, nil)
+	sub.p.mu.Unlock()
+
+	if !active || sub.opts != nil || sub.session.CanInterleave() {
+		return nil
+	}
+	return sub.session.Close()
+}
+
+// Subscribe creates the subscription sub and returns a channel receiving its
+// notifications.
+//
+// A replay requested with a start time is checked against the replaySupport
+// the server advertises for the stream, see Streams, before anything is sent.
+// Times are sent in UTC with the Z suffix, see formatDateTime.
+//
+// The session is switched to pipelined mode (see ExecAsync) to receive the
+// notifications. Unless the server supports interleave (see CanInterleave)
+// other requests fail with ErrNoInterleave until the subscription ends. The
+// channel is closed when the server sends notificationComplete, or
+// replayComplete once the stop time passed, shortly after the stop time if
+// the server sends neither, or when the session ends, see Subscription.Err to
+// tell these apart. The channel must be drained as the replies to other
+// requests are read by the same goroutine.
+func (s *Session) Subscribe(ctx context.Context, sub *Subscription) (<-chan *Notification, error) {
+	if !hasCapability(s.serverCapabilities, capNotification) {
+		return nil, fmt.Errorf("server does not support the :notification capability")
+	}
+	if err := s.checkSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	var start, stop string
+	if !sub.StartTime.IsZero() {
+		start = formatDateTime(sub.StartTime)
+	}
+	if !sub.StopTime.IsZero() {
+		stop = formatDateTime(sub.StopTime)
+	}
+
+	// Register the channel before sending the request as notifications can be
+	// received ahead of the reply.
+	m := s.newRPCMessage([]RPCMethod{MethodCreateSubscription(sub.stream(), start, stop, sub.Filter)})
+	sub.session = s
+	sub.messageID = m.MessageID
+
+	p := s.startPipeline()
+	if err := p.subscribe(sub); err != nil {
+		return nil, err
+	}
+	sent := time.Now()
+	_, err := s.execPipelined(ctx, p, m)
+	s.observeRPC(m, sent, &err)
+	if err != nil {
+		p.mu.Lock()
+		p.endSubscription(sub, err)
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.watchStopTime(sub)
+	return sub.ch, nil
+}
+
+// CanInterleave reports whether the server advertises the :interleave
+// capability, accepting requests on a session with an active subscription.
+func (s *Session) CanInterleave() bool {
+	return hasCapability(s.serverCapabilities, capInterleave)
+}
+
+// checkSubscription verifies the times of sub and that the server supports
+// replay on the stream if requested. Servers not listing their streams are
+// trusted to support it.
+func (s *Session) checkSubscription(ctx context.Context, sub *Subscription) error {
+	if sub.ch != nil {
+		return fmt.Errorf("subscription already used")
+	}
+	if sub.StartTime.IsZero() {
+		if !sub.StopTime.IsZero() {
+			return fmt.Errorf("subscription stop time requires a start time")
+		}
+		return nil
+	}
+	if sub.StartTime.After(time.Now()) {
+		return fmt.Errorf("subscription start time %s is in the future", formatDateTime(sub.StartTime))
+	}
+	if !sub.StopTime.IsZero() && !sub.StopTime.After(sub.StartTime) {
+		return fmt.Errorf("subscription stop time must be after the start time")
+	}
+
+	streams, err := s.Streams(ctx)
+	if isConnectionError(err) || ctx.Err() != nil {
+		return err
+	}
+	if err != nil || len(streams) == 0 {
+		return nil
+	}
+	for _, stream := range streams {
+		if stream.Name != sub.stream() {
+			continue
+		}
+		if !stream.ReplaySupport {
+			return fmt.Errorf("stream %s does not support replay", stream.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("stream %s not advertised by server", sub.stream())
+}
+
+// formatDateTime formats t as a RFC 3339 date-time in UTC. The Z suffix is
+// accepted by all servers, whereas some reject local offsets or times
+// without time zone.
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseNotification decodes a notification message. The first element besides
+// eventTime is the event content.
+func parseNotification(rawXML []byte) (*Notification, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(rawXML); err != nil {
+		return nil, err
+	}
+
+	root := doc.Root()
+	if root == nil || root.Tag != "notification" {
+		return nil, fmt.Errorf("not a notification")
+	}
+
+	n := &Notification{Data: etree.NewDocument()}
+	for _, el := range root.ChildElements() {
+		if el.Tag == "eventTime" {
+			// RFC3339Nano also accepts no or any number of fractional digits
+			t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(el.Text()))
+			if err != nil {
+				return nil, fmt.Errorf("invalid eventTime: %v", err)
+			}
+			n.EventTime = t
+			continue
+		}
+
+		if n.Data.Root() == nil {
+			inheritNamespaces(el, root)
+			n.Data.SetRoot(el)
+		}
+	}
+
+	if n.EventTime.IsZero() {
+		return nil, fmt.Errorf("notification without eventTime")
+	}
+
+	n.Update, n.UpdateErr = parseDatastoreUpdate(n.Data.Root(), n.EventTime)
+	return n, nil
+}
@@ -0,0 +1,542 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMethodCreateSubscription(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		{MethodCreateSubscription("", "", "", ""), `<create-subscription xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"></create-subscription>`},
+		{
+			MethodCreateSubscription("NETCONF", "2018-01-01T00:00:00Z", "2018-01-02T00:00:00Z", `<event xmlns="urn:event"/>`),
+			`<create-subscription xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><stream>NETCONF</stream><filter type="subtree"><event xmlns="urn:event"/></filter><startTime>2018-01-01T00:00:00Z</startTime><stopTime>2018-01-02T00:00:00Z</stopTime></create-subscription>`,
+		},
+	}
+
+	for _, tc := range tt {
+		if tc.method.MarshalMethod() != tc.expected {
+			t.Errorf("got %s, expected %s", tc.method, tc.expected)
+		}
+	}
+}
+
+func testNotification(eventTime, event string) []byte {
+	return []byte(fmt.Sprintf(`<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>%s</eventTime>%s</notification>`, eventTime, event))
+}
+
+func TestSubscribe(t *testing.T) {
+	s := newServerTest(func(server *transportTest) {
+		req, err := server.Receive()
+		if err != nil {
+			return
+		}
+		id := messageIDRE.FindSubmatch(req)[1]
+
+		// a notification ahead of the reply
+		server.Send(testNotification("2018-01-01T00:00:00Z", `<event xmlns="urn:event">1</event>`))
+		server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, id)))
+		server.Send(testNotification("2018-01-01T00:00:01Z", `<event xmlns="urn:event">2</event>`))
+		server.Send(testNotification("2018-01-01T00:00:02Z", `<notificationComplete/>`))
+
+		// keep the session open so only notificationComplete ends it
+		server.Receive()
+	})
+	s.serverCapabilities = []string{capNotification}
+	defer s.Close()
+
+	sub := &Subscription{}
+	ch, err := s.Subscribe(context.Background(), sub)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var events []string
+	for n := range ch {
+		if n.EventTime.IsZero() {
+			t.Errorf("missing eventTime")
+		}
+		if n.Stream != "NETCONF" {
+			t.Errorf("unexpected stream %q", n.Stream)
+		}
+		events = append(events, n.Data.Root().Text())
+	}
+
+	if fmt.Sprint(events) != "[1 2]" {
+		t.Errorf("unexpected events %v", events)
+	}
+	if err := sub.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSubscribeStopTime(t *testing.T) {
+	tt := []struct {
+		name     string
+		stopTime time.Time
+		messages [][]byte
+		events   string
+		err      error
+		closed   bool
+	}{
+		{
+			name:     "replay complete",
+			stopTime: time.Now(),
+			messages: [][]byte{
+				testNotification("2018-01-01T00:00:00Z", `<event xmlns="urn:event">1</event>`),
+				testNotification("2018-01-01T00:00:01Z", `<replayComplete/>`),
+			},
+			events: "[1]",
+		},
+		{
+			name:     "replay incomplete",
+			stopTime: time.Now().Add(-time.Minute),
+			events:   "[]",
+			err:      ErrReplayIncomplete,
+		},
+		{
+			name:     "session closed",
+			stopTime: time.Now().Add(time.Hour),
+			messages: [][]byte{
+				testNotification("2018-01-01T00:00:00Z", `<event xmlns="urn:event">1</event>`),
+			},
+			events: "[1]",
+			err:    ErrTransportClosed,
+			closed: true,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc // used by the server goroutine beyond the subtest
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerTest(func(server *transportTest) {
+				replyStreams(server, testReplayStreams)
+				req, err := server.Receive()
+				if err != nil {
+					return
+				}
+				id := messageIDRE.FindSubmatch(req)[1]
+				server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, id)))
+				for _, msg := range tc.messages {
+					server.Send(msg)
+				}
+				if !tc.closed {
+					server.Receive()
+				}
+			})
+			s.serverCapabilities = []string{capNotification}
+			defer s.Close()
+
+			sub := &Subscription{StartTime: tc.stopTime.Add(-time.Hour), StopTime: tc.stopTime}
+			ch, err := s.Subscribe(context.Background(), sub)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var events []string
+			for n := range ch {
+				events = append(events, n.Data.Root().Text())
+			}
+			if fmt.Sprint(events) != tc.events {
+				t.Errorf("got events %v, expected %s", events, tc.events)
+			}
+			if err := sub.Err(); !errors.Is(err, tc.err) {
+				t.Errorf("got %v, expected %v", err, tc.err)
+			}
+		})
+	}
+}
+
+const testReplayStreams = `<stream><name>NETCONF</name><replaySupport>true</replaySupport></stream><stream><name>live</name><replaySupport>false</replaySupport></stream>`
+
+// replyStreams answers the request of Streams with streams.
+func replyStreams(server *transportTest, streams string) {
+	req, err := server.Receive()
+	if err != nil {
+		return
+	}
+	id := messageIDRE.FindSubmatch(req)[1]
+	server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><data><netconf xmlns="urn:ietf:params:xml:ns:netmod:notification"><streams>%s</streams></netconf></data></rpc-reply>`, id, streams)))
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	start := time.Date(2018, 1, 1, 2, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+
+	tt := []struct {
+		name    string
+		sub     Subscription
+		streams string
+		request string
+		err     bool
+	}{
+		{
+			name:    "replay",
+			sub:     Subscription{StartTime: start, StopTime: start.Add(time.Hour)},
+			streams: testReplayStreams,
+			request: "<startTime>2018-01-01T00:00:00Z</startTime><stopTime>2018-01-01T01:00:00Z</stopTime>",
+		},
+		{
+			name:    "streams not listed",
+			sub:     Subscription{Stream: "audit", StartTime: start},
+			request: "<startTime>2018-01-01T00:00:00Z</startTime>",
+		},
+		{
+			name:    "no replay support",
+			sub:     Subscription{Stream: "live", StartTime: start},
+			streams: testReplayStreams,
+			err:     true,
+		},
+		{
+			name:    "unknown stream",
+			sub:     Subscription{Stream: "audit", StartTime: start},
+			streams: testReplayStreams,
+			err:     true,
+		},
+		{
+			name: "stop without start",
+			sub:  Subscription{StopTime: start},
+			err:  true,
+		},
+		{
+			name: "start in the future",
+			sub:  Subscription{StartTime: time.Now().Add(time.Hour)},
+			err:  true,
+		},
+		{
+			name: "stop before start",
+			sub:  Subscription{StartTime: start, StopTime: start},
+			err:  true,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc // used by the server goroutine beyond the subtest
+		t.Run(tc.name, func(t *testing.T) {
+			requests := make(chan string, 1)
+			s := newServerTest(func(server *transportTest) {
+				replyStreams(server, tc.streams)
+				req, err := server.Receive()
+				if err != nil {
+					return
+				}
+				requests <- string(req)
+				id := messageIDRE.FindSubmatch(req)[1]
+				server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, id)))
+				server.Receive()
+			})
+			s.serverCapabilities = []string{capNotification}
+			defer s.Close()
+
+			_, err := s.Subscribe(context.Background(), &tc.sub)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if req := <-requests; !strings.Contains(req, tc.request) {
+				t.Errorf("got %s, expected %s", req, tc.request)
+			}
+		})
+	}
+}
+
+func TestSubscriptionCancel(t *testing.T) {
+	tt := []struct {
+		name       string
+		interleave bool
+	}{
+		{name: "interleave", interleave: true},
+		{name: "no interleave"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerTest(func(server *transportTest) {
+				for {
+					req, err := server.Receive()
+					if err != nil {
+						return
+					}
+					id := messageIDRE.FindSubmatch(req)[1]
+					server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, id)))
+					for i := 0; i < 3; i++ {
+						server.Send(testNotification("2018-01-01T00:00:00Z", `<event xmlns="urn:event"/>`))
+					}
+				}
+			})
+			s.serverCapabilities = []string{capNotification}
+			if tc.interleave {
+				s.serverCapabilities = append(s.serverCapabilities, capInterleave)
+			}
+			defer s.Close()
+
+			sub := &Subscription{}
+			ch, err := s.Subscribe(context.Background(), sub)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// the fake server doesn't read while sending
+			for i := 0; i < 3; i++ {
+				<-ch
+			}
+
+			if err := sub.Cancel(); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			for range ch {
+			}
+			if err := sub.Err(); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			_, err = s.Exec(MethodGetConfig(Running))
+			if tc.interleave && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.interleave && err == nil {
+				t.Errorf("expected the session to be closed")
+			}
+		})
+	}
+}
+
+func TestSubscriptionCancelBlocked(t *testing.T) {
+	p := &pipeline{pending: make(map[string]chan *RPCReply)}
+	sub := &Subscription{session: &Session{serverCapabilities: []string{capInterleave}}}
+	if err := p.subscribe(sub); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the reader blocks once the channel is full
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i <= notificationBuffer; i++ {
+			n, _ := parseNotification(testNotification("2018-01-01T00:00:00Z", `<event xmlns="urn:event"/>`))
+			p.notify(n)
+		}
+		close(done)
+	}()
+	for len(sub.ch) < notificationBuffer {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := sub.Cancel(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("reader still blocked after Cancel")
+	}
+
+	n := 0
+	for range sub.ch {
+		n++
+	}
+	if n != notificationBuffer {
+		t.Errorf("got %d notifications, expected %d", n, notificationBuffer)
+	}
+}
+
+func TestSubscribeInterleave(t *testing.T) {
+	tt := []struct {
+		name       string
+		interleave bool
+	}{
+		{name: "interleave", interleave: true},
+		{name: "no interleave"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerTest(func(server *transportTest) {
+				for {
+					req, err := server.Receive()
+					if err != nil {
+						return
+					}
+					id := messageIDRE.FindSubmatch(req)[1]
+					if strings.Contains(string(req), "<get-config>") {
+						// notifications around the reply are routed by element
+						server.Send(testNotification("2018-01-01T00:00:01Z", `<event xmlns="urn:event">2</event>`))
+						server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><data><top xmlns="urn:top"/></data></rpc-reply>`, id)))
+						server.Send([]byte(`<nc:notification xmlns:nc="urn:ietf:params:xml:ns:netconf:notification:1.0"><nc:eventTime>2018-01-01T00:00:02Z</nc:eventTime><event xmlns="urn:event">3</event></nc:notification>`))
+						continue
+					}
+					server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, id)))
+					server.Send(testNotification("2018-01-01T00:00:00Z", `<event xmlns="urn:event">1</event>`))
+				}
+			})
+			s.serverCapabilities = []string{capNotification}
+			if tc.interleave {
+				s.serverCapabilities = append(s.serverCapabilities, capInterleave)
+			}
+			defer s.Close()
+
+			if s.CanInterleave() != tc.interleave {
+				t.Errorf("got CanInterleave %t, expected %t", s.CanInterleave(), tc.interleave)
+			}
+
+			ch, err := s.Subscribe(context.Background(), &Subscription{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			<-ch
+
+			reply, err := s.Exec(MethodGetConfig(Running))
+			if !tc.interleave {
+				if !errors.Is(err, ErrNoInterleave) {
+					t.Errorf("got %v, expected %v", err, ErrNoInterleave)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reply.DataElement().SelectElement("top") == nil {
+				t.Errorf("unexpected reply %s", reply.Raw)
+			}
+
+			var events []string
+			for i := 0; i < 2; i++ {
+				events = append(events, (<-ch).Data.Root().Text())
+			}
+			if fmt.Sprint(events) != "[2 3]" {
+				t.Errorf("unexpected events %v", events)
+			}
+		})
+	}
+}
+
+func TestSubscribeCapability(t *testing.T) {
+	s := &Session{}
+	if _, err := s.Subscribe(context.Background(), &Subscription{}); err == nil {
+		t.Errorf("expected error without :notification capability")
+	}
+}
+
+func TestParseNotification(t *testing.T) {
+	tt := []struct {
+		name      string
+		rawXML    string
+		eventTime time.Time
+		event     string
+		err       bool
+	}{
+		{
+			name:      "utc",
+			rawXML:    string(testNotification("2018-03-04T05:06:07Z", `<event xmlns="urn:event"/>`)),
+			eventTime: time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC),
+			event:     "event",
+		},
+		{
+			name:      "fractionOffset",
+			rawXML:    string(testNotification(" 2018-03-04T07:06:07.123456+02:00\n", `<event xmlns="urn:event"/>`)),
+			eventTime: time.Date(2018, 3, 4, 5, 6, 7, 123456000, time.UTC),
+			event:     "event",
+		},
+		{
+			name: "prefixed",
+			rawXML: `<ncEvent:notification xmlns:ncEvent="urn:ietf:params:xml:ns:netconf:notification:1.0">
+<ncEvent:eventTime>2018-03-04T05:06:07-08:00</ncEvent:eventTime>
+<if:link-down xmlns:if="urn:if"><if:name>eth0</if:name></if:link-down>
+</ncEvent:notification>`,
+			eventTime: time.Date(2018, 3, 4, 13, 6, 7, 0, time.UTC),
+			event:     "link-down",
+		},
+		{
+			name:   "badTime",
+			rawXML: string(testNotification("yesterday", `<event/>`)),
+			err:    true,
+		},
+		{
+			name:   "noTime",
+			rawXML: `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><event/></notification>`,
+			err:    true,
+		},
+		{
+			name:   "reply",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`,
+			err:    true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := parseNotification([]byte(tc.rawXML))
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.err {
+				return
+			}
+
+			if !n.EventTime.Equal(tc.eventTime) {
+				t.Errorf("unexpected eventTime (want %v, got %v)", tc.eventTime, n.EventTime)
+			}
+			if root := n.Data.Root(); root == nil || root.Tag != tc.event {
+				t.Errorf("unexpected event %v", root)
+			}
+		})
+	}
+}
+
+func TestStreams(t *testing.T) {
+	tt := []struct {
+		name     string
+		reply    string
+		expected []Stream
+	}{
+		{
+			name: "streams",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>
+<netconf xmlns="urn:ietf:params:xml:ns:netmod:notification"><streams>
+<stream><name>NETCONF</name><description>default stream</description><replaySupport>true</replaySupport><replayLogCreationTime>2018-01-01T00:00:00Z</replayLogCreationTime></stream>
+<stream><name>SNMP</name><description>traps</description><replaySupport>false</replaySupport></stream>
+</streams></netconf>
+</data></rpc-reply>]]>]]>`,
+			expected: []Stream{
+				{Name: "NETCONF", Description: "default stream", ReplaySupport: true, ReplayLogCreationTime: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{Name: "SNMP", Description: "traps"},
+			},
+		},
+		{
+			name:  "empty",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data/></rpc-reply>]]>]]>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.reply)
+			s := &Session{Transport: trans}
+
+			streams, err := s.Streams(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(streams, tc.expected) {
+				t.Errorf("unexpected streams:\n%s", cmp.Diff(tc.expected, streams))
+			}
+		})
+	}
+}
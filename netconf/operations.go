@@ -0,0 +1,611 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// KillSession forces the termination of another NETCONF session, aborting its
+// operations and releasing its locks. Errors reported by the server such as
+// invalid-value or access-denied are returned as *RPCError.
+func (s *Session) KillSession(ctx context.Context, sessionID uint32) (*RPCReply, error) {
+	if sessionID == 0 {
+		return nil, fmt.Errorf("invalid session-id %d", sessionID)
+	}
+	if sessionID == s.sessionID {
+		return nil, fmt.Errorf("can't kill own session %d, use CloseSession", sessionID)
+	}
+	return s.ExecContext(ctx, MethodKillSession(sessionID))
+}
+
+// CopyConfig replaces the target configuration with the source one. Either
+// side can be a datastore or, if the server advertises the :url capability, a
+// URL such as Datastore("file:///backup.xml"). Copying a location onto itself
+// is rejected before anything is sent.
+func (s *Session) CopyConfig(ctx context.Context, target, source Datastore) (*RPCReply, error) {
+	if target == "" || source == "" {
+		return nil, fmt.Errorf("copy-config requires both target and source")
+	}
+	if target == source {
+		return nil, fmt.Errorf("copy-config from %s onto itself", source)
+	}
+	if err := s.checkConfigLocation(target); err != nil {
+		return nil, fmt.Errorf("copy-config: %w", err)
+	}
+	if err := s.checkConfigLocation(source); err != nil {
+		return nil, fmt.Errorf("copy-config: %w", err)
+	}
+	return s.ExecContext(ctx, MethodCopyConfig(target, source))
+}
+
+// DeleteConfig deletes the target configuration datastore or URL. The running
+// datastore can't be deleted and startup requires the :startup capability,
+// both are rejected before anything is sent. Errors such as
+// operation-not-supported are returned as *RPCError.
+func (s *Session) DeleteConfig(ctx context.Context, target Datastore) (*RPCReply, error) {
+	if target == "" {
+		return nil, fmt.Errorf("delete-config requires a target")
+	}
+	if target == Running {
+		return nil, fmt.Errorf("delete-config can't target the running datastore")
+	}
+	if target == Startup && !hasCapability(s.serverCapabilities, capStartup) {
+		return nil, fmt.Errorf("delete-config of startup requires the :startup capability")
+	}
+	if err := s.checkConfigLocation(target); err != nil {
+		return nil, fmt.Errorf("delete-config: %w", err)
+	}
+	return s.ExecContext(ctx, MethodDeleteConfig(target))
+}
+
+// checkConfigLocation checks the target or source of copy-config and
+// delete-config: a URL requires the :url capability, otherwise it must be a
+// known datastore.
+func (s *Session) checkConfigLocation(location Datastore) error {
+	if !isURL(location) {
+		return s.validateDatastore(location)
+	}
+	if !hasCapability(s.serverCapabilities, capURL) {
+		return fmt.Errorf("url requires the :url capability")
+	}
+	return nil
+}
+
+// CommitConfirmed starts a confirmed commit of the candidate configuration.
+// The server rolls back the commit unless it is confirmed with
+// CommitConfirming within timeout seconds. See MethodCommitConfirmed for the
+// arguments.
+func (s *Session) CommitConfirmed(ctx context.Context, timeout int, persist, persistID string) (*RPCReply, error) {
+	if err := s.checkConfirmedCommit(persist != "" || persistID != ""); err != nil {
+		return nil, err
+	}
+	return s.ExecContext(ctx, MethodCommitConfirmed(timeout, persist, persistID))
+}
+
+// CommitConfirming confirms a pending confirmed commit. persistID must match
+// the persist token if one was given when starting it.
+func (s *Session) CommitConfirming(ctx context.Context, persistID string) (*RPCReply, error) {
+	if err := s.checkConfirmedCommit(persistID != ""); err != nil {
+		return nil, err
+	}
+	return s.ExecContext(ctx, MethodCommitConfirming(persistID))
+}
+
+// CancelCommit aborts a pending confirmed commit, rolling back to the
+// configuration before it was started.
+func (s *Session) CancelCommit(ctx context.Context, persistID string) (*RPCReply, error) {
+	if !hasCapability(s.serverCapabilities, capConfirmedCommit11) {
+		return nil, fmt.Errorf("cancel-commit requires the :confirmed-commit:1.1 capability")
+	}
+	return s.ExecContext(ctx, MethodCancelCommit(persistID))
+}
+
+// checkConfirmedCommit verifies the server advertises the :confirmed-commit
+// capability, persist tokens are only defined by version 1.1.
+func (s *Session) checkConfirmedCommit(persist bool) error {
+	if hasCapability(s.serverCapabilities, capConfirmedCommit11) {
+		return nil
+	}
+	if persist {
+		return fmt.Errorf("persist requires the :confirmed-commit:1.1 capability")
+	}
+	if !hasCapability(s.serverCapabilities, capConfirmedCommit10) {
+		return fmt.Errorf("server does not support the :confirmed-commit capability")
+	}
+	return nil
+}
+
+// GetSchema retrieves a schema, typically a YANG module, from the server and
+// returns its text without the surrounding XML. See MethodGetSchema for the
+// arguments.
+func (s *Session) GetSchema(ctx context.Context, identifier, version, format string) (string, error) {
+	if identifier == "" {
+		return "", fmt.Errorf("get-schema requires an identifier")
+	}
+	if !hasCapability(s.serverCapabilities, monitoringNS) {
+		return "", fmt.Errorf("get-schema requires the ietf-netconf-monitoring capability")
+	}
+
+	reply, err := s.ExecContext(ctx, MethodGetSchema(identifier, version, format))
+	if err != nil {
+		return "", err
+	}
+	return reply.SchemaText()
+}
+
+// GetConfigString retrieves the source datastore and returns its content as
+// indented XML, see RPCReply.DataString.
+func (s *Session) GetConfigString(ctx context.Context, source Datastore) (string, error) {
+	if err := s.checkSource(source); err != nil {
+		return "", err
+	}
+	reply, err := s.ExecContext(ctx, MethodGetConfig(source))
+	if err != nil {
+		return "", err
+	}
+	return reply.DataString()
+}
+
+// Get retrieves the running configuration and state data selected by the
+// filter. See MethodGet for the arguments, filterType must be subtree or xpath,
+// the latter requiring the :xpath capability. An empty subtree filter retrieves
+// everything.
+func (s *Session) Get(ctx context.Context, filterType, filter string) (*RPCReply, error) {
+	if err := validateFilter(filterType, filter); err != nil {
+		return nil, err
+	}
+	if filterType == "xpath" && !hasCapability(s.serverCapabilities, capXPath) {
+		return nil, fmt.Errorf("xpath filter requires the :xpath capability")
+	}
+	return s.ExecContext(ctx, MethodGet(filterType, filter))
+}
+
+// GetConfigFiltered retrieves the part of the source datastore selected by the
+// filter. XPath filters require the :xpath capability and a non-empty
+// expression.
+func (s *Session) GetConfigFiltered(ctx context.Context, source Datastore, filterType, expr string) (*RPCReply, error) {
+	if err := s.checkSource(source); err != nil {
+		return nil, err
+	}
+	if err := validateFilter(filterType, expr); err != nil {
+		return nil, err
+	}
+	if filterType == "xpath" && !hasCapability(s.serverCapabilities, capXPath) {
+		return nil, fmt.Errorf("xpath filter requires the :xpath capability")
+	}
+	return s.ExecContext(ctx, MethodGetConfigFiltered(source, filterType, expr))
+}
+
+// GetConfigURL retrieves the configuration stored at location, which must use
+// a scheme of the :url capability of the server.
+func (s *Session) GetConfigURL(ctx context.Context, location string) (*RPCReply, error) {
+	if err := s.checkURLScheme(location); err != nil {
+		return nil, err
+	}
+	return s.ExecContext(ctx, MethodGetConfigURL(location))
+}
+
+// checkSource checks source can be read with get-config: the candidate and
+// startup datastores must be advertised by the server, and the NMDA intended
+// and operational datastores are only available through get-data. Vendor
+// datastores are not checked further.
+func (s *Session) checkSource(source Datastore) error {
+	if source == Intended || source == Operational {
+		return fmt.Errorf("datastore %s can't be read with get-config, use get-data", source)
+	}
+	return s.checkDatastore(source)
+}
+
+// checkDatastore checks ds is known and the server advertises the capability
+// of the candidate and startup datastores when ds is one of them.
+func (s *Session) checkDatastore(ds Datastore) error {
+	if err := s.validateDatastore(ds); err != nil {
+		return err
+	}
+	switch ds {
+	case Candidate:
+		if !hasCapability(s.serverCapabilities, capCandidate) {
+			return fmt.Errorf("server does not support the :candidate capability")
+		}
+	case Startup:
+		if !hasCapability(s.serverCapabilities, capStartup) {
+			return fmt.Errorf("server does not support the :startup capability")
+		}
+	}
+	return nil
+}
+
+// DiscardChanges reverts the candidate configuration to the running
+// configuration, which requires the :candidate capability.
+func (s *Session) DiscardChanges(ctx context.Context) (*RPCReply, error) {
+	if !hasCapability(s.serverCapabilities, capCandidate) {
+		return nil, fmt.Errorf("discard-changes requires the :candidate capability")
+	}
+	return s.ExecContext(ctx, MethodDiscard())
+}
+
+// Lock locks the target datastore, checking beforehand that the server has
+// it: candidate requires the :candidate capability and startup the :startup
+// capability, while the NMDA intended and operational datastores can't be
+// locked. Use MethodLock to skip the checks. A datastore already locked fails
+// with an rpc-error from which errors.As extracts a *LockDeniedError
+// identifying the session holding the lock.
+func (s *Session) Lock(ctx context.Context, target Datastore) (*RPCReply, error) {
+	if err := s.checkLockTarget(target); err != nil {
+		return nil, err
+	}
+	return s.ExecContext(ctx, MethodLock(target))
+}
+
+// Unlock unlocks the target datastore, with the checks of Lock.
+func (s *Session) Unlock(ctx context.Context, target Datastore) (*RPCReply, error) {
+	if err := s.checkLockTarget(target); err != nil {
+		return nil, err
+	}
+	return s.ExecContext(ctx, MethodUnlock(target))
+}
+
+func (s *Session) checkLockTarget(target Datastore) error {
+	if target == Intended || target == Operational {
+		return fmt.Errorf("datastore %s can't be locked", target)
+	}
+	return s.checkDatastore(target)
+}
+
+// withDefaultsModes are the default handling modes defined by RFC 6243
+var withDefaultsModes = []string{"report-all", "trim", "explicit", "report-all-tagged"}
+
+// GetConfigWithDefaults retrieves the source datastore reporting default
+// values according to mode. The mode must be one the server advertises in its
+// :with-defaults capability.
+func (s *Session) GetConfigWithDefaults(ctx context.Context, source Datastore, mode string) (*RPCReply, error) {
+	if err := s.checkSource(source); err != nil {
+		return nil, err
+	}
+	if err := s.checkWithDefaults(mode); err != nil {
+		return nil, err
+	}
+	return s.ExecContext(ctx, MethodGetConfigWithDefaults(source, mode))
+}
+
+// checkWithDefaults verifies mode is valid and supported by the server.
+func (s *Session) checkWithDefaults(mode string) error {
+	if !contains(withDefaultsModes, mode) {
+		return fmt.Errorf("invalid with-defaults mode %q", mode)
+	}
+
+	params, ok := capabilityParams(s.serverCapabilities, capWithDefaults)
+	if !ok {
+		return fmt.Errorf("server does not support the :with-defaults capability")
+	}
+
+	supported := []string{params["basic-mode"]}
+	supported = append(supported, strings.Split(params["also-supported"], ",")...)
+	for _, m := range supported {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("with-defaults mode %q not supported by server", mode)
+}
+
+// supportsNMDA reports whether the server implements the NMDA operations.
+// ietf-netconf-nmda is a YANG 1.1 module, listed in the yang-library rather
+// than in the hello, and RFC 8526 requires NMDA servers to advertise
+// :yang-library:1.1. Servers advertising the module in the hello anyway are
+// accepted as well.
+func (s *Session) supportsNMDA() bool {
+	return hasCapability(s.serverCapabilities, capYangLibrary11) || hasCapability(s.serverCapabilities, nmdaNS)
+}
+
+// GetData retrieves data from a NMDA datastore. See MethodGetData for the
+// arguments.
+func (s *Session) GetData(ctx context.Context, datastore Datastore, filter, withDefaults string) (*RPCReply, error) {
+	return s.GetDataOpts(ctx, datastore, GetDataOptions{Filter: filter, WithDefaults: withDefaults})
+}
+
+// GetDataOpts retrieves data from a NMDA datastore using the given options,
+// see MethodGetDataOpts. WithOrigin requires the operational datastore and a
+// server supporting the origin feature.
+func (s *Session) GetDataOpts(ctx context.Context, datastore Datastore, opts GetDataOptions) (*RPCReply, error) {
+	if !s.supportsNMDA() {
+		return nil, fmt.Errorf("server does not support NMDA (:yang-library:1.1)")
+	}
+	if err := s.validateDatastoreIdentity(datastore); err != nil {
+		return nil, err
+	}
+	if opts.WithDefaults != "" {
+		if err := s.checkWithDefaults(opts.WithDefaults); err != nil {
+			return nil, err
+		}
+	}
+	if opts.WithOrigin {
+		if datastoreIdentity(datastore) != datastoreIdentity(Operational) {
+			return nil, fmt.Errorf("with-origin requires the operational datastore, not %s", datastore)
+		}
+		ok, err := s.supportsOrigin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("checking origin support: %w", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("server does not support the ietf-netconf-nmda origin feature")
+		}
+	}
+	return s.ExecContext(ctx, MethodGetDataOpts(datastore, opts))
+}
+
+// EditData edits a NMDA datastore. See MethodEditData for the arguments.
+func (s *Session) EditData(ctx context.Context, datastore Datastore, config string) (*RPCReply, error) {
+	if !s.supportsNMDA() {
+		return nil, fmt.Errorf("server does not support NMDA (:yang-library:1.1)")
+	}
+	if err := s.validateDatastoreIdentity(datastore); err != nil {
+		return nil, err
+	}
+	return s.ExecContext(ctx, MethodEditData(datastore, config))
+}
+
+// PartialLock locks the parts of the running configuration selected by the
+// XPath expressions and returns the lock-id to release them with
+// PartialUnlock.
+func (s *Session) PartialLock(ctx context.Context, selectXPaths []string) (uint32, error) {
+	if len(selectXPaths) == 0 {
+		return 0, fmt.Errorf("partial-lock requires at least one select expression")
+	}
+	if !hasCapability(s.serverCapabilities, capPartialLock) {
+		return 0, fmt.Errorf("server does not support the :partial-lock capability")
+	}
+
+	reply, err := s.ExecContext(ctx, MethodPartialLock(selectXPaths))
+	if err != nil {
+		return 0, err
+	}
+	return reply.LockID()
+}
+
+// PartialUnlock releases a lock obtained with PartialLock.
+func (s *Session) PartialUnlock(ctx context.Context, lockID uint32) (*RPCReply, error) {
+	return s.ExecContext(ctx, MethodPartialUnlock(lockID))
+}
+
+// EditConfig loads config into the target datastore with the given options.
+// Invalid options are rejected before anything is sent, as is a test-option
+// if the server doesn't advertise the :validate capability.
+func (s *Session) EditConfig(ctx context.Context, target Datastore, config string, opts EditConfigOptions) (*RPCReply, error) {
+	if err := s.validateDatastore(target); err != nil {
+		return nil, err
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.TestOption != "" && !hasCapability(s.serverCapabilities, capValidate10) &&
+		!hasCapability(s.serverCapabilities, capValidate11) {
+		return nil, fmt.Errorf("test-option requires the :validate capability")
+	}
+	return s.ExecContext(ctx, MethodEditConfigOpts(target, config, opts))
+}
+
+// EditConfigURL loads the configuration found at location into the target
+// datastore. The scheme of location must be one of those the server lists in
+// its :url capability.
+func (s *Session) EditConfigURL(ctx context.Context, target Datastore, location string) (*RPCReply, error) {
+	if err := s.validateDatastore(target); err != nil {
+		return nil, err
+	}
+	if err := s.checkURLScheme(location); err != nil {
+		return nil, err
+	}
+	return s.ExecContext(ctx, MethodEditConfigURL(target, location))
+}
+
+// checkURLScheme verifies the server accepts URLs with the scheme of location.
+func (s *Session) checkURLScheme(location string) error {
+	params, ok := capabilityParams(s.serverCapabilities, capURL)
+	if !ok {
+		return fmt.Errorf("server does not support the :url capability")
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %v", location, err)
+	}
+	if u.Scheme == "" {
+		return fmt.Errorf("url %q has no scheme", location)
+	}
+
+	schemes := strings.Split(params["scheme"], ",")
+	for _, scheme := range schemes {
+		if strings.EqualFold(scheme, u.Scheme) {
+			return nil
+		}
+	}
+	return fmt.Errorf("url scheme %q not supported by server (supported: %s)", u.Scheme, strings.Join(schemes, ", "))
+}
+
+// ValidateConfig validates the configuration document config without applying
+// it. Inline configurations require the :validate:1.1 capability.
+func (s *Session) ValidateConfig(ctx context.Context, config string) (*RPCReply, error) {
+	if !hasCapability(s.serverCapabilities, capValidate11) {
+		if hasCapability(s.serverCapabilities, capValidate10) {
+			return nil, fmt.Errorf("server only supports :validate:1.0 which can't validate an inline config, validate a datastore instead")
+		}
+		return nil, fmt.Errorf("server does not support the :validate:1.1 capability")
+	}
+	return s.ExecContext(ctx, MethodValidateConfig(config))
+}
+
+// WithLock locks the target datastore, runs fn and unlocks the datastore
+// whether fn succeeds, fails or panics. An unlock failure is returned along
+// with the error of fn, which errors.Is and errors.As still match.
+//
+// If ctx is done by the time fn returns the unlock is sent regardless, so a
+// pipelined session doesn't keep the lock.
+func (s *Session) WithLock(ctx context.Context, target Datastore, fn func() error) (err error) {
+	if err := s.validateDatastore(target); err != nil {
+		return err
+	}
+	if _, err := s.ExecContext(ctx, MethodLock(target)); err != nil {
+		return fmt.Errorf("lock %s: %w", target, err)
+	}
+
+	defer func() {
+		unlockCtx := ctx
+		if ctx.Err() != nil {
+			unlockCtx = context.Background()
+		}
+
+		_, uerr := s.ExecContext(unlockCtx, MethodUnlock(target))
+		switch {
+		case uerr == nil:
+		case err == nil:
+			err = fmt.Errorf("unlock %s: %w", target, uerr)
+		default:
+			err = fmt.Errorf("%w (unlock %s: %v)", err, target, uerr)
+		}
+	}()
+
+	return fn()
+}
+
+// SafeCommitError is returned by SafeCommit when the change couldn't be
+// confirmed.
+type SafeCommitError struct {
+	// Err is the error of the verification or of the confirming commit
+	Err error
+	// RolledBack reports whether the server acknowledged a cancel-commit
+	// restoring the previous configuration. Otherwise the server rolls back
+	// once the confirm timeout expires, unless the commit was confirmed
+	// despite Err.
+	RolledBack bool
+}
+
+func (e *SafeCommitError) Error() string {
+	if e.RolledBack {
+		return fmt.Sprintf("commit rolled back: %v", e.Err)
+	}
+	return fmt.Sprintf("commit not confirmed, rollback pending confirm timeout: %v", e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *SafeCommitError) Unwrap() error {
+	return e.Err
+}
+
+// Ping checks the device answers requests, e.g. for health checks or in the
+// verify function of SafeCommit. It sends a get-config of running with an
+// empty subtree filter, which selects nothing and changes nothing, and any
+// well-formed reply, even an rpc-error, counts as success. Use ctx to bound
+// the wait for the reply.
+func (s *Session) Ping(ctx context.Context) error {
+	_, err := s.ExecContext(ctx, MethodGetConfigFiltered(Running, "subtree", ""))
+	if err != nil && !isRPCError(err) {
+		return err
+	}
+	return nil
+}
+
+// SafeCommit commits the candidate configuration with a confirmed commit,
+// runs verify, typically checking the device is still reachable over a new
+// connection, and confirms the commit if it succeeds. Otherwise the commit is
+// cancelled when the server supports cancel-commit, or left to be rolled back
+// once timeout expires, and a *SafeCommitError is returned.
+//
+// timeout is rounded up to the second and must leave enough time for verify.
+func (s *Session) SafeCommit(ctx context.Context, timeout time.Duration, verify func() error) error {
+	if timeout <= 0 {
+		return fmt.Errorf("invalid confirm timeout %s", timeout)
+	}
+	seconds := int((timeout + time.Second - 1) / time.Second)
+
+	if _, err := s.CommitConfirmed(ctx, seconds, "", ""); err != nil {
+		return err
+	}
+
+	verr := verify()
+	if verr == nil {
+		if _, err := s.CommitConfirming(ctx, ""); err != nil {
+			return &SafeCommitError{Err: fmt.Errorf("confirming commit: %w", err)}
+		}
+		return nil
+	}
+
+	rolledBack := false
+	if hasCapability(s.serverCapabilities, capConfirmedCommit11) {
+		reply, err := s.CancelCommit(ctx, "")
+		rolledBack = err == nil && reply.Ok
+	}
+	return &SafeCommitError{Err: verr, RolledBack: rolledBack}
+}
+
+// EditResult is the outcome of EditRunning.
+type EditResult struct {
+	// Datastore is the datastore edited, Candidate when the change was
+	// committed or Running when running was edited directly
+	Datastore Datastore
+	// Reply is the reply of the commit, or of the edit-config of running
+	Reply *RPCReply
+}
+
+// EditRunning applies config to the running configuration the safest way the
+// server supports. With the :candidate capability running and candidate are
+// locked, candidate is edited and committed, the changes being discarded on
+// failure. Otherwise running is locked and edited directly, which requires the
+// :writable-running capability. See EditConfig for opts.
+func (s *Session) EditRunning(ctx context.Context, config string, opts EditConfigOptions) (*EditResult, error) {
+	res := &EditResult{Datastore: Running}
+	if hasCapability(s.serverCapabilities, capCandidate) {
+		res.Datastore = Candidate
+	} else if !hasCapability(s.serverCapabilities, capWritableRunning) {
+		return nil, fmt.Errorf("editing running requires the :candidate or :writable-running capability")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	// the commit writes running, which is locked first as in RFC 6241
+	// appendix E.1 so that no other session changes it in between
+	err := s.WithLock(ctx, Running, func() error {
+		if res.Datastore == Running {
+			reply, err := s.EditConfig(ctx, Running, config, opts)
+			res.Reply = reply
+			return err
+		}
+
+		return s.WithLock(ctx, Candidate, func() error {
+			reply, err := s.EditConfig(ctx, Candidate, config, opts)
+			if err == nil {
+				reply, err = s.ExecContext(ctx, MethodCommitStandard())
+			}
+			if err != nil {
+				return s.revertCandidate(ctx, err)
+			}
+			res.Reply = reply
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// revertCandidate discards the changes of candidate after err, returning err
+// along with the discard-changes failure if any.
+func (s *Session) revertCandidate(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		ctx = context.Background()
+	}
+	if _, derr := s.ExecContext(ctx, MethodDiscard()); derr != nil {
+		return fmt.Errorf("%w (discard-changes: %v)", err, derr)
+	}
+	return err
+}
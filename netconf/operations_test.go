@@ -0,0 +1,691 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKillSession(t *testing.T) {
+	tt := []struct {
+		name      string
+		sessionID uint32
+		reply     string
+		errTag    string
+		err       bool
+	}{
+		{
+			name:      "ok",
+			sessionID: 4,
+			reply:     `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>]]>]]>`,
+		},
+		{
+			name:      "zero",
+			sessionID: 0,
+			err:       true,
+		},
+		{
+			name:      "own",
+			sessionID: 1,
+			err:       true,
+		},
+		{
+			name:      "accessDenied",
+			sessionID: 4,
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><rpc-error>
+<error-type>protocol</error-type>
+<error-tag>access-denied</error-tag>
+<error-severity>error</error-severity>
+</rpc-error></rpc-reply>]]>]]>`,
+			errTag: "access-denied",
+			err:    true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.reply)
+			s := &Session{Transport: trans, sessionID: 1}
+
+			_, err := s.KillSession(context.Background(), tc.sessionID)
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.errTag != "" {
+				rpcErr, ok := err.(*RPCError)
+				if !ok {
+					t.Fatalf("expected *RPCError, got %T", err)
+				}
+				if rpcErr.Tag != tc.errTag {
+					t.Errorf("unexpected error-tag (want %s, got %s)", tc.errTag, rpcErr.Tag)
+				}
+			}
+		})
+	}
+}
+
+func TestCopyConfigValidation(t *testing.T) {
+	s := &Session{}
+
+	if _, err := s.CopyConfig(context.Background(), "running", "running"); err == nil {
+		t.Errorf("expected error copying running onto itself")
+	}
+	if _, err := s.CopyConfig(context.Background(), "file:///backup.xml", "running"); err == nil {
+		t.Errorf("expected error for url without :url capability")
+	}
+	if _, err := s.CopyConfig(context.Background(), "startup", "runing"); err == nil || !strings.Contains(err.Error(), "unknown datastore") {
+		t.Errorf("expected unknown datastore error, got %v", err)
+	}
+	if _, err := s.DeleteConfig(context.Background(), "startp"); err == nil || !strings.Contains(err.Error(), "unknown datastore") {
+		t.Errorf("expected unknown datastore error, got %v", err)
+	}
+}
+
+func TestDeleteConfig(t *testing.T) {
+	s := &Session{}
+	if _, err := s.DeleteConfig(context.Background(), "running"); err == nil {
+		t.Errorf("expected error deleting running")
+	}
+	if _, err := s.DeleteConfig(context.Background(), "startup"); err == nil || !strings.Contains(err.Error(), ":startup") {
+		t.Errorf("got %v, expected a :startup capability error", err)
+	}
+
+	trans, _ := newTransportTest(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><rpc-error>
+<error-type>protocol</error-type>
+<error-tag>operation-not-supported</error-tag>
+<error-severity>error</error-severity>
+</rpc-error></rpc-reply>]]>]]>`)
+	s = &Session{Transport: trans, serverCapabilities: []string{capStartup}}
+
+	_, err := s.DeleteConfig(context.Background(), "startup")
+	if rpcErr, ok := err.(*RPCError); !ok || rpcErr.Tag != "operation-not-supported" {
+		t.Errorf("expected operation-not-supported error, got %v", err)
+	}
+}
+
+func TestCommitConfirmedCapability(t *testing.T) {
+	s := &Session{serverCapabilities: []string{capConfirmedCommit10}}
+
+	if err := s.checkConfirmedCommit(false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := s.CommitConfirmed(context.Background(), 60, "tok", ""); err == nil {
+		t.Errorf("expected error for persist without confirmed-commit:1.1")
+	}
+
+	if _, err := s.CancelCommit(context.Background(), ""); err == nil {
+		t.Errorf("expected error for cancel-commit without confirmed-commit:1.1")
+	}
+
+	s.serverCapabilities = nil
+	if _, err := s.CommitConfirming(context.Background(), ""); err == nil {
+		t.Errorf("expected error without confirmed-commit capability")
+	}
+}
+
+func TestGetConfigFilteredValidation(t *testing.T) {
+	s := &Session{serverCapabilities: []string{capXPath}}
+	if _, err := s.GetConfigFiltered(context.Background(), "running", "xpath", " "); err == nil {
+		t.Errorf("expected error for empty xpath expression")
+	}
+
+	s.serverCapabilities = nil
+	if _, err := s.GetConfigFiltered(context.Background(), "running", "xpath", "/top"); err == nil {
+		t.Errorf("expected error for xpath without :xpath capability")
+	}
+
+	if _, err := s.GetConfigFiltered(context.Background(), "running", `subtree"><kill-session/>`, "<top/>"); err == nil {
+		t.Errorf("expected error for unknown filter type")
+	}
+	if _, err := s.Get(context.Background(), "regex", ".*"); err == nil {
+		t.Errorf("expected error for unknown filter type")
+	}
+}
+
+func TestCheckWithDefaults(t *testing.T) {
+	s := &Session{serverCapabilities: []string{
+		"urn:ietf:params:netconf:capability:with-defaults:1.0?basic-mode=explicit&amp;also-supported=report-all,trim",
+	}}
+
+	tt := []struct {
+		mode string
+		ok   bool
+	}{
+		{"explicit", true},
+		{"report-all", true},
+		{"trim", true},
+		{"report-all-tagged", false},
+		{"bogus", false},
+	}
+
+	for _, tc := range tt {
+		if err := s.checkWithDefaults(tc.mode); (err == nil) != tc.ok {
+			t.Errorf("checkWithDefaults(%q): unexpected result %v", tc.mode, err)
+		}
+	}
+
+	s.serverCapabilities = nil
+	if err := s.checkWithDefaults("explicit"); err == nil {
+		t.Errorf("expected error without :with-defaults capability")
+	}
+}
+
+func TestNMDACapability(t *testing.T) {
+	s := &Session{}
+	if _, err := s.GetData(context.Background(), "operational", "", ""); err == nil {
+		t.Errorf("expected error without ietf-netconf-nmda")
+	}
+	if _, err := s.EditData(context.Background(), "running", "<top/>"); err == nil {
+		t.Errorf("expected error without ietf-netconf-nmda")
+	}
+
+	// NMDA servers list ietf-netconf-nmda in the yang-library, not the hello
+	s, trans := newMemorySession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda"/></rpc-reply>`)
+	s.serverCapabilities = []string{capYangLibrary11 + "?revision=2019-01-04&content-id=1"}
+	if _, err := s.GetData(context.Background(), Operational, "", ""); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if ops := sentOperations(trans); len(ops) != 1 || ops[0] != "get-data" {
+		t.Errorf("unexpected requests %v", ops)
+	}
+}
+
+func TestPartialLockValidation(t *testing.T) {
+	s := &Session{serverCapabilities: []string{capPartialLock}}
+	if _, err := s.PartialLock(context.Background(), nil); err == nil {
+		t.Errorf("expected error without select expressions")
+	}
+}
+
+func TestEditConfigValidation(t *testing.T) {
+	s := &Session{}
+
+	tt := []EditConfigOptions{
+		{DefaultOperation: "delete"},
+		{ErrorOption: "ignore"},
+		{TestOption: "test-only"},
+	}
+
+	for _, opts := range tt {
+		if _, err := s.EditConfig(context.Background(), "running", "<top/>", opts); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
+
+func TestCheckURLScheme(t *testing.T) {
+	s := &Session{serverCapabilities: []string{capURL + "?scheme=file,https,sftp"}}
+
+	tt := []struct {
+		location string
+		ok       bool
+	}{
+		{"file:///tmp/cfg.xml", true},
+		{"HTTPS://example.com/cfg.xml", true},
+		{"sftp://user@example.com/cfg.xml", true},
+		{"ftp://example.com/cfg.xml", false},
+		{"cfg.xml", false},
+	}
+
+	for _, tc := range tt {
+		if err := s.checkURLScheme(tc.location); (err == nil) != tc.ok {
+			t.Errorf("checkURLScheme(%q): unexpected result %v", tc.location, err)
+		}
+	}
+
+	s.serverCapabilities = nil
+	if _, err := s.EditConfigURL(context.Background(), "running", "file:///tmp/cfg.xml"); err == nil {
+		t.Errorf("expected error without :url capability")
+	}
+	if _, err := s.GetConfigURL(context.Background(), "file:///tmp/cfg.xml"); err == nil {
+		t.Errorf("expected error without :url capability")
+	}
+}
+
+func TestGetConfigURL(t *testing.T) {
+	s, trans := newMemorySession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data/></rpc-reply>`)
+	s.serverCapabilities = append(s.serverCapabilities, capURL+"?scheme=file")
+
+	if _, err := s.GetConfigURL(context.Background(), "file:///tmp/cfg.xml"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(trans.Sent()[1]), "<get-config><source><url>file:///tmp/cfg.xml</url></source></get-config>") {
+		t.Errorf("unexpected request %s", trans.Sent()[1])
+	}
+}
+
+func TestCheckSource(t *testing.T) {
+	tt := []struct {
+		source Datastore
+		caps   []string
+		ok     bool
+	}{
+		{source: Running, ok: true},
+		{source: Candidate, caps: []string{capCandidate}, ok: true},
+		{source: Candidate},
+		{source: Startup, caps: []string{capStartup}, ok: true},
+		{source: Startup, caps: []string{capCandidate}},
+		{source: Operational},
+		{source: Intended},
+		{source: Datastore("scratch"), ok: true},
+		{source: Datastore("runing")},
+	}
+
+	for _, tc := range tt {
+		s := &Session{serverCapabilities: tc.caps, VendorDatastores: []Datastore{"scratch"}}
+		if err := s.checkSource(tc.source); (err == nil) != tc.ok {
+			t.Errorf("checkSource(%s) with %v: unexpected result %v", tc.source, tc.caps, err)
+		}
+	}
+
+	s := &Session{}
+	if _, err := s.GetConfigFiltered(context.Background(), Candidate, "subtree", "<top/>"); err == nil {
+		t.Errorf("expected error without :candidate capability")
+	}
+}
+
+func TestValidateConfigCapability(t *testing.T) {
+	tt := []struct {
+		name string
+		caps []string
+		err  string
+	}{
+		{"none", nil, "does not support"},
+		{"validate 1.0", []string{capValidate10}, ":validate:1.0"},
+	}
+
+	for _, tc := range tt {
+		s := &Session{serverCapabilities: tc.caps}
+		_, err := s.ValidateConfig(context.Background(), "<top/>")
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+	}
+}
+
+// newMemorySession returns a session over a MemoryTransport receiving a
+// base:1.0 hello followed by replies.
+func newMemorySession(t *testing.T, replies ...string) (*Session, *MemoryTransport) {
+	trans := NewMemoryTransport([]byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities><session-id>1</session-id></hello>`))
+	for _, reply := range replies {
+		trans.Enqueue([]byte(reply))
+	}
+
+	s, err := newSession(trans)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return s, trans
+}
+
+const (
+	testOkReply         = `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`
+	testLockDeniedReply = `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity></rpc-error></rpc-reply>`
+)
+
+// sentOperations returns the operations of the requests sent on trans.
+func sentOperations(trans *MemoryTransport) []string {
+	var ops []string
+	for _, msg := range trans.Sent()[1:] {
+		m := regexp.MustCompile(`<rpc [^>]*><([a-z-]+)`).FindSubmatch(msg)
+		if m != nil {
+			ops = append(ops, string(m[1]))
+		}
+	}
+	return ops
+}
+
+func TestWithLock(t *testing.T) {
+	fnErr := errors.New("edit failed")
+
+	tt := []struct {
+		name    string
+		replies []string
+		fn      func() error
+		check   func(error) bool
+		ops     []string
+	}{
+		{
+			name:    "ok",
+			replies: []string{testOkReply, testOkReply},
+			fn:      func() error { return nil },
+			check:   func(err error) bool { return err == nil },
+			ops:     []string{"lock", "unlock"},
+		},
+		{
+			name:    "fn error",
+			replies: []string{testOkReply, testOkReply},
+			fn:      func() error { return fnErr },
+			check:   func(err error) bool { return err == fnErr },
+			ops:     []string{"lock", "unlock"},
+		},
+		{
+			name:    "lock denied",
+			replies: []string{testLockDeniedReply},
+			fn:      func() error { t.Errorf("fn called without lock"); return nil },
+			check: func(err error) bool {
+				var rpcErr *RPCError
+				return errors.As(err, &rpcErr) && rpcErr.Tag == "lock-denied"
+			},
+			ops: []string{"lock"},
+		},
+		{
+			name:    "fn and unlock error",
+			replies: []string{testOkReply},
+			fn:      func() error { return fnErr },
+			check: func(err error) bool {
+				return errors.Is(err, fnErr) && strings.Contains(err.Error(), "unlock candidate")
+			},
+			ops: []string{"lock", "unlock"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, trans := newMemorySession(t, tc.replies...)
+			if err := s.WithLock(context.Background(), "candidate", tc.fn); !tc.check(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.ops, sentOperations(trans)); diff != "" {
+				t.Errorf("unexpected operations (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWithLockPanic(t *testing.T) {
+	s, trans := newMemorySession(t, testOkReply, testOkReply)
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("unexpected panic %v", r)
+		}
+		if diff := cmp.Diff([]string{"lock", "unlock"}, sentOperations(trans)); diff != "" {
+			t.Errorf("unexpected operations (-want +got):\n%s", diff)
+		}
+	}()
+
+	s.WithLock(context.Background(), "candidate", func() error { panic("boom") })
+}
+
+func TestSafeCommit(t *testing.T) {
+	verifyErr := errors.New("device unreachable")
+
+	tt := []struct {
+		name       string
+		cap        string
+		replies    []string
+		verify     error
+		rolledBack bool
+		ops        []string
+	}{
+		{
+			name:    "confirmed",
+			cap:     capConfirmedCommit10,
+			replies: []string{testOkReply, testOkReply},
+			ops:     []string{"commit", "commit"},
+		},
+		{
+			name:       "cancelled",
+			cap:        capConfirmedCommit11,
+			replies:    []string{testOkReply, testOkReply},
+			verify:     verifyErr,
+			rolledBack: true,
+			ops:        []string{"commit", "cancel-commit"},
+		},
+		{
+			name:    "timeout rollback",
+			cap:     capConfirmedCommit10,
+			replies: []string{testOkReply},
+			verify:  verifyErr,
+			ops:     []string{"commit"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, trans := newMemorySession(t, tc.replies...)
+			s.serverCapabilities = append(s.serverCapabilities, tc.cap)
+
+			err := s.SafeCommit(context.Background(), 1500*time.Millisecond, func() error { return tc.verify })
+			if tc.verify == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else {
+				var safeErr *SafeCommitError
+				if !errors.As(err, &safeErr) || !errors.Is(err, verifyErr) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if safeErr.RolledBack != tc.rolledBack {
+					t.Errorf("got rolled back %v, expected %v", safeErr.RolledBack, tc.rolledBack)
+				}
+			}
+
+			if diff := cmp.Diff(tc.ops, sentOperations(trans)); diff != "" {
+				t.Errorf("unexpected operations (-want +got):\n%s", diff)
+			}
+			if !strings.Contains(string(trans.Sent()[1]), "<confirm-timeout>2</confirm-timeout>") {
+				t.Errorf("unexpected confirmed commit %s", trans.Sent()[1])
+			}
+		})
+	}
+}
+
+func TestGetConfigString(t *testing.T) {
+	s, trans := newMemorySession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><top xmlns="urn:top"><a>1</a></top></data></rpc-reply>`)
+
+	got, err := s.GetConfigString(context.Background(), "running")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "<top xmlns=\"urn:top\">\n  <a>1</a>\n</top>\n"
+	if got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+	if diff := cmp.Diff([]string{"get-config"}, sentOperations(trans)); diff != "" {
+		t.Errorf("unexpected operations (-want +got):\n%s", diff)
+	}
+}
+
+func TestEditRunning(t *testing.T) {
+	tt := []struct {
+		name      string
+		caps      []string
+		replies   []string
+		datastore Datastore
+		err       bool
+		ops       []string
+		locked    []string
+	}{
+		{
+			name:      "candidate",
+			caps:      []string{capCandidate, capWritableRunning},
+			replies:   []string{testOkReply, testOkReply, testOkReply, testOkReply, testOkReply, testOkReply},
+			datastore: Candidate,
+			ops:       []string{"lock", "lock", "edit-config", "commit", "unlock", "unlock"},
+			locked:    []string{"running", "candidate"},
+		},
+		{
+			name:      "writable running",
+			caps:      []string{capWritableRunning},
+			replies:   []string{testOkReply, testOkReply, testOkReply},
+			datastore: Running,
+			ops:       []string{"lock", "edit-config", "unlock"},
+			locked:    []string{"running"},
+		},
+		{
+			name:    "running locked",
+			caps:    []string{capCandidate},
+			replies: []string{testLockDeniedReply},
+			err:     true,
+			ops:     []string{"lock"},
+			locked:  []string{"running"},
+		},
+		{
+			name:    "edit failure",
+			caps:    []string{capCandidate},
+			replies: []string{testOkReply, testOkReply, testLockDeniedReply, testOkReply, testOkReply, testOkReply},
+			err:     true,
+			ops:     []string{"lock", "lock", "edit-config", "discard-changes", "unlock", "unlock"},
+			locked:  []string{"running", "candidate"},
+		},
+		{
+			name:    "commit failure",
+			caps:    []string{capCandidate},
+			replies: []string{testOkReply, testOkReply, testOkReply, testLockDeniedReply, testOkReply, testOkReply, testOkReply},
+			err:     true,
+			ops:     []string{"lock", "lock", "edit-config", "commit", "discard-changes", "unlock", "unlock"},
+			locked:  []string{"running", "candidate"},
+		},
+		{
+			name:    "running failure",
+			caps:    []string{capWritableRunning},
+			replies: []string{testOkReply, testLockDeniedReply, testOkReply},
+			err:     true,
+			ops:     []string{"lock", "edit-config", "unlock"},
+			locked:  []string{"running"},
+		},
+		{
+			name: "read-only",
+			err:  true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, trans := newMemorySession(t, tc.replies...)
+			s.serverCapabilities = append(s.serverCapabilities, tc.caps...)
+
+			res, err := s.EditRunning(context.Background(), "<top/>", EditConfigOptions{})
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if res.Datastore != tc.datastore || !res.Reply.Ok {
+				t.Errorf("got datastore %s, expected %s", res.Datastore, tc.datastore)
+			}
+
+			if diff := cmp.Diff(tc.ops, sentOperations(trans)); diff != "" {
+				t.Errorf("unexpected operations (-want +got):\n%s", diff)
+			}
+
+			var locked []string
+			for _, msg := range trans.Sent()[1:] {
+				if m := regexp.MustCompile(`<lock><target><([a-z-]+)/>`).FindSubmatch(msg); m != nil {
+					locked = append(locked, string(m[1]))
+				}
+			}
+			if diff := cmp.Diff(tc.locked, locked); diff != "" {
+				t.Errorf("unexpected locks (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLock(t *testing.T) {
+	tt := []struct {
+		target Datastore
+		caps   []string
+		ok     bool
+	}{
+		{target: Running, ok: true},
+		{target: Candidate, caps: []string{capCandidate}, ok: true},
+		{target: Candidate},
+		{target: Startup, caps: []string{capStartup}, ok: true},
+		{target: Startup, caps: []string{capCandidate}},
+		{target: Intended, caps: []string{capCandidate, capStartup}},
+		{target: Operational},
+		{target: Datastore("vendor"), ok: true},
+		{target: Datastore("runing")},
+	}
+
+	for _, tc := range tt {
+		s, trans := newMemorySession(t, testOkReply, testOkReply)
+		s.serverCapabilities = append(s.serverCapabilities, tc.caps...)
+		s.VendorDatastores = []Datastore{"vendor"}
+
+		_, lerr := s.Lock(context.Background(), tc.target)
+		_, uerr := s.Unlock(context.Background(), tc.target)
+		if (lerr == nil) != tc.ok || (uerr == nil) != tc.ok {
+			t.Errorf("%s with %v: unexpected result %v, %v", tc.target, tc.caps, lerr, uerr)
+		}
+
+		var expected []string
+		if tc.ok {
+			expected = []string{"lock", "unlock"}
+		}
+		if diff := cmp.Diff(expected, sentOperations(trans)); diff != "" {
+			t.Errorf("%s: unexpected operations (-want +got):\n%s", tc.target, diff)
+		}
+	}
+}
+
+func TestDiscardChanges(t *testing.T) {
+	s, _ := newMemorySession(t)
+	if _, err := s.DiscardChanges(context.Background()); err == nil {
+		t.Errorf("expected error without :candidate capability")
+	}
+
+	replies := []string{
+		testOkReply,
+		`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <ok/>
+</rpc-reply>`,
+		`<nc:rpc-reply xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0"><nc:ok/></nc:rpc-reply>`,
+	}
+	for _, r := range replies {
+		s, trans := newMemorySession(t, r)
+		s.serverCapabilities = append(s.serverCapabilities, capCandidate)
+
+		reply, err := s.DiscardChanges(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reply.Ok {
+			t.Errorf("expected ok reply for %s", r)
+		}
+		if diff := cmp.Diff([]string{"discard-changes"}, sentOperations(trans)); diff != "" {
+			t.Errorf("unexpected operations (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies []string
+		ok      bool
+	}{
+		{"data", []string{`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data/></rpc-reply>`}, true},
+		{"rpc-error", []string{testRPCErrorReply("invalid-value")}, true},
+		{"not a reply", []string{`<data xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"/>`}, false},
+		{"no reply", nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, trans := newMemorySession(t, tc.replies...)
+
+			if err := s.Ping(context.Background()); (err == nil) != tc.ok {
+				t.Fatalf("unexpected result %v", err)
+			}
+			if diff := cmp.Diff([]string{"get-config"}, sentOperations(trans)); diff != "" {
+				t.Errorf("unexpected operations (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// originNS is the ietf-origin (RFC 8342) namespace of the origin annotations
+const originNS = "urn:ietf:params:xml:ns:yang:ietf-origin"
+
+// supportsOrigin reports whether the server can annotate the operational
+// datastore with origins, i.e. it supports the origin feature of
+// ietf-netconf-nmda. As a YANG 1.1 module its features are listed in the
+// yang-library, which is retrieved unless the hello already advertises
+// ietf-origin or the feature.
+func (s *Session) supportsOrigin(ctx context.Context) (bool, error) {
+	if hasCapability(s.serverCapabilities, originNS) {
+		return true, nil
+	}
+	if params, ok := capabilityParams(s.serverCapabilities, nmdaNS); ok && contains(strings.Split(params["features"], ","), "origin") {
+		return true, nil
+	}
+	if !hasCapability(s.serverCapabilities, capYangLibrary11) {
+		return false, nil
+	}
+
+	lib, err := s.YangLibrary(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range lib.Modules {
+		if m.Name == "ietf-netconf-nmda" && !m.ImportOnly && contains(m.Features, "origin") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Origins returns the origin of every element of the data of a get-data
+// reply requested with GetDataOptions.WithOrigin, such as "intended",
+// "system" or "learned", keyed by element path. Elements without origin
+// annotation inherit the one of their parent, those with none at all are left
+// out. The paths are formed as by DiffConfig, e.g.
+// /interfaces/interface[name='eth0']/mtu.
+func (r *RPCReply) Origins() map[string]string {
+	origins := make(map[string]string)
+	if data := r.DataElement(); data != nil {
+		collectOrigins(origins, "", "", data)
+	}
+	return origins
+}
+
+// collectOrigins adds the origins of the children of parent, found at path
+// with origin, to origins.
+func collectOrigins(origins map[string]string, path, origin string, parent *etree.Element) {
+	children := parent.ChildElements()
+
+	seen := make(map[string]bool)
+	multi := make(map[string]bool)
+	for _, el := range children {
+		multi[el.Tag] = multi[el.Tag] || seen[el.Tag]
+		seen[el.Tag] = true
+	}
+
+	for _, el := range children {
+		elPath := path + "/" + diffSegment(el, multi[el.Tag])
+		elOrigin := origin
+		for _, attr := range el.Attr {
+			if attr.Key == "origin" && attr.Space != "" && prefixNamespace(el, attr.Space) == originNS {
+				elOrigin = attr.Value
+				if i := strings.Index(elOrigin, ":"); i >= 0 {
+					elOrigin = elOrigin[i+1:]
+				}
+			}
+		}
+		if elOrigin != "" {
+			origins[elPath] = elOrigin
+		}
+		collectOrigins(origins, elPath, elOrigin, el)
+	}
+}
+
+// prefixNamespace returns the namespace bound to prefix in the scope of el,
+// empty if there is none.
+func prefixNamespace(el *etree.Element, prefix string) string {
+	for ; el != nil; el = el.Parent() {
+		for _, attr := range el.Attr {
+			if attr.Space == "xmlns" && attr.Key == prefix {
+				return attr.Value
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRPCReplyOrigins(t *testing.T) {
+	rawXML := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda" xmlns:or="urn:ietf:params:xml:ns:yang:ietf-origin">
+<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces" or:origin="or:intended">
+<interface>
+<name>eth0</name>
+<mtu or:origin="or:system">1500</mtu>
+</interface>
+<interface or:origin="or:learned">
+<name>eth1</name>
+</interface>
+</interfaces>
+<system><hostname>r1</hostname></system>
+</data>
+</rpc-reply>`
+
+	reply, err := newRPCReply([]byte(rawXML), false, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"/interfaces":                             "intended",
+		"/interfaces/interface[name='eth0']":      "intended",
+		"/interfaces/interface[name='eth0']/name": "intended",
+		"/interfaces/interface[name='eth0']/mtu":  "system",
+		"/interfaces/interface[name='eth1']":      "learned",
+		"/interfaces/interface[name='eth1']/name": "learned",
+	}
+	if got := reply.Origins(); !cmp.Equal(got, expected) {
+		t.Errorf("unexpected origins (-want +got):\n%s", cmp.Diff(expected, got))
+	}
+}
+
+func TestGetDataWithOrigin(t *testing.T) {
+	const nmdaOrigin = "urn:ietf:params:xml:ns:yang:ietf-netconf-nmda?module=ietf-netconf-nmda&features=origin,with-defaults"
+
+	const libraryReply = `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><yang-library xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-library"><module-set><name>complete</name><module><name>ietf-netconf-nmda</name><revision>2019-01-07</revision><namespace>urn:ietf:params:xml:ns:yang:ietf-netconf-nmda</namespace>%s</module></module-set><content-id>1</content-id></yang-library></data></rpc-reply>`
+	const dataReply = `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda"/></rpc-reply>`
+
+	tests := []struct {
+		name      string
+		caps      []string
+		library   string
+		datastore Datastore
+		ops       []string
+	}{
+		{"origin feature", []string{nmdaOrigin}, "", Operational, []string{"get-data"}},
+		{"ietf-origin", []string{nmdaNS, originNS}, "", Operational, []string{"get-data"}},
+		{"no origin feature", []string{nmdaNS}, "", Operational, nil},
+		{"not operational", []string{nmdaOrigin}, "", Running, nil},
+		{"yang-library origin feature", []string{capYangLibrary11}, fmt.Sprintf(libraryReply, "<feature>origin</feature>"), Operational, []string{"get", "get-data"}},
+		{"yang-library no origin feature", []string{capYangLibrary11}, fmt.Sprintf(libraryReply, ""), Operational, []string{"get"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var replies []string
+			if tc.library != "" {
+				replies = append(replies, tc.library)
+			}
+			s, trans := newMemorySession(t, append(replies, dataReply)...)
+			s.serverCapabilities = tc.caps
+
+			_, err := s.GetDataOpts(context.Background(), tc.datastore, GetDataOptions{WithOrigin: true})
+			ok := len(tc.ops) > 0 && tc.ops[len(tc.ops)-1] == "get-data"
+			if (err == nil) != ok {
+				t.Fatalf("unexpected result %v", err)
+			}
+			if diff := cmp.Diff(tc.ops, sentOperations(trans)); diff != "" {
+				t.Errorf("unexpected requests (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
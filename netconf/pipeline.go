@@ -0,0 +1,541 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// notificationBuffer is the number of notifications buffered before the
+// reader blocks
+const notificationBuffer = 64
+
+// pipeline correlates replies read by a single reader goroutine with the
+// requests in flight.
+type pipeline struct {
+	// wmu serializes the requests written, so they are sent in the order of
+	// p.order. It is taken before mu but never held with it while sending,
+	// the reader goroutine needs mu to drain the replies meanwhile.
+	wmu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan *RPCReply
+	// message-ids in the order the requests were sent
+	order []string
+	err   error
+
+	// sub receives the notifications without subscription id, subs those of
+	// the dynamic subscriptions by id
+	sub  *Subscription
+	subs map[uint32]*Subscription
+	// replyHooks are called by message-id with the reply to the request,
+	// before it is dispatched, to update the subscriptions as the reader
+	// goroutine receives the reply rather than after it handled more messages
+	replyHooks map[string]func(*RPCReply)
+}
+
+// ExecAsync sends the message without waiting for the reply and returns a
+// channel receiving it, allowing several requests to be in flight at once.
+//
+// The first call switches the session to pipelined mode: a single goroutine
+// reads all incoming messages and dispatches the replies by message-id. Exec
+// and ExecContext go through it as well, which makes them safe for concurrent
+// use, and a cancelled ExecContext only abandons its request instead of
+// closing the transport.
+//
+// Requests are written in the order of the calls and NETCONF servers process
+// them in that order, so replies without message-id, as sent for rejected
+// requests, are dispatched to the oldest request in flight.
+//
+// If the transport fails all the channels of the requests in flight are closed
+// without a reply and the error is returned by any following call.
+func (s *Session) ExecAsync(m *RPCMessage) (<-chan *RPCReply, error) {
+	if s.isClosed() {
+		return nil, ErrSessionClosed
+	}
+
+	request, err := s.marshalRequest(m)
+	if err != nil {
+		return nil, err
+	}
+
+	p := s.startPipeline()
+	ch := make(chan *RPCReply, 1)
+
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+
+	if err := p.register(s, m, ch); err != nil {
+		return nil, err
+	}
+	// The request is registered before being sent as the reply may be read
+	// before send returns.
+	if err := s.send(request); err != nil {
+		p.unregister(m.MessageID)
+		return nil, err
+	}
+	return ch, nil
+}
+
+// register adds the request m, whose reply is delivered to ch, to the
+// requests in flight.
+func (p *pipeline) register(s *Session, m *RPCMessage, ch chan *RPCReply) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		if s.isIdle() {
+			return ErrSessionIdle
+		}
+		return p.err
+	}
+	if p.sub != nil && p.sub.opts == nil && p.sub.messageID != m.MessageID && !s.CanInterleave() {
+		return ErrNoInterleave
+	}
+	if _, ok := p.pending[m.MessageID]; ok {
+		return fmt.Errorf("message-id %s already in flight", m.MessageID)
+	}
+	p.pending[m.MessageID] = ch
+	p.order = append(p.order, m.MessageID)
+	return nil
+}
+
+// unregister removes the request messageID from the requests in flight.
+func (p *pipeline) unregister(messageID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.pending, messageID)
+	for i, id := range p.order {
+		if id == messageID {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// execPipelined executes m through the pipeline and waits for its reply or
+// for ctx to be done. A request abandoned because of ctx leaves the session
+// usable, its reply is discarded when it arrives.
+func (s *Session) execPipelined(ctx context.Context, p *pipeline, m *RPCMessage) (*RPCReply, error) {
+	ch, err := s.ExecAsync(m)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply, ok := <-ch:
+		if !ok {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			return nil, p.err
+		}
+		return reply, replyError(reply.Errors, s.ErrOnWarning)
+	case <-ctx.Done():
+		p.mu.Lock()
+		delete(p.pending, m.MessageID)
+		p.mu.Unlock()
+		return nil, fmt.Errorf("rpc %s aborted: %w", m.MessageID, ctx.Err())
+	}
+}
+
+// BatchOptions controls how Session.ExecBatch handles failed requests.
+type BatchOptions struct {
+	// ContinueOnError sends all the requests at once, without waiting for the
+	// replies, and carries on after requests failing with rpc-error. Otherwise
+	// a request is sent once the previous one succeeded and the batch stops
+	// at the first failure, as the server would execute the following ones
+	// regardless.
+	ContinueOnError bool
+}
+
+// ExecBatch executes each method as a separate request and returns the replies
+// aligned with methods, nil for the requests not sent or without a reply. The
+// error is the one of the first failed request. Requests sent at once go
+// through the pipeline, see ExecAsync.
+//
+// Unlike Exec with several methods, which sends them in a single rpc element
+// most servers reject, each method gets its own rpc and reply.
+func (s *Session) ExecBatch(ctx context.Context, methods []RPCMethod, opts BatchOptions) ([]*RPCReply, error) {
+	replies := make([]*RPCReply, len(methods))
+
+	if !opts.ContinueOnError {
+		for i, method := range methods {
+			reply, err := s.ExecContext(ctx, method)
+			replies[i] = reply
+			if err != nil {
+				return replies, batchError(i, method, err)
+			}
+		}
+		return replies, nil
+	}
+
+	messages := make([]*RPCMessage, len(methods))
+	chans := make([]<-chan *RPCReply, len(methods))
+	starts := make([]time.Time, len(methods))
+	for i, method := range methods {
+		if err := ctx.Err(); err != nil {
+			return replies, err
+		}
+		messages[i] = s.newRPCMessage([]RPCMethod{method})
+		starts[i] = time.Now()
+		ch, err := s.ExecAsync(messages[i])
+		if err != nil {
+			return replies, batchError(i, method, err)
+		}
+		chans[i] = ch
+	}
+
+	var firstErr error
+	for i, ch := range chans {
+		var err error
+		select {
+		case reply, ok := <-ch:
+			if !ok {
+				p := s.activePipeline()
+				p.mu.Lock()
+				err = p.err
+				p.mu.Unlock()
+				s.observeRPC(messages[i], starts[i], &err)
+				return replies, batchError(i, methods[i], err)
+			}
+			replies[i] = reply
+			err = replyError(reply.Errors, s.ErrOnWarning)
+		case <-ctx.Done():
+			return replies, fmt.Errorf("batch aborted: %w", ctx.Err())
+		}
+
+		s.observeRPC(messages[i], starts[i], &err)
+		if err != nil && firstErr == nil {
+			firstErr = batchError(i, methods[i], err)
+		}
+	}
+	return replies, firstErr
+}
+
+// batchError wraps the error of the request i of a batch.
+func batchError(i int, method RPCMethod, err error) error {
+	return fmt.Errorf("batch request %d (%s): %w", i, methodName(method), err)
+}
+
+// activePipeline returns the pipeline of the session or nil if the session
+// is not in pipelined mode.
+func (s *Session) activePipeline() *pipeline {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pipeline
+}
+
+func (s *Session) startPipeline() *pipeline {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pipeline == nil {
+		s.pipeline = &pipeline{pending: make(map[string]chan *RPCReply)}
+		go s.readLoop(s.pipeline)
+	}
+	return s.pipeline
+}
+
+func (s *Session) readLoop(p *pipeline) {
+	for {
+		rawXML, err := s.receive()
+		if err != nil {
+			p.fail(err)
+			return
+		}
+
+		if rootName(rawXML) == "notification" {
+			s.idleActivity()
+			// A malformed notification doesn't affect the framing, so it is
+			// dropped rather than failing the session.
+			if n, err := parseNotification(rawXML); err == nil {
+				p.notify(n)
+				s.observeNotification(n)
+			}
+			continue
+		}
+
+		s.idleEnd()
+		reply, err := newRPCReply(rawXML, s.ErrOnWarning, "")
+		if reply == nil {
+			p.fail(err)
+			return
+		}
+		s.handleWarnings(reply)
+		p.dispatch(reply)
+	}
+}
+
+// rootName returns the local name of the root element of a message.
+func rootName(rawXML []byte) string {
+	d := xml.NewDecoder(bytes.NewReader(rawXML))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// subscribe registers the subscription receiving notifications, a session
+// has at most one subscription.
+func (p *pipeline) subscribe(sub *Subscription) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	if p.sub != nil {
+		return fmt.Errorf("session already has a subscription")
+	}
+	p.start(sub)
+	p.sub = sub
+	return nil
+}
+
+// establish registers the dynamic subscription sub, established by the
+// request messageID. Subscriptions to a stream receive the notifications
+// without subscription id, a session has at most one of them besides RFC 5277
+// subscriptions.
+func (p *pipeline) establish(sub *Subscription, messageID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	if sub.opts.Stream != "" {
+		if p.sub != nil {
+			return fmt.Errorf("session already has a subscription to a stream")
+		}
+		p.sub = sub
+	}
+	p.start(sub)
+	p.addReplyHook(messageID, func(reply *RPCReply) {
+		if !sub.ended() {
+			p.established(sub, reply)
+		}
+	})
+	return nil
+}
+
+// addReplyHook registers hook to be called with the reply to the request
+// messageID. p.mu must be held.
+func (p *pipeline) addReplyHook(messageID string, hook func(*RPCReply)) {
+	if p.replyHooks == nil {
+		p.replyHooks = make(map[string]func(*RPCReply))
+	}
+	p.replyHooks[messageID] = hook
+}
+
+// established registers sub by the subscription id of reply, the reply to its
+// establish-subscription request. p.mu must be held.
+func (p *pipeline) established(sub *Subscription, reply *RPCReply) {
+	if replyError(reply.Errors, false) != nil {
+		return
+	}
+	id, ok := parseSubscriptionID(reply.Data.Root().SelectElement("id"))
+	if !ok {
+		return
+	}
+	if p.subs == nil {
+		p.subs = make(map[uint32]*Subscription)
+	}
+	sub.ID = id
+	sub.established = true
+	p.subs[id] = sub
+}
+
+// start prepares the delivery of the notifications of sub. p.mu must be held.
+func (p *pipeline) start(sub *Subscription) {
+	sub.p = p
+	sub.ch = make(chan *Notification, notificationBuffer)
+	sub.done = make(chan struct{})
+}
+
+// watchStopTime ends sub shortly after its stop time in case the server
+// doesn't report it complete.
+func (p *pipeline) watchStopTime(sub *Subscription) {
+	if sub.StopTime.IsZero() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if sub.ended() {
+		return
+	}
+	sub.timer = time.AfterFunc(time.Until(sub.StopTime)+subscriptionStopGrace, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		var err error
+		if !sub.StartTime.IsZero() && !sub.replayed {
+			err = ErrReplayIncomplete
+		}
+		p.endSubscription(sub, err)
+	})
+}
+
+// endSubscription closes the channel of sub, or has the reader goroutine
+// close it if it is sending on it, and records err as the reason. p.mu must
+// be held.
+func (p *pipeline) endSubscription(sub *Subscription, err error) {
+	if sub.done == nil || sub.ended() {
+		return
+	}
+	if p.sub == sub {
+		p.sub = nil
+	}
+	if sub.established && p.subs[sub.ID] == sub {
+		delete(p.subs, sub.ID)
+	}
+	sub.err = err
+
+	if sub.timer != nil {
+		sub.timer.Stop()
+	}
+	close(sub.done)
+	if !sub.sending {
+		close(sub.ch)
+	}
+}
+
+// notify hands n to its subscription, the dynamic subscription of its
+// subscription id if any, ending it once the server reports it complete. The
+// control messages ending subscriptions, as well as the replayComplete of RFC
+// 5277, are not delivered.
+func (p *pipeline) notify(n *Notification) {
+	p.mu.Lock()
+	root := n.Data.Root()
+	sub := p.sub
+	if id, ok := subscriptionID(root); ok {
+		sub = p.subs[id]
+	}
+	if sub == nil {
+		// no subscription to deliver to
+		p.mu.Unlock()
+		return
+	}
+	n.Stream = sub.stream()
+
+	if p.control(sub, root) {
+		p.mu.Unlock()
+		return
+	}
+	sub.sending = true
+	p.mu.Unlock()
+
+	select {
+	case sub.ch <- n:
+	case <-sub.done:
+	}
+
+	p.mu.Lock()
+	sub.sending = false
+	if sub.ended() {
+		// ended while sending
+		close(sub.ch)
+	}
+	p.mu.Unlock()
+}
+
+// control handles the control messages of sub, reporting whether root, the
+// content of a notification, is one. p.mu must be held.
+func (p *pipeline) control(sub *Subscription, root *etree.Element) bool {
+	if sub.opts != nil {
+		end, err := subscriptionEnd(root)
+		if end {
+			p.endSubscription(sub, err)
+		}
+		return end
+	}
+
+	if root == nil {
+		return false
+	}
+	switch root.Tag {
+	case "replayComplete":
+		sub.replayed = true
+		// a stop time in the past ends the subscription with the replay
+		if !sub.StopTime.IsZero() && !time.Now().Before(sub.StopTime) {
+			p.endSubscription(sub, nil)
+		}
+		return true
+	case "notificationComplete":
+		p.endSubscription(sub, nil)
+		return true
+	}
+	return false
+}
+
+// dispatch hands reply to the request it answers.
+func (p *pipeline) dispatch(reply *RPCReply) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := reply.replyMessageID
+	if id == "" && len(p.order) > 0 {
+		id = p.order[0]
+	}
+
+	for i, sentID := range p.order {
+		if sentID == id {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+
+	if hook, ok := p.replyHooks[id]; ok {
+		delete(p.replyHooks, id)
+		hook(reply)
+	}
+
+	ch, ok := p.pending[id]
+	if !ok {
+		// nobody is waiting for this reply anymore
+		return
+	}
+	delete(p.pending, id)
+
+	reply.MessageID = id
+	ch <- reply
+	close(ch)
+}
+
+// fail closes all the pending requests and makes err the result of any
+// following request.
+func (p *pipeline) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.err = err
+	for id, ch := range p.pending {
+		close(ch)
+		delete(p.pending, id)
+	}
+	if p.sub != nil {
+		p.endSubscription(p.sub, err)
+	}
+	for _, sub := range p.subs {
+		p.endSubscription(sub, err)
+	}
+	p.replyHooks = nil
+	p.order = nil
+}
@@ -0,0 +1,285 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var messageIDRE = regexp.MustCompile(`message-id="([^"]+)"`)
+
+// newServerTest returns a session connected to a fake server running serve
+// with the server side of the transport. The stream is closed once serve
+// returns.
+func newServerTest(serve func(server *transportTest)) *Session {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	var client, server transportTest
+	client.ReadWriteCloser = &pipeCloser{clientR, clientW}
+	server.ReadWriteCloser = &pipeCloser{serverR, serverW}
+
+	go func() {
+		serve(&server)
+		serverR.Close()
+		serverW.Close()
+	}()
+
+	return &Session{Transport: &client}
+}
+
+// newPipelineTest returns a session connected to a fake server which waits
+// for n requests and answers them in reverse order.
+func newPipelineTest(t *testing.T, n int) *Session {
+	return newServerTest(func(server *transportTest) {
+		var ids []string
+		for i := 0; i < n; i++ {
+			req, err := server.Receive()
+			if err != nil {
+				return
+			}
+			ids = append(ids, string(messageIDRE.FindSubmatch(req)[1]))
+		}
+		for i := len(ids) - 1; i >= 0; i-- {
+			server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><data>%s</data></rpc-reply>`, ids[i], ids[i])))
+		}
+	})
+}
+
+func TestExecAsync(t *testing.T) {
+	const n = 5
+	s := newPipelineTest(t, n)
+
+	msgs := make([]*RPCMessage, n)
+	chans := make([]<-chan *RPCReply, n)
+	for i := range msgs {
+		msgs[i] = NewRPCMessage([]RPCMethod{MethodGetConfig("running")})
+
+		ch, err := s.ExecAsync(msgs[i])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		chans[i] = ch
+	}
+
+	for i, ch := range chans {
+		reply, ok := <-ch
+		if !ok {
+			t.Fatalf("no reply for request %d", i)
+		}
+		if reply.MessageID != msgs[i].MessageID {
+			t.Errorf("unexpected message-id (want %s, got %s)", msgs[i].MessageID, reply.MessageID)
+		}
+		if text := reply.DataElement().Text(); text != msgs[i].MessageID {
+			t.Errorf("reply routed to the wrong request (want %s, got %s)", msgs[i].MessageID, text)
+		}
+	}
+
+	// the server closed the stream, any new request must fail
+	if _, err := s.ExecAsync(NewRPCMessage(nil)); err == nil {
+		t.Errorf("expected error after transport failure")
+	}
+}
+
+func TestExecConcurrent(t *testing.T) {
+	const n = 5
+	s := newPipelineTest(t, n)
+
+	// switch to pipelined mode before the concurrent calls
+	s.startPipeline()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestExecAsyncSendWhileReading(t *testing.T) {
+	// The server writes the replies to the first two requests before reading
+	// the third one: sending it must not keep the reader from draining them.
+	s := newServerTest(func(server *transportTest) {
+		var ids [][]byte
+		for i := 0; i < 2; i++ {
+			req, err := server.Receive()
+			if err != nil {
+				return
+			}
+			ids = append(ids, messageIDRE.FindSubmatch(req)[1])
+		}
+		// let the third request block in send
+		time.Sleep(50 * time.Millisecond)
+		for _, id := range ids {
+			server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, id)))
+		}
+		req, err := server.Receive()
+		if err != nil {
+			return
+		}
+		server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, messageIDRE.FindSubmatch(req)[1])))
+		server.Receive()
+	})
+	defer s.Close()
+
+	var chans []<-chan *RPCReply
+	for i := 0; i < 2; i++ {
+		ch, err := s.ExecAsync(NewRPCMessage([]RPCMethod{MethodGetConfig("running")}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		chans = append(chans, ch)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		ch, err := s.ExecAsync(NewRPCMessage([]RPCMethod{MethodGetConfig("running")}))
+		if err == nil {
+			<-ch
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("deadlock sending while replies are pending")
+	}
+	for i, ch := range chans {
+		if reply := <-ch; reply == nil || !reply.Ok {
+			t.Errorf("no reply for request %d", i)
+		}
+	}
+}
+
+func TestExecAsyncRepliesInOneWrite(t *testing.T) {
+	// The end-of-message framed replies arrive in a single write, the second
+	// one must not be lost with the rest of the read.
+	s := newServerTest(func(server *transportTest) {
+		var replies []byte
+		for i := 0; i < 2; i++ {
+			req, err := server.Receive()
+			if err != nil {
+				return
+			}
+			replies = append(replies, fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>]]>]]>`, messageIDRE.FindSubmatch(req)[1])...)
+		}
+		server.Write(replies)
+		server.Receive()
+	})
+	defer s.Close()
+
+	var chans []<-chan *RPCReply
+	for i := 0; i < 2; i++ {
+		ch, err := s.ExecAsync(NewRPCMessage([]RPCMethod{MethodGetConfig("running")}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		chans = append(chans, ch)
+	}
+	for i, ch := range chans {
+		select {
+		case reply := <-ch:
+			if reply == nil || !reply.Ok {
+				t.Errorf("no reply for request %d", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("reply to request %d lost", i)
+		}
+	}
+}
+
+func TestExecAsyncTransportFailure(t *testing.T) {
+	trans, pw, _ := newPipeTransportTest()
+	s := &Session{Transport: trans}
+
+	ch, err := s.ExecAsync(NewRPCMessage([]RPCMethod{MethodGetConfig("running")}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pw.CloseWithError(fmt.Errorf("connection reset"))
+	if _, ok := <-ch; ok {
+		t.Errorf("expected channel to be closed without reply")
+	}
+}
+
+func TestExecBatch(t *testing.T) {
+	methods := []RPCMethod{MethodLock("candidate"), MethodEditConfig("candidate", "<top/>"), MethodCommit("")}
+
+	t.Run("stop on error", func(t *testing.T) {
+		s, trans := newMemorySession(t, testOkReply, testLockDeniedReply, testOkReply)
+
+		replies, err := s.ExecBatch(context.Background(), methods, BatchOptions{})
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Tag != "lock-denied" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(replies) != 3 || replies[0] == nil || replies[1] != nil || replies[2] != nil {
+			t.Errorf("unexpected replies %v", replies)
+		}
+		if diff := cmp.Diff([]string{"lock", "edit-config"}, sentOperations(trans)); diff != "" {
+			t.Errorf("unexpected operations (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("continue on error", func(t *testing.T) {
+		s := newServerTest(func(server *transportTest) {
+			var ids []string
+			for range methods {
+				req, err := server.Receive()
+				if err != nil {
+					return
+				}
+				ids = append(ids, string(messageIDRE.FindSubmatch(req)[1]))
+			}
+			// replies in reverse order, the edit-config fails
+			server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, ids[2])))
+			server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag><error-severity>error</error-severity></rpc-error></rpc-reply>`, ids[1])))
+			server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, ids[0])))
+		})
+		defer s.Close()
+
+		replies, err := s.ExecBatch(context.Background(), methods, BatchOptions{ContinueOnError: true})
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Tag != "invalid-value" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(err.Error(), "batch request 1 (edit-config)") {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		var got []bool
+		for _, reply := range replies {
+			got = append(got, reply.Ok)
+		}
+		if diff := cmp.Diff([]bool{true, false, true}, got); diff != "" {
+			t.Errorf("unexpected replies (-want +got):\n%s", diff)
+		}
+		if len(replies[1].Errors) != 1 {
+			t.Errorf("unexpected errors %v", replies[1].Errors)
+		}
+	})
+}
@@ -0,0 +1,221 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultPoolSize is the maximum number of sessions of a SessionPool when
+// MaxSize is zero
+const defaultPoolSize = 4
+
+// SessionPool keeps sessions to a device for reuse, e.g. by a controller
+// issuing concurrent requests. Get hands out an idle session, establishing a
+// new one while fewer than MaxSize are open, and Put returns it to the pool.
+//
+// Idle sessions are checked with HealthCheck before being handed out, those
+// failing it are closed and replaced. A session must not be used after being
+// returned, and must be returned without pending lock or confirmed commit.
+type SessionPool struct {
+	// Target and Credential are used to dial the device over SSH, see DialSSH
+	Target     string
+	Credential Credential
+	// Dial establishes the sessions instead of Target and Credential when set
+	Dial func(ctx context.Context) (*Session, error)
+
+	// MaxSize is the maximum number of sessions open at once, Get waits for
+	// a session to be returned when reached
+	MaxSize int
+	// HealthCheck checks an idle session is still usable, Session.Ping by
+	// default.
+	HealthCheck func(ctx context.Context, s *Session) error
+
+	once sync.Once
+	// idle holds the sessions available, open one token per open session
+	// and done is closed with the pool
+	idle chan *Session
+	open chan struct{}
+	done chan struct{}
+
+	// mu guards closed and members, the sessions established by the pool
+	// and not discarded yet, true while idle
+	mu      sync.Mutex
+	closed  bool
+	members map[*Session]bool
+}
+
+// NewSessionPool returns a SessionPool of up to maxSize sessions dialing
+// target over SSH with cred. Sessions are established by Get when needed.
+func NewSessionPool(target string, cred Credential, maxSize int) *SessionPool {
+	return &SessionPool{Target: target, Credential: cred, MaxSize: maxSize}
+}
+
+func (p *SessionPool) init() {
+	size := p.MaxSize
+	if size <= 0 {
+		size = defaultPoolSize
+	}
+	p.idle = make(chan *Session, size)
+	p.open = make(chan struct{}, size)
+	p.done = make(chan struct{})
+	p.members = make(map[*Session]bool)
+}
+
+// Get returns a healthy idle session, or a new one if there is none and the
+// pool isn't full, waiting for a session to be returned otherwise. The
+// session must be given back with Put. Closing the pool ends the wait with
+// ErrSessionClosed.
+func (p *SessionPool) Get(ctx context.Context) (*Session, error) {
+	p.once.Do(p.init)
+
+	for {
+		if p.isClosed() {
+			return nil, ErrSessionClosed
+		}
+
+		// idle sessions are preferred over new ones
+		var s *Session
+		select {
+		case s = <-p.idle:
+		default:
+			select {
+			case s = <-p.idle:
+			case p.open <- struct{}{}:
+			case <-p.done:
+				return nil, ErrSessionClosed
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if s == nil {
+			return p.add(ctx)
+		}
+		p.mu.Lock()
+		p.members[s] = false
+		p.mu.Unlock()
+
+		if err := p.check(ctx, s); err != nil {
+			p.mu.Lock()
+			p.discard(s)
+			p.mu.Unlock()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		return s, nil
+	}
+}
+
+// add establishes a new session in the place taken in p.open.
+func (p *SessionPool) add(ctx context.Context) (*Session, error) {
+	s, err := p.dial(ctx)
+	if err != nil {
+		<-p.open
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		s.Close()
+		<-p.open
+		return nil, ErrSessionClosed
+	}
+	p.members[s] = false
+	return s, nil
+}
+
+// Put returns s to the pool. A closed session, or any session once the pool
+// is closed, is discarded. Sessions not obtained from the pool are closed.
+func (p *SessionPool) Put(s *Session) {
+	if s == nil {
+		return
+	}
+	p.once.Do(p.init)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idle, ok := p.members[s]
+	if !ok {
+		s.Close()
+		return
+	}
+	if idle {
+		// returned twice
+		return
+	}
+	if p.closed || s.isClosed() {
+		p.discard(s)
+		return
+	}
+	p.members[s] = true
+	p.idle <- s
+}
+
+// Close closes the idle sessions, sessions handed out are closed when
+// returned. Get fails afterwards.
+func (p *SessionPool) Close() error {
+	p.once.Do(p.init)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrSessionClosed
+	}
+	p.closed = true
+	close(p.done)
+
+	for {
+		select {
+		case s := <-p.idle:
+			p.discard(s)
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *SessionPool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+func (p *SessionPool) dial(ctx context.Context) (*Session, error) {
+	if p.Dial != nil {
+		return p.Dial(ctx)
+	}
+	return dialCredential(ctx, p.Target, p.Credential)
+}
+
+// check runs the health check on s.
+func (p *SessionPool) check(ctx context.Context, s *Session) error {
+	if s.isClosed() {
+		return ErrSessionClosed
+	}
+	if p.HealthCheck != nil {
+		return p.HealthCheck(ctx, s)
+	}
+	return s.Ping(ctx)
+}
+
+// discard closes s and frees its place in the pool. p.mu must be held.
+func (p *SessionPool) discard(s *Session) {
+	if !s.isClosed() {
+		s.Close()
+	}
+	if _, ok := p.members[s]; ok {
+		delete(p.members, s)
+		<-p.open
+	}
+}
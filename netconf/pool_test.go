@@ -0,0 +1,230 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newPoolTest returns a SessionPool of size sessions answering every request,
+// and the number of sessions dialed.
+func newPoolTest(size int) (*SessionPool, *int32) {
+	var dialed int32
+	p := &SessionPool{
+		MaxSize: size,
+		Dial: func(ctx context.Context) (*Session, error) {
+			atomic.AddInt32(&dialed, 1)
+			return newServerTest(func(server *transportTest) {
+				for {
+					if _, err := server.Receive(); err != nil {
+						return
+					}
+					server.Send([]byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data/></rpc-reply>`))
+				}
+			}), nil
+		},
+	}
+	return p, &dialed
+}
+
+func TestSessionPoolReuse(t *testing.T) {
+	p, dialed := newPoolTest(2)
+	defer p.Close()
+
+	s1, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.Put(s1)
+
+	s2, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s1 != s2 {
+		t.Errorf("expected the idle session to be reused")
+	}
+	if n := atomic.LoadInt32(dialed); n != 1 {
+		t.Errorf("got %d sessions dialed, expected 1", n)
+	}
+	p.Put(s2)
+}
+
+func TestSessionPoolMaxSize(t *testing.T) {
+	p, _ := newPoolTest(1)
+	defer p.Close()
+
+	s, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		p.Put(s)
+	}()
+	got, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != s {
+		t.Errorf("expected the returned session")
+	}
+	p.Put(got)
+}
+
+func TestSessionPoolHealthCheck(t *testing.T) {
+	p, dialed := newPoolTest(1)
+	defer p.Close()
+
+	checked := 0
+	p.HealthCheck = func(ctx context.Context, s *Session) error {
+		checked++
+		if checked == 1 {
+			return ErrTransportClosed
+		}
+		return nil
+	}
+
+	s1, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.Put(s1)
+
+	// the unhealthy session is replaced even though the pool is full
+	s2, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s1 == s2 || !s1.isClosed() {
+		t.Errorf("expected the unhealthy session to be closed and replaced")
+	}
+	if n := atomic.LoadInt32(dialed); n != 2 {
+		t.Errorf("got %d sessions dialed, expected 2", n)
+	}
+	p.Put(s2)
+
+	// the default check sends a request
+	p.HealthCheck = nil
+	s3, err := p.Get(context.Background())
+	if err != nil || s3 != s2 {
+		t.Errorf("expected the healthy session, got error %v", err)
+	}
+	p.Put(s3)
+}
+
+func TestSessionPoolClose(t *testing.T) {
+	p, _ := newPoolTest(2)
+
+	s1, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s2, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.Put(s1)
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !s1.isClosed() {
+		t.Errorf("expected the idle session to be closed")
+	}
+
+	p.Put(s2)
+	if !s2.isClosed() {
+		t.Errorf("expected the session returned after close to be closed")
+	}
+	if _, err := p.Get(context.Background()); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("got %v, expected %v", err, ErrSessionClosed)
+	}
+}
+
+func TestSessionPoolForeignSession(t *testing.T) {
+	p, _ := newPoolTest(1)
+	defer p.Close()
+
+	s, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a session not from the pool, even closed, doesn't free a place
+	foreign, _ := newPoolTest(1)
+	defer foreign.Close()
+	other, err := foreign.Get(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other.Close()
+	done := make(chan struct{})
+	go func() {
+		p.Put(other)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Put of a foreign session blocked")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	// returning a session twice doesn't hand it out twice
+	p.Put(s)
+	p.Put(s)
+	if got, err := p.Get(context.Background()); err != nil || got != s {
+		t.Fatalf("expected the returned session, got error %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSessionPoolCloseWakesGet(t *testing.T) {
+	p, _ := newPoolTest(1)
+
+	if _, err := p.Get(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := p.Get(context.Background())
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.Close()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrSessionClosed) {
+			t.Errorf("got %v, expected %v", err, ErrSessionClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Get still waiting after Close")
+	}
+}
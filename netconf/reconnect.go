@@ -0,0 +1,362 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMinBackoff and defaultMaxBackoff bound the delay between
+	// reconnection attempts
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// ConnState is the connection state of a ReconnectingSession.
+type ConnState int
+
+const (
+	// StateDisconnected means there is no session to the device
+	StateDisconnected ConnState = iota
+	// StateConnecting means a session is being established
+	StateConnecting
+	// StateConnected means a session is established
+	StateConnected
+)
+
+func (c ConnState) String() string {
+	switch c {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	default:
+		return "disconnected"
+	}
+}
+
+// ReconnectingSession establishes a new session to a device when the current
+// one fails, going through the dial, hello and framing negotiation again.
+//
+// Requests failing because of the connection are re-sent on the new session
+// only if Retryable allows it, by default for the read-only get, get-config,
+// get-data and get-schema operations. A request such as edit-config or commit
+// may have been applied before the connection failed, so its error is
+// returned and the session is only re-established for the next request.
+//
+// Locks, pending confirmed commits and subscriptions are tied to a session and
+// are lost when reconnecting.
+type ReconnectingSession struct {
+	// Target and Credential are used to dial the device over SSH, see DialSSH
+	Target     string
+	Credential Credential
+	// Dial establishes the sessions instead of Target and Credential when set
+	Dial func(ctx context.Context) (*Session, error)
+
+	// MinBackoff is the delay before the second connection attempt, doubled
+	// after each failure up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of connection attempts before giving up,
+	// unlimited if zero in which case the context of the request bounds them
+	MaxAttempts int
+
+	// Retryable reports whether the request with the given operations can be
+	// re-sent after a connection failure
+	Retryable func(operations []string) bool
+	// OnStateChange is called on connection state changes, err is the cause
+	// of a disconnection. It is called without lock held and may use the
+	// ReconnectingSession.
+	OnStateChange func(state ConnState, err error)
+
+	mu      sync.Mutex
+	session *Session
+	closed  bool
+	// connecting is closed once the connection in progress, if any, is done,
+	// and cancel aborts it. mu is not held while connecting.
+	connecting chan struct{}
+	cancel     context.CancelFunc
+}
+
+// NewReconnectingSession returns a ReconnectingSession dialing target over SSH
+// with cred. The first session is established by the first request.
+func NewReconnectingSession(target string, cred Credential) *ReconnectingSession {
+	return &ReconnectingSession{Target: target, Credential: cred}
+}
+
+// readOnlyOperations are retried by default
+var readOnlyOperations = []string{"get", "get-config", "get-data", "get-schema"}
+
+// Exec executes the methods on the current session, establishing a new one if
+// needed, see ReconnectingSession for the retry rules.
+func (r *ReconnectingSession) Exec(ctx context.Context, methods ...RPCMethod) (*RPCReply, error) {
+	s, err := r.Session(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := s.ExecContext(ctx, methods...)
+	r.dropBroken(s, err)
+	if !isConnectionError(err) {
+		return reply, err
+	}
+
+	if ctx.Err() != nil || !r.retryable(methods) {
+		return nil, err
+	}
+
+	s, err = r.Session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err = s.ExecContext(ctx, methods...)
+	r.dropBroken(s, err)
+	return reply, err
+}
+
+// ExecWithRetry executes m as described by policy like
+// Session.ExecWithRetry, establishing a new session for the next attempt
+// after a connection failure such as a timeout. Unlike Exec the operation of
+// m is not checked with Retryable: a request such as edit-config may be
+// applied twice, the policy decides.
+func (r *ReconnectingSession) ExecWithRetry(ctx context.Context, m RPCMethod, policy RetryPolicy) (*RPCReply, error) {
+	retryable := policy.retryable()
+	policy.Retryable = func(err error) bool {
+		return !r.isClosed() && retryable(err)
+	}
+	return policy.exec(ctx, m, func() (*RPCReply, error) {
+		s, err := r.Session(ctx)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := s.ExecContext(ctx, m)
+		r.dropBroken(s, err)
+		return reply, err
+	})
+}
+
+// isClosed reports whether Close was called.
+func (r *ReconnectingSession) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// Session returns the current session, establishing a new one with backoff if
+// there is none. Concurrent calls wait for the connection in progress instead
+// of dialing as well, and Close aborts it.
+func (r *ReconnectingSession) Session(ctx context.Context) (*Session, error) {
+	r.mu.Lock()
+	for r.connecting != nil && !r.closed {
+		connecting := r.connecting
+		r.mu.Unlock()
+		select {
+		case <-connecting:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("can't connect to %s: %w", r.Target, ctx.Err())
+		}
+		r.mu.Lock()
+	}
+
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	if s := r.session; s != nil {
+		r.mu.Unlock()
+		return s, nil
+	}
+
+	connectCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	connecting := make(chan struct{})
+	r.connecting, r.cancel = connecting, cancel
+	r.mu.Unlock()
+	r.notify(StateConnecting, nil)
+
+	s, err := r.connect(connectCtx)
+
+	r.mu.Lock()
+	r.connecting, r.cancel = nil, nil
+	close(connecting)
+	closed := r.closed
+	if !closed && err == nil {
+		r.session = s
+	}
+	r.mu.Unlock()
+
+	switch {
+	case closed:
+		if s != nil {
+			s.Close()
+		}
+		r.notify(StateDisconnected, nil)
+		return nil, ErrSessionClosed
+	case err != nil:
+		r.notify(StateDisconnected, err)
+		return nil, err
+	}
+	r.notify(StateConnected, nil)
+	return s, nil
+}
+
+// connect dials a new session, with backoff between the attempts.
+func (r *ReconnectingSession) connect(ctx context.Context) (*Session, error) {
+	backoff := r.MinBackoff
+	if backoff <= 0 {
+		backoff = defaultMinBackoff
+	}
+	maxBackoff := r.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		s, err := r.dial(ctx)
+		if err == nil {
+			return s, nil
+		}
+
+		if r.MaxAttempts > 0 && attempt >= r.MaxAttempts {
+			return nil, fmt.Errorf("can't connect to %s after %d attempts: %w", r.Target, attempt, err)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("can't connect to %s: %w", r.Target, ctx.Err())
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Close closes the current session, or aborts the connection in progress, no
+// new session is established afterwards.
+func (r *ReconnectingSession) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrSessionClosed
+	}
+	r.closed = true
+	if r.cancel != nil {
+		r.cancel()
+	}
+	s := r.session
+	r.session = nil
+	r.mu.Unlock()
+
+	if s == nil {
+		return nil
+	}
+	err := s.Close()
+	r.notify(StateDisconnected, nil)
+	return err
+}
+
+func (r *ReconnectingSession) dial(ctx context.Context) (*Session, error) {
+	if r.Dial != nil {
+		return r.Dial(ctx)
+	}
+	return dialCredential(ctx, r.Target, r.Credential)
+}
+
+// dialCredential establishes a session to target over SSH with cred.
+func dialCredential(ctx context.Context, target string, cred Credential) (*Session, error) {
+	if cred == nil {
+		return nil, fmt.Errorf("no credential to connect to %s", target)
+	}
+
+	config, err := credentialConfig(cred)
+	if err != nil {
+		return nil, err
+	}
+	return DialSSHContext(ctx, target, config)
+}
+
+// dropBroken discards s if the request failing with err left it unusable: a
+// connection failure, or a session closed by the request such as on
+// cancellation.
+func (r *ReconnectingSession) dropBroken(s *Session, err error) {
+	if isConnectionError(err) || s.isClosed() {
+		r.drop(s, err)
+	}
+}
+
+// drop discards s after it failed with err, unless it was already replaced.
+func (r *ReconnectingSession) drop(s *Session, err error) {
+	r.mu.Lock()
+	if r.session != s {
+		r.mu.Unlock()
+		return
+	}
+	r.session = nil
+	r.mu.Unlock()
+
+	s.Close()
+	r.notify(StateDisconnected, err)
+}
+
+// notify calls OnStateChange, if any, r.mu must not be held.
+func (r *ReconnectingSession) notify(state ConnState, err error) {
+	if r.OnStateChange != nil {
+		r.OnStateChange(state, err)
+	}
+}
+
+func (r *ReconnectingSession) retryable(methods []RPCMethod) bool {
+	operations := make([]string, len(methods))
+	for i, m := range methods {
+		operations[i] = methodName(m)
+	}
+
+	if r.Retryable != nil {
+		return r.Retryable(operations)
+	}
+	for _, op := range operations {
+		if !contains(readOnlyOperations, op) {
+			return false
+		}
+	}
+	return true
+}
+
+// isConnectionError reports whether err is a failure of the connection, which
+// leaves the session unusable: a closed transport or session, a timeout or a
+// network error. Errors of the request or the reply, such as rpc-errors or a
+// malformed reply, are not, nor cancelled contexts.
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrTransportClosed) || errors.Is(err, ErrTimeout) ||
+		errors.Is(err, ErrSessionClosed) || errors.Is(err, ErrSessionIdle) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isRPCError reports whether err holds rpc-errors reported by the server.
+func isRPCError(err error) bool {
+	var rpcErr *RPCError
+	var rpcErrs RPCErrors
+	return errors.As(err, &rpcErr) || errors.As(err, &rpcErrs)
+}
+
+// methodName returns the operation name of m, such as get-config.
+func methodName(m RPCMethod) string {
+	return rootName([]byte(m.MarshalMethod()))
+}
@@ -0,0 +1,306 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newReconnectTest returns a ReconnectingSession whose sessions are served by
+// serve, called with the number of the session starting at 1.
+func newReconnectTest(serve func(n int, server *transportTest)) (*ReconnectingSession, *[]string) {
+	var states []string
+	n := 0
+	r := &ReconnectingSession{
+		Target:     "device",
+		MinBackoff: time.Millisecond,
+		Dial: func(ctx context.Context) (*Session, error) {
+			n++
+			i := n
+			return newServerTest(func(server *transportTest) { serve(i, server) }), nil
+		},
+		OnStateChange: func(state ConnState, err error) {
+			states = append(states, state.String())
+		},
+	}
+	return r, &states
+}
+
+// replyOnce answers the first request with an empty data reply.
+func replyOnce(server *transportTest) {
+	req, err := server.Receive()
+	if err != nil {
+		return
+	}
+	id := messageIDRE.FindSubmatch(req)[1]
+	server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><data/></rpc-reply>`, id)))
+}
+
+// dropConnection reads a request and drops the connection without replying.
+func dropConnection(server *transportTest) {
+	server.Receive()
+}
+
+func TestReconnectingSessionRetry(t *testing.T) {
+	r, states := newReconnectTest(func(n int, server *transportTest) {
+		if n == 1 {
+			dropConnection(server)
+			return
+		}
+		replyOnce(server)
+	})
+	defer r.Close()
+
+	if _, err := r.Exec(context.Background(), MethodGetConfig("running")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"connecting", "connected", "disconnected", "connecting", "connected"}
+	if diff := cmp.Diff(expected, *states); diff != "" {
+		t.Errorf("unexpected states (-want +got):\n%s", diff)
+	}
+}
+
+func TestReconnectingSessionNoRetry(t *testing.T) {
+	r, _ := newReconnectTest(func(n int, server *transportTest) {
+		if n == 1 {
+			dropConnection(server)
+			return
+		}
+		replyOnce(server)
+	})
+	defer r.Close()
+
+	// edit-config may have been applied, it must not be re-sent
+	if _, err := r.Exec(context.Background(), MethodEditConfig("candidate", "<top/>")); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// the next request reconnects
+	if _, err := r.Exec(context.Background(), MethodEditConfig("candidate", "<top/>")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReconnectingSessionRetryable(t *testing.T) {
+	var got []string
+	r, _ := newReconnectTest(func(n int, server *transportTest) {
+		if n == 1 {
+			dropConnection(server)
+			return
+		}
+		replyOnce(server)
+	})
+	r.Retryable = func(operations []string) bool {
+		got = operations
+		return true
+	}
+	defer r.Close()
+
+	if _, err := r.Exec(context.Background(), MethodEditConfig("candidate", "<top/>")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"edit-config"}, got); diff != "" {
+		t.Errorf("unexpected operations (-want +got):\n%s", diff)
+	}
+}
+
+func TestReconnectingSessionBackoff(t *testing.T) {
+	attempts := 0
+	dialErr := errors.New("connection refused")
+	r := &ReconnectingSession{
+		Target:      "device",
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  2 * time.Millisecond,
+		MaxAttempts: 4,
+		Dial: func(ctx context.Context) (*Session, error) {
+			attempts++
+			return nil, dialErr
+		},
+	}
+
+	if _, err := r.Exec(context.Background(), MethodGetConfig("running")); !errors.Is(err, dialErr) {
+		t.Errorf("got %v, expected %v", err, dialErr)
+	}
+	if attempts != 4 {
+		t.Errorf("got %d attempts, expected %d", attempts, 4)
+	}
+
+	r.MaxAttempts = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.Exec(ctx, MethodGetConfig("running")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestReconnectingSessionRPCError(t *testing.T) {
+	r, states := newReconnectTest(func(n int, server *transportTest) {
+		req, err := server.Receive()
+		if err != nil {
+			return
+		}
+		id := messageIDRE.FindSubmatch(req)[1]
+		server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><rpc-error><error-type>application</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity></rpc-error></rpc-reply>`, id)))
+	})
+	defer r.Close()
+
+	var rpcErr *RPCError
+	if _, err := r.Exec(context.Background(), MethodLock("candidate")); !errors.As(err, &rpcErr) {
+		t.Fatalf("got %v, expected *RPCError", err)
+	}
+	if len(*states) != 2 {
+		t.Errorf("rpc-error caused a reconnection: %v", *states)
+	}
+}
+
+func TestReconnectingSessionCloseWhileConnecting(t *testing.T) {
+	dialing := make(chan struct{}, 1)
+	r := &ReconnectingSession{
+		Target:     "device",
+		MinBackoff: time.Millisecond,
+		Dial: func(ctx context.Context) (*Session, error) {
+			select {
+			case dialing <- struct{}{}:
+			default:
+			}
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := r.Exec(context.Background(), MethodGetConfig("running"))
+			errs <- err
+		}()
+	}
+	<-dialing
+
+	closed := make(chan error, 1)
+	go func() { closed <- r.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close blocked by the connection in progress")
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrSessionClosed) {
+				t.Errorf("got %v, expected %v", err, ErrSessionClosed)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("connection not aborted by Close")
+		}
+	}
+}
+
+func TestReconnectingSessionCancelled(t *testing.T) {
+	r, _ := newReconnectTest(func(n int, server *transportTest) {
+		if n == 1 {
+			// never reply, the request is cancelled
+			server.Receive()
+			server.Receive()
+			return
+		}
+		replyOnce(server)
+	})
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := r.Exec(ctx, MethodGetConfig("running")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, expected %v", err, context.Canceled)
+	}
+
+	// the session closed by the cancellation is replaced, even for a
+	// request which isn't retried
+	if _, err := r.Exec(context.Background(), MethodEditConfig("candidate", "<top/>")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReconnectingSessionStateChangeCallback(t *testing.T) {
+	var r *ReconnectingSession
+	r, _ = newReconnectTest(func(n int, server *transportTest) {
+		replyOnce(server)
+	})
+	var states []ConnState
+	r.OnStateChange = func(state ConnState, err error) {
+		states = append(states, state)
+		// the callback may use the session
+		switch state {
+		case StateConnected:
+			r.Session(context.Background())
+		case StateDisconnected:
+			r.Close()
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Exec(context.Background(), MethodGetConfig("running"))
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("deadlock calling the session from OnStateChange")
+	}
+
+	expected := []ConnState{StateConnecting, StateConnected, StateDisconnected}
+	if diff := cmp.Diff(expected, states); diff != "" {
+		t.Errorf("unexpected states (-want +got):\n%s", diff)
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tt := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"transport closed", &transportClosedError{io.EOF}, true},
+		{"timeout", fmt.Errorf("rpc: %w", ErrTimeout), true},
+		{"session closed", ErrSessionClosed, true},
+		{"session idle", ErrSessionIdle, true},
+		{"network error", &net.OpError{Op: "read", Err: errors.New("connection reset")}, true},
+		{"deadline exceeded", fmt.Errorf("rpc aborted: %w", context.DeadlineExceeded), false},
+		{"rpc-error", &RPCError{Tag: "in-use"}, false},
+		{"malformed reply", fmt.Errorf("%w: unexpected EOF", ErrMalformedReply), false},
+		{"message-id mismatch", ErrMessageIDMismatch, false},
+		{"validation", errors.New("invalid datastore"), false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isConnectionError(tc.err); got != tc.expected {
+				t.Errorf("got %v, expected %v", got, tc.expected)
+			}
+		})
+	}
+}
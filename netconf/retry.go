@@ -0,0 +1,141 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// defaultRetryAttempts is the number of attempts of a RetryPolicy when
+// MaxAttempts is zero
+const defaultRetryAttempts = 3
+
+// retryableTags are the error-tags of the rpc-errors reported for transient
+// conditions, such as a datastore locked by another session.
+var retryableTags = map[string]bool{
+	"in-use":      true,
+	"lock-denied": true,
+}
+
+// RetryPolicy controls how Session.ExecWithRetry retries a failed request.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one, 3 when
+	// zero
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, doubled after each
+	// failure up to MaxBackoff when set
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter randomizes the delays by up to this fraction of them, e.g. 0.2
+	// for ±20%, so clients failing together don't retry together
+	Jitter float64
+	// Retryable reports whether a failed attempt is retried, IsRetryable
+	// when nil
+	Retryable func(err error) bool
+}
+
+// IsRetryable reports whether err may not happen again when retrying the
+// request: a failure of the connection such as a timeout or a closed
+// transport, or rpc-errors with the in-use or lock-denied error-tag only. Any
+// other error is not retryable, such as errors of the request itself like
+// data-missing or bad-element, malformed replies and cancelled contexts.
+//
+// A connection failure leaves the session unusable, only
+// ReconnectingSession.ExecWithRetry retries it on a new session.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case isConnectionError(err):
+		return true
+	}
+
+	var rpcErrs RPCErrors
+	if errors.As(err, &rpcErrs) {
+		for _, rpcErr := range rpcErrs {
+			if !retryableTags[rpcErr.Tag] {
+				return false
+			}
+		}
+		return len(rpcErrs) > 0
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return retryableTags[rpcErr.Tag]
+	}
+	return false
+}
+
+// ExecWithRetry executes m like ExecContext, retrying it as described by
+// policy while the attempts fail with a retryable error. Each attempt is sent
+// with a new message-id. The error of the last attempt is returned with the
+// number of attempts made.
+//
+// Connection failures are not retried as the session can't be used anymore,
+// see ReconnectingSession.ExecWithRetry.
+func (s *Session) ExecWithRetry(ctx context.Context, m RPCMethod, policy RetryPolicy) (*RPCReply, error) {
+	retryable := policy.retryable()
+	policy.Retryable = func(err error) bool {
+		return !isConnectionError(err) && retryable(err)
+	}
+	return policy.exec(ctx, m, func() (*RPCReply, error) {
+		return s.ExecContext(ctx, m)
+	})
+}
+
+// retryable returns the Retryable function of the policy, IsRetryable when
+// nil.
+func (p RetryPolicy) retryable() func(err error) bool {
+	if p.Retryable == nil {
+		return IsRetryable
+	}
+	return p.Retryable
+}
+
+// exec calls attempt to execute m until it succeeds or fails with an error
+// which isn't retryable, with the delays of the policy between the attempts.
+func (p RetryPolicy) exec(ctx context.Context, m RPCMethod, attempt func() (*RPCReply, error)) (*RPCReply, error) {
+	attempts := p.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultRetryAttempts
+	}
+	retryable := p.retryable()
+
+	backoff := p.Backoff
+	for n := 1; ; n++ {
+		reply, err := attempt()
+		if err == nil {
+			return reply, nil
+		}
+		if n == attempts || !retryable(err) {
+			return reply, fmt.Errorf("%s failed after %d attempt(s): %w", methodName(m), n, err)
+		}
+
+		select {
+		case <-time.After(p.delay(backoff)):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s aborted after %d attempt(s): %w", methodName(m), n, ctx.Err())
+		}
+		if backoff *= 2; p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// delay returns backoff with the jitter of the policy applied.
+func (p RetryPolicy) delay(backoff time.Duration) time.Duration {
+	if p.Jitter <= 0 || backoff <= 0 {
+		return backoff
+	}
+	return backoff + time.Duration((rand.Float64()*2-1)*p.Jitter*float64(backoff))
+}
@@ -0,0 +1,177 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRPCErrorReply returns an rpc-reply with an rpc-error of tag.
+func testRPCErrorReply(tag string) string {
+	return fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><rpc-error><error-type>protocol</error-type><error-tag>%s</error-tag><error-severity>error</error-severity></rpc-error></rpc-reply>`, tag)
+}
+
+// testTimeoutError is a net.Error timing out.
+type testTimeoutError struct{}
+
+func (testTimeoutError) Error() string   { return "i/o timeout" }
+func (testTimeoutError) Timeout() bool   { return true }
+func (testTimeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{io.ErrUnexpectedEOF, false},
+		{ErrTimeout, true},
+		{&net.OpError{Op: "read", Err: testTimeoutError{}}, true},
+		{&net.OpError{Op: "read", Err: errors.New("connection reset")}, true},
+		{ErrSessionClosed, true},
+		{&transportClosedError{io.EOF}, true},
+		{fmt.Errorf("%w: unexpected EOF", ErrMalformedReply), false},
+		{fmt.Errorf("%w: got 2, expected 1", ErrMessageIDMismatch), false},
+		{ErrNoInterleave, false},
+		{ErrReplyTooLarge, false},
+		{fmt.Errorf("rpc aborted: %w", context.DeadlineExceeded), false},
+		{&RPCError{Tag: "in-use"}, true},
+		{&RPCError{Tag: "lock-denied"}, true},
+		{&RPCError{Tag: "data-missing"}, false},
+		{&RPCError{Tag: "bad-element"}, false},
+		{RPCErrors{{Tag: "in-use"}, {Tag: "lock-denied"}}, true},
+		{RPCErrors{{Tag: "in-use"}, {Tag: "bad-element"}}, false},
+	}
+
+	for _, tc := range tests {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Errorf("%v: got %t, expected %t", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestExecWithRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		replies  []string
+		policy   RetryPolicy
+		attempts int
+		err      string
+	}{
+		{
+			name:     "retried until success",
+			replies:  []string{testRPCErrorReply("in-use"), testLockDeniedReply, testOkReply},
+			attempts: 3,
+		},
+		{
+			name:     "not retryable",
+			replies:  []string{testRPCErrorReply("data-missing"), testOkReply},
+			attempts: 1,
+			err:      "commit failed after 1 attempt(s)",
+		},
+		{
+			name:     "attempts exhausted",
+			replies:  []string{testLockDeniedReply, testLockDeniedReply, testOkReply},
+			policy:   RetryPolicy{MaxAttempts: 2},
+			attempts: 2,
+			err:      "commit failed after 2 attempt(s)",
+		},
+		{
+			name:     "classifier",
+			replies:  []string{testRPCErrorReply("data-missing"), testOkReply},
+			policy:   RetryPolicy{Retryable: func(err error) bool { return true }},
+			attempts: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, trans := newMemorySession(t, tc.replies...)
+
+			_, err := s.ExecWithRetry(context.Background(), MethodCommitStandard(), tc.policy)
+			if tc.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Fatalf("got error %v, expected %q", err, tc.err)
+			}
+
+			if n := len(sentOperations(trans)); n != tc.attempts {
+				t.Errorf("got %d attempts, expected %d", n, tc.attempts)
+			}
+		})
+	}
+}
+
+func TestExecWithRetryConnectionError(t *testing.T) {
+	// the transport fails, the session can't be used for another attempt
+	s, trans := newMemorySession(t)
+
+	_, err := s.ExecWithRetry(context.Background(), MethodGetConfig("running"), RetryPolicy{
+		Retryable: func(err error) bool { return true },
+	})
+	if !isConnectionError(err) {
+		t.Fatalf("got %v, expected a connection error", err)
+	}
+	if n := len(sentOperations(trans)); n != 1 {
+		t.Errorf("got %d attempts, expected 1", n)
+	}
+}
+
+func TestReconnectingSessionExecWithRetry(t *testing.T) {
+	addr := listenSSHTestDevice(t)
+
+	var causes []error
+	dialed := 0
+	r := &ReconnectingSession{
+		Target: addr,
+		Dial: func(ctx context.Context) (*Session, error) {
+			dialed++
+			if dialed == 1 {
+				// the test device never replies
+				return DialSSHWithOptions(addr, SSHConfigPassword("admin", "secret"), SSHOptions{
+					DialTimeout: 5 * time.Second,
+					ReadTimeout: 50 * time.Millisecond,
+				})
+			}
+			return newServerTest(replyOnce), nil
+		},
+		OnStateChange: func(state ConnState, err error) {
+			if err != nil {
+				causes = append(causes, err)
+			}
+		},
+	}
+	defer r.Close()
+
+	if _, err := r.ExecWithRetry(context.Background(), MethodGetConfig("running"), RetryPolicy{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dialed != 2 {
+		t.Errorf("got %d sessions dialed, expected 2", dialed)
+	}
+	if len(causes) != 1 || !errors.Is(causes[0], ErrTimeout) {
+		t.Errorf("got disconnections %v, expected %v", causes, ErrTimeout)
+	}
+}
+
+func TestExecWithRetryWrapsError(t *testing.T) {
+	s, _ := newMemorySession(t, testRPCErrorReply("bad-element"))
+
+	_, err := s.ExecWithRetry(context.Background(), MethodCommitStandard(), RetryPolicy{})
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Tag != "bad-element" {
+		t.Errorf("got %v, expected the bad-element rpc-error", err)
+	}
+}
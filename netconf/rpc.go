@@ -8,18 +8,37 @@ package netconf
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/beevik/etree"
 )
 
 const (
+	// baseNS is the NETCONF base namespace
+	baseNS = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	// monitoringNS is the ietf-netconf-monitoring (RFC 6022) namespace
+	monitoringNS = "urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"
+	// withDefaultsNS is the ietf-netconf-with-defaults (RFC 6243) namespace
+	withDefaultsNS = "urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults"
+	// partialLockNS is the NETCONF partial lock (RFC 5717) namespace
+	partialLockNS = "urn:ietf:params:xml:ns:netconf:partial-lock:1.0"
+	// nmdaNS is the ietf-netconf-nmda (RFC 8526) namespace
+	nmdaNS = "urn:ietf:params:xml:ns:yang:ietf-netconf-nmda"
+	// datastoresNS is the ietf-datastores namespace defining the datastore
+	// identities
+	datastoresNS = "urn:ietf:params:xml:ns:yang:ietf-datastores"
+
 	editConfigXml = `<edit-config>
-<target><%s/></target>
+<target>%s</target>
 <default-operation>merge</default-operation>
 <error-option>rollback-on-error</error-option>
 <config>%s</config>
@@ -40,26 +59,68 @@ func NewRPCMessage(methods []RPCMethod) *RPCMessage {
 	}
 }
 
-func (m *RPCMessage) Exec(s *Session) (*RPCReply, error) {
-	request, err := xml.Marshal(m)
-	if err != nil {
+// Exec sends the message on the session and waits for the reply.
+func (m *RPCMessage) Exec(s *Session) (reply *RPCReply, err error) {
+	defer s.observeRPC(m, time.Now(), &err)
+	return m.exec(s)
+}
+
+// ExecContext sends the message on the session and waits for the reply,
+// aborting when ctx is done. As a half read reply leaves the stream in an
+// unknown state, the session transport is closed on cancellation and the
+// session can't be used afterwards, unless the session is pipelined (see
+// Session.ExecAsync).
+func (m *RPCMessage) ExecContext(ctx context.Context, s *Session) (reply *RPCReply, err error) {
+	defer s.observeRPC(m, time.Now(), &err)
+
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	header := []byte(xml.Header)
-	request = append(header, request...)
+	if p := s.activePipeline(); p != nil {
+		return s.execPipelined(ctx, p, m)
+	}
+
+	stop := closeOnDone(ctx, s.Transport)
+	reply, err = m.exec(s)
+	if stop() {
+		// the transport was closed, later calls get ErrSessionClosed
+		s.markClosed()
+		s.stopIdleTimer()
+		return nil, fmt.Errorf("rpc %s aborted: %w", m.MessageID, ctx.Err())
+	}
+	return reply, err
+}
+
+func (m *RPCMessage) exec(s *Session) (*RPCReply, error) {
+	if s.isClosed() {
+		return nil, ErrSessionClosed
+	}
+	if p := s.activePipeline(); p != nil {
+		return s.execPipelined(context.Background(), p, m)
+	}
+
+	request, err := s.marshalRequest(m)
+	if err != nil {
+		return nil, err
+	}
 
-	err = s.Transport.Send(request)
+	err = s.send(request)
 	if err != nil {
 		return nil, err
 	}
 
-	rawXML, err := s.Transport.Receive()
+	rawXML, err := s.receive()
+	s.idleEnd()
 	if err != nil {
 		return nil, err
 	}
 
 	reply, err := newRPCReply(rawXML, s.ErrOnWarning, m.MessageID)
+	if reply != nil && !s.IgnoreMessageID && reply.replyMessageID != "" && reply.replyMessageID != m.MessageID {
+		return nil, fmt.Errorf("%w: expected %q, got %q", ErrMessageIDMismatch, m.MessageID, reply.replyMessageID)
+	}
+	s.handleWarnings(reply)
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +128,86 @@ func (m *RPCMessage) Exec(s *Session) (*RPCReply, error) {
 	return reply, nil
 }
 
+// defaultRequestIndent is the indentation of PrettyRequests when
+// RequestIndent is empty
+const defaultRequestIndent = "  "
+
+// marshalRequest returns the XML of the request sent for m, indented when
+// PrettyRequests is set and prefixed with the XML declaration of the session.
+func (s *Session) marshalRequest(m *RPCMessage) ([]byte, error) {
+	request, err := xml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.PrettyRequests {
+		indent := s.RequestIndent
+		if indent == "" {
+			indent = defaultRequestIndent
+		}
+		if request, err = indentXML(request, indent); err != nil {
+			return nil, fmt.Errorf("failed to indent request: %w", err)
+		}
+	}
+
+	return append([]byte(s.xmlDeclaration()), request...), nil
+}
+
+// xmlDeclaration returns the XML declaration prepended to the requests.
+func (s *Session) xmlDeclaration() string {
+	switch {
+	case s.OmitXMLDeclaration:
+		return ""
+	case s.XMLDeclaration != "":
+		return s.XMLDeclaration
+	}
+	return xml.Header
+}
+
+// indentXML indents the elements of data holding only elements. The content
+// of elements holding text, such as CLI commands or configuration text, is
+// kept as is.
+func indentXML(data []byte, indent string) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+	if root := doc.Root(); root != nil {
+		indentElement(root, 0, indent)
+	}
+	return doc.WriteToBytes()
+}
+
+func indentElement(e *etree.Element, depth int, indent string) {
+	if len(e.ChildElements()) == 0 {
+		return
+	}
+
+	// whitespace is only insignificant in elements without text
+	var children []etree.Token
+	for _, c := range e.Child {
+		if cd, ok := c.(*etree.CharData); ok {
+			if strings.TrimSpace(cd.Data) != "" {
+				return
+			}
+			continue
+		}
+		children = append(children, c)
+	}
+
+	for len(e.Child) > 0 {
+		e.RemoveChildAt(0)
+	}
+	for _, c := range children {
+		e.CreateCharData("\n" + strings.Repeat(indent, depth+1))
+		e.AddChild(c)
+		if ce, ok := c.(*etree.Element); ok {
+			indentElement(ce, depth+1, indent)
+		}
+	}
+	e.CreateCharData("\n" + strings.Repeat(indent, depth))
+}
+
 // MarshalXML marshals the NETCONF XML data
 func (m *RPCMessage) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	var buf bytes.Buffer
@@ -80,7 +221,7 @@ func (m *RPCMessage) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 		Methods   []byte `xml:",innerxml"`
 	}{
 		m.MessageID,
-		"urn:ietf:params:xml:ns:netconf:base:1.0",
+		baseNS,
 		buf.Bytes(),
 	}
 
@@ -91,29 +232,67 @@ func (m *RPCMessage) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 
 // RPCReply defines a reply to a RPC request
 type RPCReply struct {
-	Errors    []RPCError
+	Errors []RPCError
+	// Data is the reply document, rooted at the rpc-reply element, see
+	// DataElement for its content
 	Data      *etree.Document
 	Ok        bool
 	MessageID string
+	// Raw holds the reply exactly as received from the transport
+	Raw []byte
+
+	// message-id attribute of the rpc-reply element
+	replyMessageID string
+}
+
+// ErrMessageIDMismatch is returned when the message-id of a reply differs from
+// the one of the request. Replies without message-id, as sent by servers
+// rejecting the request itself, are not considered a mismatch.
+var ErrMessageIDMismatch = errors.New("reply message-id mismatch")
+
+// ErrMalformedReply is matched by the errors returned for replies which can't
+// be parsed, which wrap the parse error.
+var ErrMalformedReply = errors.New("malformed reply")
+
+// malformedReplyError is a parse error of a reply.
+type malformedReplyError struct {
+	err error
+}
+
+func (e *malformedReplyError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrMalformedReply, e.err)
+}
+
+func (e *malformedReplyError) Is(target error) bool {
+	return target == ErrMalformedReply
+}
+
+func (e *malformedReplyError) Unwrap() error {
+	return e.err
 }
 
 func newRPCReply(rawXML []byte, ErrOnWarning bool, messageID string) (*RPCReply, error) {
 	reply := &RPCReply{
 		Data: etree.NewDocument(),
+		Raw:  rawXML,
 	}
 
 	if err := reply.Data.ReadFromBytes(rawXML); err != nil {
-		return nil, err
+		return nil, &malformedReplyError{err}
 	}
 
 	if reply.Data.FindElement("//ok") != nil {
 		reply.Ok = true
 	}
 
-	if root := reply.Data.FindElement("rpc-reply").ChildElements()[0]; root == nil {
-		return nil, fmt.Errorf("can't find root")
-	} else {
-		reply.Data.SetRoot(root)
+	rpcReply := reply.Data.FindElement("rpc-reply")
+	if rpcReply == nil {
+		return nil, &malformedReplyError{fmt.Errorf("no rpc-reply element in %q", rawXML)}
+	}
+	reply.replyMessageID = rpcReply.SelectAttrValue("message-id", "")
+
+	if len(rpcReply.ChildElements()) == 0 {
+		return nil, &malformedReplyError{fmt.Errorf("empty rpc-reply")}
 	}
 
 	safeText := func(el *etree.Element) string {
@@ -125,27 +304,229 @@ func newRPCReply(rawXML []byte, ErrOnWarning bool, messageID string) (*RPCReply,
 
 	for _, rpcErr := range reply.Data.FindElements("//rpc-error") {
 
+		var info map[string]string
+		if errInfo := rpcErr.FindElement("error-info"); errInfo != nil {
+			info = make(map[string]string)
+			for _, el := range errInfo.ChildElements() {
+				info[el.Tag] = strings.TrimSpace(el.Text())
+			}
+		}
+
 		reply.Errors = append(reply.Errors, RPCError{
 			Type:     safeText(rpcErr.FindElement("error-type")),
 			Tag:      safeText(rpcErr.FindElement("error-tag")),
 			Severity: safeText(rpcErr.FindElement("error-severity")),
+			AppTag:   safeText(rpcErr.FindElement("error-app-tag")),
 			Path:     safeText(rpcErr.FindElement("error-path")),
 			Message:  safeText(rpcErr.FindElement("error-message")),
+			Info:     info,
 		})
 	}
 
+	// Junos reports commit and load failures in its own error elements
+	reply.Errors = append(reply.Errors, junosReplyErrors(reply.Data)...)
+
 	// will return a valid reply so setting Requests message id
 	reply.MessageID = messageID
 
-	if reply.Errors != nil {
-		for _, rpcErr := range reply.Errors {
-			if rpcErr.Severity == "error" || ErrOnWarning {
-				return reply, &rpcErr
+	return reply, replyError(reply.Errors, ErrOnWarning)
+}
+
+// replyError returns the errors of severity error, or all of them with
+// errOnWarning, as a *RPCError for a single one and RPCErrors for several.
+func replyError(rpcErrs []RPCError, errOnWarning bool) error {
+	var errs RPCErrors
+	for _, rpcErr := range rpcErrs {
+		if rpcErr.Severity == "error" || errOnWarning {
+			errs = append(errs, rpcErr)
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return &errs[0]
+	default:
+		return errs
+	}
+}
+
+// handleWarnings passes the warnings of reply to the warning handler of the
+// session.
+func (s *Session) handleWarnings(reply *RPCReply) {
+	if s.WarningHandler == nil || reply == nil {
+		return
+	}
+	for _, rpcErr := range reply.Errors {
+		if rpcErr.Severity == "warning" {
+			s.WarningHandler(rpcErr)
+		}
+	}
+}
+
+// DataElement returns the first element of the reply, typically data, or nil
+// for an ok reply. Its namespace declarations, as those of the rpc-reply
+// element, are resolved through its parents which are left in the document.
+func (r *RPCReply) DataElement() *etree.Element {
+	root := r.Data.Root()
+	if root == nil {
+		return nil
+	}
+	children := root.ChildElements()
+	if len(children) == 0 || children[0].Tag == "ok" {
+		return nil
+	}
+	return children[0]
+}
+
+// inheritNamespaces declares on el the namespaces declared by from and its
+// ancestors which el doesn't declare itself, so el can be detached.
+func inheritNamespaces(el, from *etree.Element) {
+	for p := from; p != nil; p = p.Parent() {
+		for _, attr := range p.Attr {
+			isNS := attr.Space == "xmlns" || (attr.Space == "" && attr.Key == "xmlns")
+			if isNS && el.SelectAttr(attr.FullKey()) == nil {
+				el.CreateAttr(attr.FullKey(), attr.Value)
 			}
 		}
 	}
+}
 
-	return reply, nil
+// Unmarshal decodes the first element inside the data of the reply into v
+// using xml.Unmarshal. Namespace declarations of the enclosing elements are
+// carried over so prefixed content decodes correctly.
+func (r *RPCReply) Unmarshal(v interface{}) error {
+	if err := replyError(r.Errors, false); err != nil {
+		return fmt.Errorf("reply contains errors: %w", err)
+	}
+
+	root := r.DataElement()
+	if root == nil || root.Tag != "data" {
+		return fmt.Errorf("no data in reply")
+	}
+
+	children := root.ChildElements()
+	if len(children) == 0 {
+		return fmt.Errorf("empty data in reply")
+	}
+
+	el := children[0].Copy()
+	inheritNamespaces(el, root)
+
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+	buf, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(buf, v)
+}
+
+// SchemaText returns the schema text contained in the data of a get-schema
+// reply.
+func (r *RPCReply) SchemaText() (string, error) {
+	root := r.DataElement()
+	if root == nil || root.Tag != "data" {
+		return "", fmt.Errorf("no data in get-schema reply")
+	}
+
+	var buf strings.Builder
+	for _, tok := range root.Child {
+		if cd, ok := tok.(*etree.CharData); ok {
+			buf.WriteString(cd.Data)
+		}
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// DataString returns the elements inside the data of the reply as indented
+// XML, each carrying the namespace declarations in scope. An empty data
+// element returns an empty string.
+func (r *RPCReply) DataString() (string, error) {
+	root := r.DataElement()
+	if root == nil || root.Tag != "data" {
+		return "", fmt.Errorf("no data in reply")
+	}
+
+	doc := etree.NewDocument()
+	for _, child := range root.ChildElements() {
+		el := child.Copy()
+		inheritNamespaces(el, root)
+		doc.AddChild(el)
+	}
+	if len(doc.ChildElements()) == 0 {
+		return "", nil
+	}
+
+	doc.Indent(2)
+	return doc.WriteToString()
+}
+
+// Value returns the trimmed text of the first element of the reply matching
+// the etree path, such as "//interface[name='eth0']/mtu", or an error if the
+// path is invalid or nothing matches, so a missing element can be told from
+// an empty one. Paths are evaluated from the document, rooted at rpc-reply.
+// Prefixed names match the prefixes used in the reply, unprefixed names
+// match any namespace, and the namespace-uri() predicate matches a namespace
+// whatever its prefix.
+func (r *RPCReply) Value(path string) (string, error) {
+	p, err := compilePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	el := r.Data.FindElementPath(p)
+	if el == nil {
+		return "", fmt.Errorf("no element matching %q in reply", path)
+	}
+	return strings.TrimSpace(el.Text()), nil
+}
+
+// Values returns the trimmed text of the elements of the reply matching the
+// etree path, nil if the path is invalid or nothing matches. See Value for the
+// paths.
+func (r *RPCReply) Values(path string) []string {
+	p, err := compilePath(path)
+	if err != nil {
+		return nil
+	}
+
+	var values []string
+	for _, el := range r.Data.FindElementsPath(p) {
+		values = append(values, strings.TrimSpace(el.Text()))
+	}
+	return values
+}
+
+// compilePath compiles an etree path, recovering from the panics of etree on
+// some malformed paths.
+func compilePath(path string) (p etree.Path, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid path %q", path)
+		}
+	}()
+
+	p, err = etree.CompilePath(path)
+	if err != nil {
+		return p, fmt.Errorf("invalid path %q: %v", path, err)
+	}
+	return p, nil
+}
+
+// LockID returns the lock-id of a partial-lock reply.
+func (r *RPCReply) LockID() (uint32, error) {
+	el := r.Data.FindElement("//lock-id")
+	if el == nil {
+		return 0, fmt.Errorf("no lock-id in reply")
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSpace(el.Text()), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lock-id %q", el.Text())
+	}
+	return uint32(id), nil
 }
 
 // RPCError defines an error reply to a RPC request
@@ -153,13 +534,121 @@ type RPCError struct {
 	Type     string `xml:"error-type"`
 	Tag      string `xml:"error-tag"`
 	Severity string `xml:"error-severity"`
+	AppTag   string `xml:"error-app-tag"`
 	Path     string `xml:"error-path"`
 	Message  string `xml:"error-message"`
+	// Info maps the elements of error-info (e.g. bad-element, session-id) to
+	// their text
+	Info map[string]string `xml:"-"`
 }
 
 // Error generates a string representation of the provided RPC error
 func (re *RPCError) Error() string {
-	return fmt.Sprintf("netconf rpc [%s] '%s'", re.Severity, strings.TrimSpace(re.Message))
+	msg := fmt.Sprintf("netconf rpc [%s] '%s'", re.Severity, strings.TrimSpace(re.Message))
+
+	var details []string
+	if re.AppTag != "" {
+		details = append(details, "app-tag: "+re.AppTag)
+	}
+	if badElement := re.Info["bad-element"]; badElement != "" {
+		details = append(details, "bad-element: "+badElement)
+	}
+	if len(details) > 0 {
+		msg += " (" + strings.Join(details, ", ") + ")"
+	}
+	return msg
+}
+
+// As allows errors.As to extract a lock-denied error as *LockDeniedError.
+func (re *RPCError) As(target interface{}) bool {
+	if t, ok := target.(**LockDeniedError); ok {
+		if lockErr := newLockDeniedError(re); lockErr != nil {
+			*t = lockErr
+			return true
+		}
+	}
+	return false
+}
+
+// RPCErrors is returned when a reply contains several rpc-errors.
+type RPCErrors []RPCError
+
+// Error generates a string representation of all the RPC errors
+func (errs RPCErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, re := range errs {
+		msg := fmt.Sprintf("[%s]", re.Severity)
+		if re.Path != "" {
+			msg += " " + strings.TrimSpace(re.Path)
+		}
+		msgs[i] = fmt.Sprintf("%s '%s'", msg, strings.TrimSpace(re.Message))
+	}
+	return fmt.Sprintf("netconf rpc %d errors: %s", len(errs), strings.Join(msgs, "; "))
+}
+
+// As allows errors.As to extract the first error as *RPCError, or the first
+// lock-denied error as *LockDeniedError.
+func (errs RPCErrors) As(target interface{}) bool {
+	switch t := target.(type) {
+	case **RPCError:
+		if len(errs) > 0 {
+			*t = &errs[0]
+			return true
+		}
+	case **LockDeniedError:
+		for i := range errs {
+			if lockErr := newLockDeniedError(&errs[i]); lockErr != nil {
+				*t = lockErr
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LockDeniedError describes a lock or partial-lock failing because the
+// datastore is already locked. The request fails with its rpc-error, from
+// which errors.As extracts a *LockDeniedError. Callers can back off or end the
+// holding session with kill-session.
+type LockDeniedError struct {
+	// SessionID is the session holding the lock, 0 when it is held by a
+	// non-NETCONF entity
+	SessionID uint32
+
+	err *RPCError
+}
+
+// newLockDeniedError returns the LockDeniedError of rpcErr, nil if rpcErr is
+// not a lock-denied error.
+func newLockDeniedError(rpcErr *RPCError) *LockDeniedError {
+	if rpcErr.Tag != "lock-denied" {
+		return nil
+	}
+	id, _ := strconv.ParseUint(rpcErr.Info["session-id"], 10, 32)
+	return &LockDeniedError{SessionID: uint32(id), err: rpcErr}
+}
+
+// Error generates a string representation of the lock-denied error
+func (e *LockDeniedError) Error() string {
+	if e.SessionID == 0 {
+		return fmt.Sprintf("lock denied, held outside NETCONF: %v", e.err)
+	}
+	return fmt.Sprintf("lock denied, held by session %d: %v", e.SessionID, e.err)
+}
+
+// Unwrap returns the rpc-error of e.
+func (e *LockDeniedError) Unwrap() error {
+	return e.err
+}
+
+// FirstRPCError returns the first RPC error contained in err, either a
+// *RPCError or RPCErrors, or nil if there is none.
+func FirstRPCError(err error) *RPCError {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return nil
 }
 
 // RPCMethod defines the interface for creating an RPC method.
@@ -175,39 +664,164 @@ func (r RawMethod) MarshalMethod() string {
 	return string(r)
 }
 
-// MethodLock files a NETCONF lock target request with the remote host
-func MethodLock(target string) RawMethod {
-	return RawMethod(fmt.Sprintf("<lock><target><%s/></target></lock>", target))
+// MethodLock files a NETCONF lock target request with the remote host.
+// A target which isn't a valid datastore name is left out, see
+// datastoreElement.
+func MethodLock(target Datastore) RawMethod {
+	return RawMethod(fmt.Sprintf("<lock><target>%s</target></lock>", datastoreElement(target)))
 }
 
 // MethodUnlock files a NETCONF unlock target request with the remote host
-func MethodUnlock(target string) RawMethod {
-	return RawMethod(fmt.Sprintf("<unlock><target><%s/></target></unlock>", target))
+func MethodUnlock(target Datastore) RawMethod {
+	return RawMethod(fmt.Sprintf("<unlock><target>%s</target></unlock>", datastoreElement(target)))
 }
 
 // MethodGetConfig files a NETCONF get-config source request with the remote host
-func MethodGetConfig(source string) RawMethod {
-	return RawMethod(fmt.Sprintf("<get-config><source><%s/></source></get-config>", source))
+func MethodGetConfig(source Datastore) RawMethod {
+	return RawMethod(fmt.Sprintf("<get-config><source>%s</source></get-config>", datastoreElement(source)))
+}
+
+// MethodGetConfigURL files a NETCONF get-config request with the remote host
+// reading the configuration stored at url, see the :url capability.
+func MethodGetConfigURL(url string) RawMethod {
+	return RawMethod(fmt.Sprintf("<get-config><source><url>%s</url></source></get-config>", escapeText(url)))
+}
+
+// MethodGetConfigFiltered files a NETCONF get-config source request with a
+// filter with the remote host. See MethodGet for the filter arguments.
+func MethodGetConfigFiltered(source Datastore, filterType, expr string) RawMethod {
+	return RawMethod(fmt.Sprintf("<get-config><source>%s</source>%s</get-config>", datastoreElement(source), filterElement(filterType, expr)))
 }
 
-// MethodGet files a NETCONF get source request with the remote host
+// MethodGetConfigWithDefaults files a NETCONF get-config source request with
+// the remote host asking for default values to be reported according to mode:
+// report-all, trim, explicit or report-all-tagged.
+func MethodGetConfigWithDefaults(source Datastore, mode string) RawMethod {
+	return RawMethod(fmt.Sprintf(`<get-config><source>%s</source><with-defaults xmlns="%s">%s</with-defaults></get-config>`,
+		datastoreElement(source), withDefaultsNS, escapeText(mode)))
+}
+
+// MethodGet files a NETCONF get source request with the remote host.
+// filterType is "subtree" or "xpath", see filterElement for other values. For
+// "xpath" dataXml is the XPath expression used as select attribute, otherwise
+// it is the filter content.
+//
+// An empty dataXml omits the filter, selecting the whole running
+// configuration and state data like MethodGetAll, whereas an empty filter
+// element selects nothing per RFC 6241.
 func MethodGet(filterType string, dataXml string) RawMethod {
-	return RawMethod(fmt.Sprintf("<get><filter type=\"%s\">%s</filter></get>", filterType, dataXml))
+	if dataXml == "" {
+		return MethodGetAll()
+	}
+	return RawMethod(fmt.Sprintf("<get>%s</get>", filterElement(filterType, dataXml)))
+}
+
+// MethodGetAll files a NETCONF get request without filter with the remote
+// host, retrieving the whole running configuration and state data, which can
+// be large.
+func MethodGetAll() RawMethod {
+	return RawMethod("<get/>")
+}
+
+// filterElement returns the filter element for the filter type, placing XPath
+// expressions in the select attribute. A type other than subtree or xpath
+// gives an xpath filter without the mandatory select attribute, which the
+// server rejects, rather than a request selecting more than asked.
+func filterElement(filterType, data string) string {
+	switch filterType {
+	case "xpath":
+		return fmt.Sprintf(`<filter type="xpath" select="%s"/>`, escapeText(data))
+	case "subtree":
+		return fmt.Sprintf(`<filter type="subtree">%s</filter>`, data)
+	}
+	return `<filter type="xpath"/>`
+}
+
+// filterTypes are the filter types defined by RFC 6241
+var filterTypes = []string{"subtree", "xpath"}
+
+// validateFilter checks that the filter arguments can be sent.
+func validateFilter(filterType, data string) error {
+	if !contains(filterTypes, filterType) {
+		return fmt.Errorf("invalid filter type %q", filterType)
+	}
+	if filterType == "xpath" && strings.TrimSpace(data) == "" {
+		return fmt.Errorf("xpath filter requires an expression")
+	}
+	return nil
 }
 
 // MethodEditConfig files a NETCONF edit-config request with the remote host
-func MethodEditConfig(database string, dataXml string) RawMethod {
-	return RawMethod(fmt.Sprintf(editConfigXml, database, dataXml))
+func MethodEditConfig(database Datastore, dataXml string) RawMethod {
+	return RawMethod(fmt.Sprintf(editConfigXml, datastoreElement(database), dataXml))
+}
+
+// EditConfigOptions holds the optional parameters of edit-config. Unset
+// options are omitted so the device defaults apply.
+type EditConfigOptions struct {
+	// DefaultOperation is one of merge, replace or none
+	DefaultOperation string
+	// ErrorOption is one of stop-on-error, continue-on-error or
+	// rollback-on-error
+	ErrorOption string
+	// TestOption is one of test-then-set, set or test-only, it requires the
+	// :validate capability
+	TestOption string
+}
+
+var (
+	defaultOperations = []string{"merge", "replace", "none"}
+	errorOptions      = []string{"stop-on-error", "continue-on-error", "rollback-on-error"}
+	testOptions       = []string{"test-then-set", "set", "test-only"}
+)
+
+// validate checks the options hold values defined by RFC 6241.
+func (o EditConfigOptions) validate() error {
+	if o.DefaultOperation != "" && !contains(defaultOperations, o.DefaultOperation) {
+		return fmt.Errorf("invalid default-operation %q", o.DefaultOperation)
+	}
+	if o.ErrorOption != "" && !contains(errorOptions, o.ErrorOption) {
+		return fmt.Errorf("invalid error-option %q", o.ErrorOption)
+	}
+	if o.TestOption != "" && !contains(testOptions, o.TestOption) {
+		return fmt.Errorf("invalid test-option %q", o.TestOption)
+	}
+	return nil
+}
+
+// MethodEditConfigOpts files a NETCONF edit-config request with the remote
+// host using the given options.
+func MethodEditConfigOpts(target Datastore, config string, opts EditConfigOptions) RawMethod {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<edit-config><target>%s</target>", datastoreElement(target))
+	if opts.DefaultOperation != "" {
+		fmt.Fprintf(&buf, "<default-operation>%s</default-operation>", escapeText(opts.DefaultOperation))
+	}
+	if opts.TestOption != "" {
+		fmt.Fprintf(&buf, "<test-option>%s</test-option>", escapeText(opts.TestOption))
+	}
+	if opts.ErrorOption != "" {
+		fmt.Fprintf(&buf, "<error-option>%s</error-option>", escapeText(opts.ErrorOption))
+	}
+	fmt.Fprintf(&buf, "<config>%s</config></edit-config>", config)
+	return RawMethod(buf.String())
+}
+
+// MethodEditConfigURL files a NETCONF edit-config request with the remote
+// host loading the configuration from url, see the :url capability.
+func MethodEditConfigURL(target Datastore, url string) RawMethod {
+	return RawMethod(fmt.Sprintf("<edit-config><target>%s</target><url>%s</url></edit-config>", datastoreElement(target), escapeText(url)))
 }
 
 // MethodValidate files a NETCONF validating config with the remote host
-func MethodValidate(source string) RawMethod {
-	return RawMethod(fmt.Sprintf("<validate><source><%s/></source></validate>", source))
+func MethodValidate(source Datastore) RawMethod {
+	return RawMethod(fmt.Sprintf("<validate><source>%s</source></validate>", datastoreElement(source)))
 }
 
-// MethodSetConfig files a NETCONF set-config request with the remote host
-func MethodSetConfig(config string) RawMethod {
-	return RawMethod(fmt.Sprintf(`<load-configuration action="set" format="text"><configuration-set>%s</configuration-set></load-configuration>`, config))
+// MethodValidateConfig files a NETCONF validate request with the remote host
+// for the inline configuration config, see the :validate:1.1 capability.
+func MethodValidateConfig(config string) RawMethod {
+	return RawMethod(fmt.Sprintf("<validate><source><config>%s</config></source></validate>", config))
 }
 
 //MethodDiscard files a NETCONF discard request with the remote host
@@ -215,18 +829,221 @@ func MethodDiscard() RawMethod {
 	return RawMethod(`<discard-changes/>`)
 }
 
-//MethodCompare files a NETCONF compare request with the remote host
-func MethodCompare() RawMethod {
-	return RawMethod(`<get-configuration compare="rollback" rollback="0" format="text"/>`)
+// MethodCommitStandard files a RFC 6241 commit request with the remote host,
+// committing the candidate configuration to running. See MethodCommit for
+// Junos and MethodCommitWithComment for Cisco.
+func MethodCommitStandard() RawMethod {
+	return RawMethod("<commit/>")
+}
+
+// MethodCommitConfirmed files a NETCONF confirmed commit request with the
+// remote host. The commit is rolled back unless confirmed within timeout
+// seconds, a zero timeout uses the server default of 600 seconds. persist
+// makes the confirmed commit survive the session end so it can be confirmed
+// from another session using the same token, persistID confirms or extends a
+// confirmed commit started with persist. Empty values are omitted.
+func MethodCommitConfirmed(timeout int, persist, persistID string) RawMethod {
+	var buf bytes.Buffer
+	buf.WriteString("<commit><confirmed/>")
+	if timeout > 0 {
+		fmt.Fprintf(&buf, "<confirm-timeout>%d</confirm-timeout>", timeout)
+	}
+	if persist != "" {
+		fmt.Fprintf(&buf, "<persist>%s</persist>", escapeText(persist))
+	}
+	if persistID != "" {
+		fmt.Fprintf(&buf, "<persist-id>%s</persist-id>", escapeText(persistID))
+	}
+	buf.WriteString("</commit>")
+	return RawMethod(buf.String())
 }
 
-//MethodCompare files a NETCONF commit request with the remote host
-func MethodCommit(msg string) RawMethod {
-	return RawMethod(fmt.Sprintf(`<commit-configuration><log>%s</log></commit-configuration>`, msg))
+// MethodCommitConfirming files a NETCONF commit request confirming a pending
+// confirmed commit with the remote host. persistID is required when the
+// confirmed commit was started with persist, possibly from another session.
+func MethodCommitConfirming(persistID string) RawMethod {
+	if persistID == "" {
+		return RawMethod("<commit/>")
+	}
+	return RawMethod(fmt.Sprintf("<commit><persist-id>%s</persist-id></commit>", escapeText(persistID)))
+}
+
+// MethodCancelCommit files a NETCONF cancel-commit request with the remote
+// host, aborting a pending confirmed commit. persistID is omitted when empty to
+// cancel a confirmed commit started by the current session.
+func MethodCancelCommit(persistID string) RawMethod {
+	if persistID == "" {
+		return RawMethod("<cancel-commit/>")
+	}
+	return RawMethod(fmt.Sprintf("<cancel-commit><persist-id>%s</persist-id></cancel-commit>", escapeText(persistID)))
+}
+
+// MethodGetSchema files a NETCONF monitoring get-schema request with the
+// remote host. version and format are omitted when empty.
+func MethodGetSchema(identifier, version, format string) RawMethod {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<get-schema xmlns="%s"><identifier>%s</identifier>`, monitoringNS, escapeText(identifier))
+	if version != "" {
+		fmt.Fprintf(&buf, "<version>%s</version>", escapeText(version))
+	}
+	if format != "" {
+		fmt.Fprintf(&buf, "<format>%s</format>", escapeText(format))
+	}
+	buf.WriteString("</get-schema>")
+	return RawMethod(buf.String())
+}
+
+// MethodGetData files a NMDA get-data request with the remote host.
+// datastore is a datastore identity such as Operational or "ds:operational",
+// the prefix is added when missing. filter is the content of a subtree filter and
+// withDefaults a with-defaults mode, both are omitted when empty.
+func MethodGetData(datastore Datastore, filter string, withDefaults string) RawMethod {
+	return MethodGetDataOpts(datastore, GetDataOptions{Filter: filter, WithDefaults: withDefaults})
+}
+
+// GetDataOptions holds the optional parameters of get-data, see
+// MethodGetData for Filter and WithDefaults.
+type GetDataOptions struct {
+	Filter       string
+	WithDefaults string
+	// WithOrigin requests the origin annotations of the operational
+	// datastore, see RPCReply.Origins
+	WithOrigin bool
+}
+
+// MethodGetDataOpts files a NMDA get-data request with the remote host using
+// the given options. See MethodGetData for datastore.
+func MethodGetDataOpts(datastore Datastore, opts GetDataOptions) RawMethod {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<get-data xmlns="%s" xmlns:ds="%s"><datastore>%s</datastore>`, nmdaNS, datastoresNS, datastoreIdentity(datastore))
+	if opts.Filter != "" {
+		fmt.Fprintf(&buf, "<subtree-filter>%s</subtree-filter>", opts.Filter)
+	}
+	if opts.WithOrigin {
+		buf.WriteString("<with-origin/>")
+	}
+	if opts.WithDefaults != "" {
+		fmt.Fprintf(&buf, `<with-defaults xmlns="%s">%s</with-defaults>`, withDefaultsNS, escapeText(opts.WithDefaults))
+	}
+	buf.WriteString("</get-data>")
+	return RawMethod(buf.String())
+}
+
+// MethodEditData files a NMDA edit-data request with the remote host. See
+// MethodGetData for datastore.
+func MethodEditData(datastore Datastore, config string) RawMethod {
+	return RawMethod(fmt.Sprintf(`<edit-data xmlns="%s" xmlns:ds="%s"><datastore>%s</datastore><config>%s</config></edit-data>`,
+		nmdaNS, datastoresNS, datastoreIdentity(datastore), config))
+}
+
+// datastoreIdentity returns datastore qualified with the ds prefix.
+func datastoreIdentity(datastore Datastore) string {
+	identity := string(datastore)
+	if !strings.Contains(identity, ":") {
+		identity = "ds:" + identity
+	}
+	return escapeText(identity)
+}
+
+// MethodPartialLock files a NETCONF partial-lock request with the remote host
+// locking the running configuration nodes selected by the XPath expressions.
+func MethodPartialLock(selectXPaths []string) RawMethod {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<partial-lock xmlns="%s">`, partialLockNS)
+	for _, sel := range selectXPaths {
+		fmt.Fprintf(&buf, "<select>%s</select>", escapeText(sel))
+	}
+	buf.WriteString("</partial-lock>")
+	return RawMethod(buf.String())
+}
+
+// MethodPartialUnlock files a NETCONF partial-unlock request with the remote
+// host releasing the lock returned by partial-lock.
+func MethodPartialUnlock(lockID uint32) RawMethod {
+	return RawMethod(fmt.Sprintf(`<partial-unlock xmlns="%s"><lock-id>%d</lock-id></partial-unlock>`, partialLockNS, lockID))
+}
+
+// MethodCloseSession files a NETCONF close-session request with the remote host
+func MethodCloseSession() RawMethod {
+	return RawMethod(`<close-session/>`)
+}
+
+// MethodKillSession files a NETCONF kill-session request for another session
+// with the remote host
+func MethodKillSession(sessionID uint32) RawMethod {
+	return RawMethod(fmt.Sprintf("<kill-session><session-id>%d</session-id></kill-session>", sessionID))
+}
+
+// MethodCopyConfig files a NETCONF copy-config request with the remote host.
+// target and source are datastores or, for devices supporting the :url
+// capability, URLs.
+func MethodCopyConfig(target, source Datastore) RawMethod {
+	return RawMethod(fmt.Sprintf("<copy-config><target>%s</target><source>%s</source></copy-config>",
+		configLocation(target), configLocation(source)))
+}
+
+// MethodDeleteConfig files a NETCONF delete-config request with the remote
+// host. target is a datastore or a URL.
+func MethodDeleteConfig(target Datastore) RawMethod {
+	return RawMethod(fmt.Sprintf("<delete-config><target>%s</target></delete-config>", configLocation(target)))
+}
+
+// contains reports whether values holds v.
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// isURL reports whether a datastore argument is a URL rather than a name.
+func isURL(location Datastore) bool {
+	return strings.Contains(string(location), "://")
+}
+
+// configLocation returns the element identifying a configuration datastore,
+// either the datastore element itself or an url element.
+func configLocation(location Datastore) string {
+	if isURL(location) {
+		return fmt.Sprintf("<url>%s</url>", escapeText(string(location)))
+	}
+	return datastoreElement(location)
+}
+
+// datastoreElement returns the empty element naming datastore. A name which
+// isn't an NCName, such as one carrying markup, gives no element: the server
+// rejects the request for the missing datastore instead of running injected
+// XML.
+func datastoreElement(datastore Datastore) string {
+	if !isNCName(string(datastore)) {
+		return ""
+	}
+	return fmt.Sprintf("<%s/>", datastore)
+}
+
+// escapeText returns s with XML special characters escaped so it can be used
+// as element content.
+func escapeText(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
 }
 
 var msgID = uuid
 
+// MonotonicMessageID returns a message-id generator yielding increasing
+// decimal integers starting at 1, for use with Session.SetMessageIDGenerator.
+// Each call returns an independent counter so sessions don't share it, and
+// the generator is safe for concurrent use.
+func MonotonicMessageID() func() string {
+	var n uint64
+	return func() string {
+		return strconv.FormatUint(atomic.AddUint64(&n, 1), 10)
+	}
+}
+
 // uuid generates a "good enough" uuid without adding external dependencies
 func uuid() string {
 	b := make([]byte, 16)
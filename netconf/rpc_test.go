@@ -8,8 +8,15 @@ package netconf
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -76,6 +83,101 @@ func TestRPCErrorError(t *testing.T) {
 	}
 }
 
+func TestRPCErrorErrorDetails(t *testing.T) {
+	rpcErr := RPCError{
+		Severity: "error",
+		AppTag:   "too-big",
+		Message:  "cats",
+		Info:     map[string]string{"bad-element": "mtu"},
+	}
+	expected := "netconf rpc [error] 'cats' (app-tag: too-big, bad-element: mtu)"
+
+	errMsg := rpcErr.Error()
+	if errMsg != expected {
+		t.Errorf("expected: %s, got: %s", expected, errMsg)
+	}
+}
+
+func TestNewRPCReplyErrorInfo(t *testing.T) {
+	rawXML := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<rpc-error>
+<error-type>protocol</error-type>
+<error-tag>lock-denied</error-tag>
+<error-severity>error</error-severity>
+<error-app-tag>locked</error-app-tag>
+<error-info>
+<session-id>454</session-id>
+<bad-element>running</bad-element>
+</error-info>
+</rpc-error>
+</rpc-reply>`
+
+	reply, err := newRPCReply([]byte(rawXML), false, "101")
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	expected := RPCError{
+		Type:     "protocol",
+		Tag:      "lock-denied",
+		Severity: "error",
+		AppTag:   "locked",
+		Info:     map[string]string{"session-id": "454", "bad-element": "running"},
+	}
+	if !cmp.Equal(reply.Errors, []RPCError{expected}) {
+		t.Errorf("unexpected errors:\n%s", cmp.Diff([]RPCError{expected}, reply.Errors))
+	}
+}
+
+func TestLockDeniedError(t *testing.T) {
+	lockDenied := `<rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity>%s</rpc-error>`
+	inUse := `<rpc-error><error-type>protocol</error-type><error-tag>in-use</error-tag><error-severity>error</error-severity></rpc-error>`
+
+	tests := []struct {
+		name      string
+		errors    string
+		lockErr   bool
+		sessionID uint32
+	}{
+		{"holder", fmt.Sprintf(lockDenied, "<error-info><session-id>454</session-id></error-info>"), true, 454},
+		{"non-NETCONF holder", fmt.Sprintf(lockDenied, "<error-info><session-id>0</session-id></error-info>"), true, 0},
+		{"no error-info", fmt.Sprintf(lockDenied, ""), true, 0},
+		{"among errors", inUse + fmt.Sprintf(lockDenied, "<error-info><session-id>7</session-id></error-info>"), true, 7},
+		{"other error", inUse, false, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rawXML := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + tc.errors + `</rpc-reply>`
+			_, err := newRPCReply([]byte(rawXML), false, "101")
+
+			var lockErr *LockDeniedError
+			if got := errors.As(err, &lockErr); got != tc.lockErr {
+				t.Fatalf("got lock-denied %t, expected %t for %v", got, tc.lockErr, err)
+			}
+			if !tc.lockErr {
+				return
+			}
+			if lockErr.SessionID != tc.sessionID {
+				t.Errorf("got session-id %d, expected %d", lockErr.SessionID, tc.sessionID)
+			}
+
+			// the rpc-error is still available
+			if rpcErr := FirstRPCError(err); rpcErr == nil {
+				t.Errorf("expected an rpc-error in %v", err)
+			}
+		})
+	}
+
+	// a single lock-denied error is returned as *RPCError like any other
+	rawXML := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + fmt.Sprintf(lockDenied, "") + `</rpc-reply>`
+	if _, err := newRPCReply([]byte(rawXML), false, "101"); err == nil {
+		t.Errorf("expected an error")
+	} else if _, ok := err.(*RPCError); !ok {
+		t.Errorf("got %T, expected *RPCError", err)
+	}
+}
+
 func TestMethodLock(t *testing.T) {
 	expected := "<lock><target><what.target/></target></lock>"
 
@@ -103,7 +205,43 @@ func TestMethodGetConfig(t *testing.T) {
 	}
 }
 
+// injectedDatastore closes the lock request to send a kill-session.
+const injectedDatastore = "running/></target></lock><kill-session><session-id>1</session-id></kill-session><lock><target><x"
+
 // TestUUIDLength verifies that UUID length is cor([a-zA-Z]|\d|-)rect
+func TestMethodEscaping(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		// unknown filter types give a filter the server rejects
+		{MethodGet(`subtree"><kill-session/><filter type="`, "<top/>"), `<get><filter type="xpath"/></get>`},
+		{MethodGet("Subtree", "<top/>"), `<get><filter type="xpath"/></get>`},
+		{MethodGetConfigFiltered("running", "", "<top/>"), `<get-config><source><running/></source><filter type="xpath"/></get-config>`},
+		{MethodGet("xpath", `/top[name="a"]`), `<get><filter type="xpath" select="/top[name=&#34;a&#34;]"/></get>`},
+		// datastores which aren't NCNames are left out
+		{MethodLock(injectedDatastore), `<lock><target></target></lock>`},
+		{MethodUnlock(injectedDatastore), `<unlock><target></target></unlock>`},
+		{MethodGetConfig("running/><x"), `<get-config><source></source></get-config>`},
+		{MethodGetConfigFiltered("a&b", "subtree", "<top/>"), `<get-config><source></source><filter type="subtree"><top/></filter></get-config>`},
+		{MethodGetConfigWithDefaults(`"running"`, "trim"), `<get-config><source></source><with-defaults xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults">trim</with-defaults></get-config>`},
+		{MethodEditConfigOpts("candidate><x", "<top/>", EditConfigOptions{}), `<edit-config><target></target><config><top/></config></edit-config>`},
+		{MethodEditConfigURL("run ning", "file:///a"), `<edit-config><target></target><url>file:///a</url></edit-config>`},
+		{MethodValidate(""), `<validate><source></source></validate>`},
+		{MethodCopyConfig("startup", injectedDatastore), `<copy-config><target><startup/></target><source></source></copy-config>`},
+		{MethodDeleteConfig("<startup/>"), `<delete-config><target></target></delete-config>`},
+		{MethodDeleteConfig(`ftp://host/a?b=1&c="2"`), `<delete-config><target><url>ftp://host/a?b=1&amp;c=&#34;2&#34;</url></target></delete-config>`},
+		{MethodEditConfigOpts("candidate", "<top/>", EditConfigOptions{DefaultOperation: "</default-operation>"}),
+			`<edit-config><target><candidate/></target><default-operation>&lt;/default-operation&gt;</default-operation><config><top/></config></edit-config>`},
+	}
+
+	for _, tc := range tt {
+		if got := string(tc.method); got != tc.expected {
+			t.Errorf("got %s, expected %s", got, tc.expected)
+		}
+	}
+}
+
 func TestUUIDLength(t *testing.T) {
 	expectedLength := 36
 
@@ -116,6 +254,39 @@ func TestUUIDLength(t *testing.T) {
 }
 
 // TestUUIDChat verifies that UUID contains ASCII letter/number and delimiter
+func TestMonotonicMessageID(t *testing.T) {
+	gen := MonotonicMessageID()
+	for i := 1; i <= 3; i++ {
+		if id := gen(); id != strconv.Itoa(i) {
+			t.Errorf("got %s, expected %d", id, i)
+		}
+	}
+
+	if id := MonotonicMessageID()(); id != "1" {
+		t.Errorf("generators share their counter, got %s", id)
+	}
+
+	var wg sync.WaitGroup
+	seen := make([]string, 100)
+	gen = MonotonicMessageID()
+	for i := range seen {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			seen[i] = gen()
+		}(i)
+	}
+	wg.Wait()
+
+	unique := map[string]bool{}
+	for _, id := range seen {
+		unique[id] = true
+	}
+	if len(unique) != len(seen) {
+		t.Errorf("got %d unique ids, expected %d", len(unique), len(seen))
+	}
+}
+
 func TestUUIDChar(t *testing.T) {
 	//validChars := regexp.MustCompile("([a-zA-Z]|\\d|-)")
 
@@ -218,6 +389,17 @@ configuration check-out failed: (missing mandatory statements)
 </routing-engine>
 </commit-results>
 <ok/>
+</rpc-reply>`,
+		true,
+	},
+	{
+		`
+<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<data>
+<commit-results xmlns="urn:example:audit">
+<error><message>rolled back</message></error>
+</commit-results>
+</data>
 </rpc-reply>`,
 		true,
 	},
@@ -232,5 +414,680 @@ func TestNewRPCReply(t *testing.T) {
 		if reply.MessageID != "101" {
 			t.Errorf("newRPCReply(%q) did not set message-id to input, got %q", "101", reply.MessageID)
 		}
+		if string(reply.Raw) != tc.rawXML {
+			t.Errorf("newRPCReply did not keep the raw reply, got %q", reply.Raw)
+		}
+	}
+}
+
+func TestNewRPCReplyMalformed(t *testing.T) {
+	tt := []string{
+		"",
+		"  \n\t",
+		`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"/>`,
+		`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">  </rpc-reply>`,
+		`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"/>`,
+	}
+
+	for _, rawXML := range tt {
+		if _, err := newRPCReply([]byte(rawXML), false, ""); !errors.Is(err, ErrMalformedReply) {
+			t.Errorf("%q: got %v, expected %v", rawXML, err, ErrMalformedReply)
+		}
+	}
+}
+
+func TestNewRPCReplyOk(t *testing.T) {
+	reply, err := newRPCReply([]byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="101"><ok/></rpc-reply>`), false, "101")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reply.Ok {
+		t.Errorf("expected ok reply")
+	}
+	if el := reply.DataElement(); el != nil {
+		t.Errorf("unexpected data element %v", el)
+	}
+}
+
+func TestRPCReplyDataElement(t *testing.T) {
+	rawXML := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="101"><data><top xmlns="urn:top"/></data></rpc-reply>`
+	reply, err := newRPCReply([]byte(rawXML), false, "101")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if el := reply.DataElement(); el == nil || el.Tag != "data" {
+		t.Fatalf("unexpected data element %v", el)
+	}
+
+	// the document is left intact
+	got, err := reply.Data.WriteToString()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != rawXML {
+		t.Errorf("got %s, expected %s", got, rawXML)
+	}
+}
+
+func TestExecContextCancel(t *testing.T) {
+	trans, _, _ := newPipeTransportTest()
+	s := &Session{Transport: trans}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := s.ExecContext(ctx, MethodGetConfig("running"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// the transport was closed with the request
+	if _, err := s.ExecContext(context.Background(), MethodGetConfig("running")); err != ErrSessionClosed {
+		t.Errorf("got %v, expected %v", err, ErrSessionClosed)
+	}
+}
+
+func TestExecContext(t *testing.T) {
+	trans, _ := newTransportTest(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>]]>]]>`)
+	s := &Session{Transport: trans}
+
+	reply, err := s.ExecContext(context.Background(), MethodLock("candidate"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reply.Ok {
+		t.Errorf("expected ok reply")
+	}
+}
+
+func TestMethodKillSession(t *testing.T) {
+	expected := "<kill-session><session-id>4</session-id></kill-session>"
+
+	mKill := MethodKillSession(4)
+	if mKill.MarshalMethod() != expected {
+		t.Errorf("got %s, expected %s", mKill, expected)
+	}
+}
+
+func TestMethodCopyConfig(t *testing.T) {
+	tt := []struct {
+		target   Datastore
+		source   Datastore
+		expected string
+	}{
+		{"startup", "running", "<copy-config><target><startup/></target><source><running/></source></copy-config>"},
+		{"ftp://host/backup?a=1&b=2", "running", "<copy-config><target><url>ftp://host/backup?a=1&amp;b=2</url></target><source><running/></source></copy-config>"},
+		{"candidate", "file:///backup.xml", "<copy-config><target><candidate/></target><source><url>file:///backup.xml</url></source></copy-config>"},
+	}
+
+	for _, tc := range tt {
+		mCopy := MethodCopyConfig(tc.target, tc.source)
+		if mCopy.MarshalMethod() != tc.expected {
+			t.Errorf("got %s, expected %s", mCopy, tc.expected)
+		}
+	}
+}
+
+func TestMethodDeleteConfig(t *testing.T) {
+	expected := "<delete-config><target><startup/></target></delete-config>"
+
+	mDelete := MethodDeleteConfig("startup")
+	if mDelete.MarshalMethod() != expected {
+		t.Errorf("got %s, expected %s", mDelete, expected)
+	}
+}
+
+func TestMethodCommitConfirmed(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		{MethodCommitConfirmed(0, "", ""), "<commit><confirmed/></commit>"},
+		{MethodCommitConfirmed(120, "tok", ""), "<commit><confirmed/><confirm-timeout>120</confirm-timeout><persist>tok</persist></commit>"},
+		{MethodCommitConfirmed(60, "", "tok"), "<commit><confirmed/><confirm-timeout>60</confirm-timeout><persist-id>tok</persist-id></commit>"},
+		{MethodCommitConfirming(""), "<commit/>"},
+		{MethodCommitStandard(), "<commit/>"},
+		{MethodCommitWithComment("maintenance & fixes"), "<commit><comment>maintenance &amp; fixes</comment></commit>"},
+		{MethodCommitConfirming("a&b"), "<commit><persist-id>a&amp;b</persist-id></commit>"},
+		{MethodCancelCommit(""), "<cancel-commit/>"},
+		{MethodCancelCommit("tok"), "<cancel-commit><persist-id>tok</persist-id></cancel-commit>"},
+	}
+
+	for _, tc := range tt {
+		if tc.method.MarshalMethod() != tc.expected {
+			t.Errorf("got %s, expected %s", tc.method, tc.expected)
+		}
+	}
+}
+
+func TestMethodGetSchema(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		{MethodGetSchema("ietf-interfaces", "", ""), `<get-schema xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><identifier>ietf-interfaces</identifier></get-schema>`},
+		{MethodGetSchema("ietf-interfaces", "2018-02-20", "yang"), `<get-schema xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><identifier>ietf-interfaces</identifier><version>2018-02-20</version><format>yang</format></get-schema>`},
+	}
+
+	for _, tc := range tt {
+		if tc.method.MarshalMethod() != tc.expected {
+			t.Errorf("got %s, expected %s", tc.method, tc.expected)
+		}
+	}
+}
+
+func TestRPCReplySchemaText(t *testing.T) {
+	rawXML := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="101">
+<data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring">
+module foo {
+  namespace "urn:foo";
+  description "a &lt; b";
+}
+</data>
+</rpc-reply>`
+	expected := "module foo {\n  namespace \"urn:foo\";\n  description \"a < b\";\n}"
+
+	reply, err := newRPCReply([]byte(rawXML), false, "101")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	text, err := reply.SchemaText()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if text != expected {
+		t.Errorf("unexpected schema text (want %q, got %q)", expected, text)
+	}
+}
+
+func TestMethodGetFilter(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		{MethodGet("subtree", "<top/>"), `<get><filter type="subtree"><top/></filter></get>`},
+		{MethodGet("subtree", ""), `<get/>`},
+		{MethodGetAll(), `<get/>`},
+		{MethodGet("xpath", `/t:top/t:users/t:user[t:name="fred"]`), `<get><filter type="xpath" select="/t:top/t:users/t:user[t:name=&#34;fred&#34;]"/></get>`},
+		{MethodGetConfigFiltered("running", "subtree", "<top/>"), `<get-config><source><running/></source><filter type="subtree"><top/></filter></get-config>`},
+		{MethodGetConfigFiltered("candidate", "xpath", "/a<b"), `<get-config><source><candidate/></source><filter type="xpath" select="/a&lt;b"/></get-config>`},
+	}
+
+	for _, tc := range tt {
+		if tc.method.MarshalMethod() != tc.expected {
+			t.Errorf("got %s, expected %s", tc.method, tc.expected)
+		}
+	}
+}
+
+func TestNewRPCReplyMultipleErrors(t *testing.T) {
+	// second entry of RPCReplytests holds two errors
+	_, err := newRPCReply([]byte(RPCReplytests[1].rawXML), false, "101")
+
+	errs, ok := err.(RPCErrors)
+	if !ok {
+		t.Fatalf("expected RPCErrors, got %T", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d", len(errs))
+	}
+
+	expected := "netconf rpc 2 errors: [error] [edit] 'mgd: Missing mandatory statement: 'root-authentication''; [error] 'configuration check-out failed: (missing mandatory statements)'"
+	if err.Error() != expected {
+		t.Errorf("expected: %s, got: %s", expected, err.Error())
+	}
+
+	first := FirstRPCError(err)
+	if first == nil || first.Tag != "invalid-value" {
+		t.Errorf("unexpected first error %v", first)
+	}
+}
+
+func TestNewRPCReplyWarnings(t *testing.T) {
+	// third entry of RPCReplytests holds two warnings
+	_, err := newRPCReply([]byte(RPCReplytests[2].rawXML), true, "101")
+
+	errs, ok := err.(RPCErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected 2 warnings as RPCErrors, got %v", err)
+	}
+}
+
+func TestWarningHandler(t *testing.T) {
+	reply := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity>warning</error-severity><error-message>interface is down</error-message></rpc-error><ok/></rpc-reply>`
+
+	for _, errOnWarning := range []bool{false, true} {
+		s, _ := newMemorySession(t, reply)
+		s.ErrOnWarning = errOnWarning
+		var warnings []string
+		s.WarningHandler = func(rpcErr RPCError) {
+			warnings = append(warnings, rpcErr.Message)
+		}
+
+		_, err := s.Exec(MethodUnlock("candidate"))
+		if (err != nil) != errOnWarning {
+			t.Errorf("ErrOnWarning %v: unexpected error: %v", errOnWarning, err)
+		}
+		if diff := cmp.Diff([]string{"interface is down"}, warnings); diff != "" {
+			t.Errorf("ErrOnWarning %v: unexpected warnings (-want +got):\n%s", errOnWarning, diff)
+		}
+	}
+}
+
+func TestRPCReplyUnmarshal(t *testing.T) {
+	type Interface struct {
+		Name    string `xml:"name"`
+		Enabled bool   `xml:"enabled"`
+	}
+	type Interfaces struct {
+		XMLName    xml.Name    `xml:"urn:ietf:params:xml:ns:yang:ietf-interfaces interfaces"`
+		Interfaces []Interface `xml:"interface"`
+	}
+
+	rawXML := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" message-id="101">
+<data>
+<if:interfaces>
+<if:interface><if:name>eth0</if:name><if:enabled>true</if:enabled></if:interface>
+<if:interface><if:name>eth1</if:name><if:enabled>false</if:enabled></if:interface>
+</if:interfaces>
+</data>
+</rpc-reply>`
+
+	reply, err := newRPCReply([]byte(rawXML), false, "101")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var cfg Interfaces
+	if err := reply.Unmarshal(&cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Interface{{"eth0", true}, {"eth1", false}}
+	if !cmp.Equal(cfg.Interfaces, expected) {
+		t.Errorf("unexpected interfaces:\n%s", cmp.Diff(expected, cfg.Interfaces))
+	}
+}
+
+func TestRPCReplyUnmarshalNoData(t *testing.T) {
+	reply, err := newRPCReply([]byte(RPCReplytests[0].rawXML), false, "101")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var v struct{}
+	if err := reply.Unmarshal(&v); err == nil {
+		t.Errorf("expected error for reply without data")
+	}
+
+	reply, _ = newRPCReply([]byte(RPCReplytests[1].rawXML), false, "101")
+	if err := reply.Unmarshal(&v); err == nil {
+		t.Errorf("expected error for reply with rpc-errors")
+	}
+}
+
+func TestExecMessageIDMismatch(t *testing.T) {
+	origMsgID := msgID
+	msgID = func() string { return "101" }
+	defer func() { msgID = origMsgID }()
+
+	tt := []struct {
+		name   string
+		reply  string
+		ignore bool
+		err    error
+	}{
+		{
+			name:  "match",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="101"><ok/></rpc-reply>]]>]]>`,
+		},
+		{
+			name:  "mismatch",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="102"><ok/></rpc-reply>]]>]]>`,
+			err:   ErrMessageIDMismatch,
+		},
+		{
+			name:   "ignored",
+			reply:  `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="102"><ok/></rpc-reply>]]>]]>`,
+			ignore: true,
+		},
+		{
+			name:  "missing",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>]]>]]>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.reply)
+			s := &Session{Transport: trans, IgnoreMessageID: tc.ignore}
+
+			_, err := s.Exec(MethodLock("candidate"))
+			if !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error (want %v, got %v)", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestMethodGetConfigWithDefaults(t *testing.T) {
+	expected := `<get-config><source><running/></source><with-defaults xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults">report-all</with-defaults></get-config>`
+
+	m := MethodGetConfigWithDefaults("running", "report-all")
+	if m.MarshalMethod() != expected {
+		t.Errorf("got %s, expected %s", m, expected)
+	}
+}
+
+func TestMethodNMDA(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		{
+			MethodGetData("operational", "", ""),
+			`<get-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda" xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores"><datastore>ds:operational</datastore></get-data>`,
+		},
+		{
+			MethodGetData("ds:running", "<interfaces/>", "report-all"),
+			`<get-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda" xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores"><datastore>ds:running</datastore><subtree-filter><interfaces/></subtree-filter><with-defaults xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults">report-all</with-defaults></get-data>`,
+		},
+		{
+			MethodGetDataOpts(Operational, GetDataOptions{Filter: "<interfaces/>", WithOrigin: true}),
+			`<get-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda" xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores"><datastore>ds:operational</datastore><subtree-filter><interfaces/></subtree-filter><with-origin/></get-data>`,
+		},
+		{
+			MethodEditData("ds:intended", "<interfaces/>"),
+			`<edit-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda" xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores"><datastore>ds:intended</datastore><config><interfaces/></config></edit-data>`,
+		},
+	}
+
+	for _, tc := range tt {
+		if tc.method.MarshalMethod() != tc.expected {
+			t.Errorf("got %s, expected %s", tc.method, tc.expected)
+		}
+	}
+}
+
+func TestMethodPartialLock(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		{
+			MethodPartialLock([]string{"/if:interfaces/if:interface[if:name='eth0']", "/top"}),
+			`<partial-lock xmlns="urn:ietf:params:xml:ns:netconf:partial-lock:1.0"><select>/if:interfaces/if:interface[if:name=&#39;eth0&#39;]</select><select>/top</select></partial-lock>`,
+		},
+		{
+			MethodPartialUnlock(127),
+			`<partial-unlock xmlns="urn:ietf:params:xml:ns:netconf:partial-lock:1.0"><lock-id>127</lock-id></partial-unlock>`,
+		},
+	}
+
+	for _, tc := range tt {
+		if tc.method.MarshalMethod() != tc.expected {
+			t.Errorf("got %s, expected %s", tc.method, tc.expected)
+		}
+	}
+}
+
+func TestRPCReplyLockID(t *testing.T) {
+	rawXML := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="101">
+<lock-id xmlns="urn:ietf:params:xml:ns:netconf:partial-lock:1.0">127</lock-id>
+<locked-node xmlns="urn:ietf:params:xml:ns:netconf:partial-lock:1.0">/top</locked-node>
+</rpc-reply>`
+
+	reply, err := newRPCReply([]byte(rawXML), false, "101")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	id, err := reply.LockID()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != 127 {
+		t.Errorf("unexpected lock-id (want %d, got %d)", 127, id)
+	}
+}
+
+func TestRPCReplyDataString(t *testing.T) {
+	tt := []struct {
+		name     string
+		rawXML   string
+		expected string
+		err      bool
+	}{
+		{
+			name: "indented",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces"><data>` +
+				`<if:interfaces><if:interface><if:name>eth0</if:name></if:interface></if:interfaces>` +
+				`<system xmlns="urn:sys"><hostname>r1</hostname></system></data></rpc-reply>`,
+			expected: `<if:interfaces xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces">
+  <if:interface>
+    <if:name>eth0</if:name>
+  </if:interface>
+</if:interfaces>
+<system xmlns="urn:sys" xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces">
+  <hostname>r1</hostname>
+</system>
+`,
+		},
+		{
+			name:   "empty",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data/></rpc-reply>`,
+		},
+		{
+			name:   "no data",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`,
+			err:    true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reply, err := newRPCReply([]byte(tc.rawXML), false, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, err := reply.DataString()
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRPCReplyValue(t *testing.T) {
+	rawXML := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" message-id="101"><data>
+<if:interfaces>
+<if:interface><if:name>eth0</if:name><if:description/><if:mtu> 1500 </if:mtu></if:interface>
+<if:interface><if:name>eth1</if:name><if:mtu>9000</if:mtu></if:interface>
+</if:interfaces>
+</data></rpc-reply>`
+	reply, err := newRPCReply([]byte(rawXML), false, "101")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tt := []struct {
+		path     string
+		expected string
+		err      bool
+	}{
+		{path: "//interface[name='eth1']/mtu", expected: "9000"},
+		{path: "//if:interface[if:name='eth0']/if:mtu", expected: "1500"},
+		{path: "//interface[namespace-uri()='urn:ietf:params:xml:ns:yang:ietf-interfaces']/name", expected: "eth0"},
+		{path: "//interface/description", expected: ""},
+		{path: "//interface[name='eth2']/mtu", err: true},
+		{path: "//x:interface", err: true},
+		{path: "//interface[", err: true},
+	}
+	for _, tc := range tt {
+		got, err := reply.Value(tc.path)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: unexpected error: %v", tc.path, err)
+		}
+		if got != tc.expected {
+			t.Errorf("%s: got %q, expected %q", tc.path, got, tc.expected)
+		}
+	}
+
+	if diff := cmp.Diff([]string{"eth0", "eth1"}, reply.Values("//if:name")); diff != "" {
+		t.Errorf("unexpected values (-want +got):\n%s", diff)
+	}
+	if got := reply.Values("//vlan"); got != nil {
+		t.Errorf("unexpected values %v", got)
+	}
+}
+
+func TestMethodEditConfigOpts(t *testing.T) {
+	tt := []struct {
+		opts     EditConfigOptions
+		expected string
+	}{
+		{
+			EditConfigOptions{},
+			`<edit-config><target><candidate/></target><config><top/></config></edit-config>`,
+		},
+		{
+			EditConfigOptions{DefaultOperation: "none", ErrorOption: "continue-on-error", TestOption: "test-only"},
+			`<edit-config><target><candidate/></target><default-operation>none</default-operation><test-option>test-only</test-option><error-option>continue-on-error</error-option><config><top/></config></edit-config>`,
+		},
+	}
+
+	for _, tc := range tt {
+		m := MethodEditConfigOpts("candidate", "<top/>", tc.opts)
+		if m.MarshalMethod() != tc.expected {
+			t.Errorf("got %s, expected %s", m, tc.expected)
+		}
+	}
+}
+
+func TestMethodEditConfigURL(t *testing.T) {
+	expected := `<edit-config><target><running/></target><url>https://example.com/cfg?a=1&amp;b=2</url></edit-config>`
+	if m := MethodEditConfigURL("running", "https://example.com/cfg?a=1&b=2"); m.MarshalMethod() != expected {
+		t.Errorf("got %s, expected %s", m, expected)
+	}
+}
+
+func TestMethodValidateConfig(t *testing.T) {
+	expected := `<validate><source><config><top xmlns="urn:example"/></config></source></validate>`
+	if m := MethodValidateConfig(`<top xmlns="urn:example"/>`); m.MarshalMethod() != expected {
+		t.Errorf("got %s, expected %s", m, expected)
+	}
+}
+
+func TestIndentXML(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		indent   string
+		expected string
+	}{
+		{
+			name:     "elements",
+			data:     `<rpc message-id="1"><get-config><source><running/></source></get-config></rpc>`,
+			indent:   "  ",
+			expected: "<rpc message-id=\"1\">\n  <get-config>\n    <source>\n      <running/>\n    </source>\n  </get-config>\n</rpc>",
+		},
+		{
+			name:     "tabs",
+			data:     `<rpc><lock><target><candidate/></target></lock></rpc>`,
+			indent:   "\t",
+			expected: "<rpc>\n\t<lock>\n\t\t<target>\n\t\t\t<candidate/>\n\t\t</target>\n\t</lock>\n</rpc>",
+		},
+		{
+			name:     "text",
+			data:     "<rpc><command format=\"text\">show  interfaces\n terse </command><exec>  </exec></rpc>",
+			indent:   "  ",
+			expected: "<rpc>\n  <command format=\"text\">show  interfaces\n terse </command>\n  <exec>  </exec>\n</rpc>",
+		},
+		{
+			name:     "mixed",
+			data:     "<rpc><load-configuration><configuration-text>system {\n<x/> }</configuration-text></load-configuration></rpc>",
+			indent:   "  ",
+			expected: "<rpc>\n  <load-configuration>\n    <configuration-text>system {\n<x/> }</configuration-text>\n  </load-configuration>\n</rpc>",
+		},
+		{
+			name:     "reindent",
+			data:     "<rpc>\n    <get/>\n</rpc>",
+			indent:   "  ",
+			expected: "<rpc>\n  <get/>\n</rpc>",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := indentXML([]byte(tc.data), tc.indent)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("got %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestPrettyRequests(t *testing.T) {
+	s, trans := newMemorySession(t, testOkReply, testOkReply)
+
+	if _, err := s.Exec(MethodLock(Candidate)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if request := string(trans.Sent()[1]); strings.Contains(request, "\n ") {
+		t.Errorf("expected compact request, got %s", request)
+	}
+
+	s.PrettyRequests = true
+	if _, err := s.Exec(MethodLock(Candidate)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	request := string(trans.Sent()[2])
+	if !strings.HasPrefix(request, xml.Header) {
+		t.Errorf("expected XML header, got %s", request)
+	}
+	if !strings.Contains(request, "\n  <lock>\n    <target>\n      <candidate/>") {
+		t.Errorf("expected indented request, got %s", request)
+	}
+}
+
+func TestXMLDeclaration(t *testing.T) {
+	tests := []struct {
+		name        string
+		declaration string
+		omit        bool
+		expected    string
+	}{
+		{name: "default", expected: xml.Header},
+		{name: "custom", declaration: `<?xml version="1.0" encoding="utf-8"?>`, expected: `<?xml version="1.0" encoding="utf-8"?>`},
+		{name: "omit", omit: true, expected: ""},
+		{name: "omit custom", declaration: `<?xml version="1.0"?>`, omit: true, expected: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, trans := newMemorySession(t, testOkReply)
+			s.XMLDeclaration = tc.declaration
+			s.OmitXMLDeclaration = tc.omit
+
+			if _, err := s.Exec(MethodLock(Candidate)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if hello := string(trans.Sent()[0]); !strings.HasPrefix(hello, xml.Header) {
+				t.Errorf("expected hello with XML header, got %s", hello)
+			}
+			request := string(trans.Sent()[1])
+			if !strings.HasPrefix(request, tc.expected+"<rpc ") {
+				t.Errorf("got %s, expected prefix %s", request, tc.expected)
+			}
+		})
 	}
 }
@@ -11,48 +11,674 @@ Package netconf provides support for a a simple NETCONF client based on RFC6241
 package netconf
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const (
+	// capBase10 is the capability every peer must advertise
+	capBase10 = "urn:ietf:params:netconf:base:1.0"
+	// capBase11 is the capability advertised by peers supporting chunked framing
+	capBase11 = "urn:ietf:params:netconf:base:1.1"
+	// capURL is advertised by servers accepting URLs as configuration source
+	// and target
+	capURL = "urn:ietf:params:netconf:capability:url:1.0"
+	// capValidate10 and capValidate11 are advertised by servers supporting
+	// validate and the test-option of edit-config
+	capValidate10 = "urn:ietf:params:netconf:capability:validate:1.0"
+	capValidate11 = "urn:ietf:params:netconf:capability:validate:1.1"
+	// capXPath is advertised by servers accepting XPath filters
+	capXPath = "urn:ietf:params:netconf:capability:xpath:1.0"
+	// capConfirmedCommit10 and capConfirmedCommit11 are advertised by servers
+	// supporting confirmed commits, persist requires 1.1
+	capConfirmedCommit10 = "urn:ietf:params:netconf:capability:confirmed-commit:1.0"
+	capConfirmedCommit11 = "urn:ietf:params:netconf:capability:confirmed-commit:1.1"
+	// capWithDefaults is advertised by servers supporting with-defaults, its
+	// basic-mode and also-supported parameters list the supported modes
+	capWithDefaults = "urn:ietf:params:netconf:capability:with-defaults:1.0"
+	// capPartialLock is advertised by servers supporting partial-lock
+	capPartialLock = "urn:ietf:params:netconf:capability:partial-lock:1.0"
+	// capCandidate and capStartup are advertised by servers having the
+	// candidate and startup datastores
+	capCandidate = "urn:ietf:params:netconf:capability:candidate:1.0"
+	capStartup   = "urn:ietf:params:netconf:capability:startup:1.0"
+	// capWritableRunning is advertised by servers accepting edits of running
+	capWritableRunning = "urn:ietf:params:netconf:capability:writable-running:1.0"
+)
+
+// ErrSessionClosed is returned when using a session that was already closed.
+var ErrSessionClosed = errors.New("session closed")
+
+// ErrSessionIdle is returned when using a session whose transport was closed
+// after IdleTimeout without activity.
+var ErrSessionIdle = errors.New("session closed after idle timeout")
+
+// ErrHelloTimeout is returned when the hello exchange doesn't complete within
+// SessionConfig.HelloTimeout.
+var ErrHelloTimeout = errors.New("timeout waiting for the server hello")
+
 // Session defines the necessary components for a NETCONF session
 type Session struct {
-	Transport          Transport
-	SessionID          int
-	ServerCapabilities []string
-	ErrOnWarning       bool
+	// stats comes first for the 64-bit alignment of its atomic counters
+	stats sessionStats
+
+	Transport    Transport
+	ErrOnWarning bool
+	// WarningHandler is called with every rpc-error of severity warning of
+	// the replies, whether ErrOnWarning is set or not, e.g. to log them
+	WarningHandler func(RPCError)
+	// IgnoreMessageID disables checking that replies carry the message-id of
+	// the request, for devices that don't echo it correctly
+	IgnoreMessageID bool
+	// Metrics receives the measurements of the requests and notifications
+	// when set
+	Metrics Metrics
+	// PrettyRequests indents the XML of the requests with RequestIndent, two
+	// spaces by default, instead of sending it compact. Elements holding text
+	// are not altered.
+	PrettyRequests bool
+	RequestIndent  string
+	// XMLDeclaration replaces the XML declaration prepended to the requests,
+	// xml.Header by default, e.g. to use another encoding name. It doesn't
+	// apply to the hello.
+	XMLDeclaration string
+	// OmitXMLDeclaration sends the requests without XML declaration, for
+	// devices only accepting it in the hello
+	OmitXMLDeclaration bool
+	// VendorDatastores are the vendor specific datastores, such as
+	// "scratch", the operations accept besides the standard ones. get-data
+	// and edit-data identities are listed with their prefix, e.g.
+	// "acme:scratch".
+	VendorDatastores []Datastore
+	// IdleTimeout closes the transport when no request was outstanding and no
+	// message was received for that long, e.g. for pools not to keep sessions
+	// the server already dropped. Using the session afterwards returns
+	// ErrSessionIdle. The countdown starts with the first reply, or once the
+	// session is established with SessionConfig.IdleTimeout, and is disabled
+	// when zero.
+	IdleTimeout time.Duration
+
+	sessionID          uint32
+	serverCapabilities []string
+	clientCapabilities []string
+	framing            FramingVersion
+	// closed is set atomically once the session is closed, see isClosed
+	closed uint32
+
+	// mu guards pipeline which is set once the session is pipelined, the
+	// message-id generator and the tracer
+	mu        sync.Mutex
+	pipeline  *pipeline
+	messageID func() string
+	tracer    func(direction string, data []byte)
+
+	// idleMu guards the idle timer and state, idleBusy counts the requests
+	// outstanding
+	idleMu       sync.Mutex
+	idleTimer    *time.Timer
+	idleDeadline time.Time
+	idleBusy     int
+	idle         bool
 }
 
-// Close is used to close and end a transport session
+// FramingVersion identifies the message framing used by a session after the
+// hello exchange.
+type FramingVersion int
+
+const (
+	// FramingV10 is the RFC 4742 end-of-message delimiter framing
+	FramingV10 FramingVersion = iota
+	// FramingV11 is the RFC 6242 chunked framing
+	FramingV11
+)
+
+func (f FramingVersion) String() string {
+	if f == FramingV11 {
+		return "v1.1"
+	}
+	return "v1.0"
+}
+
+// FramingVersion returns the framing negotiated during the hello exchange.
+func (s *Session) FramingVersion() FramingVersion {
+	return s.framing
+}
+
+// Close is used to close and end a transport session without notifying the
+// server. Use CloseSession to end the session gracefully.
 func (s *Session) Close() error {
+	if s.Transport == nil || !s.markClosed() {
+		return ErrSessionClosed
+	}
+	if s.stopIdleTimer() {
+		// the transport is already closed
+		return nil
+	}
 	return s.Transport.Close()
 }
 
-// Exec is used to execute an RPC method or methods
+// CloseSession gracefully ends the session by sending a close-session
+// request, waiting for the server to acknowledge it, and closing the
+// transport. The transport is closed even if the request fails. Calling it on
+// an already closed session returns ErrSessionClosed.
+func (s *Session) CloseSession(ctx context.Context) (*RPCReply, error) {
+	if s.isClosed() || s.Transport == nil {
+		return nil, ErrSessionClosed
+	}
+
+	reply, err := s.ExecContext(ctx, MethodCloseSession())
+	if err == nil && !reply.Ok {
+		err = fmt.Errorf("close-session not acknowledged")
+	}
+
+	s.markClosed()
+	// The server drops the connection after replying, so an EOF while
+	// tearing down the transport is expected.
+	if cerr := s.Transport.Close(); err == nil && cerr != nil && cerr != io.EOF {
+		err = cerr
+	}
+	return reply, err
+}
+
+// isClosed reports whether the session was closed, it is safe for concurrent
+// use.
+func (s *Session) isClosed() bool {
+	return atomic.LoadUint32(&s.closed) == 1
+}
+
+// markClosed marks the session closed and reports whether it was open.
+func (s *Session) markClosed() bool {
+	return atomic.CompareAndSwapUint32(&s.closed, 0, 1)
+}
+
+// Exec is used to execute an RPC method or methods. Several methods are sent
+// in a single rpc, see ExecBatch to send them as separate requests.
 func (s *Session) Exec(methods ...RPCMethod) (*RPCReply, error) {
-	return NewRPCMessage(methods).Exec(s)
+	return s.newRPCMessage(methods).Exec(s)
+}
+
+// ExecContext is used to execute an RPC method or methods, aborting when ctx
+// is done. See RPCMessage.ExecContext for the cancellation semantics.
+func (s *Session) ExecContext(ctx context.Context, methods ...RPCMethod) (*RPCReply, error) {
+	return s.newRPCMessage(methods).ExecContext(ctx, s)
+}
+
+// SetMessageIDGenerator sets the function generating the message-id of the
+// requests sent by Exec and the operations of the session, instead of the
+// default random UUIDs. gen must return a unique id on every call and be safe
+// for concurrent use if the session is. A nil gen restores the default.
+func (s *Session) SetMessageIDGenerator(gen func() string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messageID = gen
+}
+
+// SetMaxReplyBytes sets the size limit of the replies received, 32 MiB by
+// default, zero for no limit, so a misbehaving device can't exhaust the
+// memory. A larger reply fails with ErrReplyTooLarge and leaves the session
+// unusable. It must be called before requests are in flight and fails if the
+// transport doesn't implement ReplyLimiter.
+func (s *Session) SetMaxReplyBytes(n int64) error {
+	rl, ok := s.Transport.(ReplyLimiter)
+	if !ok {
+		return fmt.Errorf("transport %T does not limit the reply size", s.Transport)
+	}
+	rl.SetMaxReplyBytes(n)
+	return nil
+}
+
+// Directions of the messages passed to the tracer, see SetTracer.
+const (
+	TraceSent     = "sent"
+	TraceReceived = "received"
+)
+
+// SetTracer sets a function called with every message sent or received on the
+// session, without framing. direction is TraceSent or TraceReceived. Received
+// messages are traced before being parsed so malformed replies are seen as
+// well. The hello messages are exchanged before the tracer can be set and are
+// not traced. A nil tracer disables tracing.
+//
+// Nothing is redacted, but the messages only hold NETCONF payloads: the
+// credentials are used by the transport, such as SSH, and never appear in
+// them.
+func (s *Session) SetTracer(tracer func(direction string, data []byte)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tracer = tracer
+}
+
+func (s *Session) trace(direction string, data []byte) {
+	s.mu.Lock()
+	tracer := s.tracer
+	s.mu.Unlock()
+
+	if tracer != nil {
+		tracer(direction, data)
+	}
+}
+
+// send sends a request on the transport. Its reply must be reported with
+// idleEnd.
+func (s *Session) send(data []byte) error {
+	if err := s.idleBegin(); err != nil {
+		return err
+	}
+	s.trace(TraceSent, data)
+	if err := s.Transport.Send(data); err != nil {
+		s.idleEnd()
+		s.closeOnTimeout(err)
+		return wrapTransportError(err)
+	}
+	atomic.AddUint64(&s.stats.bytesSent, uint64(len(data)))
+	return nil
+}
+
+// receive receives a message from the transport.
+func (s *Session) receive() ([]byte, error) {
+	data, err := s.Transport.Receive()
+	if err == nil {
+		atomic.AddUint64(&s.stats.bytesReceived, uint64(len(data)))
+		s.trace(TraceReceived, data)
+	} else if s.isIdle() {
+		return nil, ErrSessionIdle
+	}
+	s.closeOnTimeout(err)
+	return data, wrapTransportError(err)
+}
+
+// closeOnTimeout marks the session closed if err is ErrTimeout, the transport
+// closes itself on timeouts, so later calls get ErrSessionClosed.
+func (s *Session) closeOnTimeout(err error) {
+	if errors.Is(err, ErrTimeout) {
+		s.markClosed()
+		s.stopIdleTimer()
+	}
+}
+
+// idleBegin suspends the IdleTimeout countdown while a request is
+// outstanding, so a slow reply doesn't get its transport closed. It returns
+// ErrSessionIdle if the countdown already expired.
+func (s *Session) idleBegin() error {
+	if s.IdleTimeout <= 0 {
+		return nil
+	}
+
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+
+	if s.idle {
+		return ErrSessionIdle
+	}
+	s.idleBusy++
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	return nil
+}
+
+// idleEnd reports the reply to a request sent, or its failure, restarting the
+// IdleTimeout countdown once no request is outstanding.
+func (s *Session) idleEnd() {
+	if s.IdleTimeout <= 0 {
+		return
+	}
+
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	if s.idleBusy > 0 {
+		s.idleBusy--
+	}
+	s.armIdleTimer()
+}
+
+// idleActivity restarts the IdleTimeout countdown after receiving a message
+// other than a reply, such as a notification.
+func (s *Session) idleActivity() {
+	if s.IdleTimeout <= 0 {
+		return
+	}
+
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	s.armIdleTimer()
+}
+
+// armIdleTimer restarts the IdleTimeout countdown unless it expired or
+// requests are outstanding. s.idleMu must be held.
+func (s *Session) armIdleTimer() {
+	if s.idle || s.idleBusy > 0 {
+		return
+	}
+	s.idleDeadline = time.Now().Add(s.IdleTimeout)
+	if s.idleTimer == nil {
+		s.idleTimer = time.AfterFunc(s.IdleTimeout, s.closeIdle)
+	} else {
+		s.idleTimer.Reset(s.IdleTimeout)
+	}
+}
+
+// closeIdle closes the transport once the idle deadline passed.
+func (s *Session) closeIdle() {
+	s.idleMu.Lock()
+	// the timer may fire while being reset or stopped
+	if s.idle || s.idleBusy > 0 || time.Now().Before(s.idleDeadline) {
+		s.idleMu.Unlock()
+		return
+	}
+	s.idle = true
+	s.idleMu.Unlock()
+
+	s.Transport.Close()
+}
+
+// isIdle reports whether the transport was closed by IdleTimeout.
+func (s *Session) isIdle() bool {
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	return s.idle
+}
+
+// stopIdleTimer stops the IdleTimeout countdown and reports whether it
+// already expired.
+func (s *Session) stopIdleTimer() bool {
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	return s.idle
+}
+
+// newRPCMessage returns a message with an id from the session generator.
+func (s *Session) newRPCMessage(methods []RPCMethod) *RPCMessage {
+	s.mu.Lock()
+	gen := s.messageID
+	s.mu.Unlock()
+
+	if gen == nil {
+		gen = msgID
+	}
+	return &RPCMessage{MessageID: gen(), Methods: methods}
 }
 
 // NewSession creates a new NETCONF session using the provided transport layer.
 func NewSession(t Transport) *Session {
+	s, _ := newSession(t)
+	return s
+}
+
+// NewSessionContext creates a new NETCONF session using the provided transport
+// layer and reports any error of the hello exchange. If ctx is done before the
+// hello exchange completes the transport is closed and ctx.Err() is returned.
+func NewSessionContext(ctx context.Context, t Transport) (*Session, error) {
+	return NewSessionWithConfig(ctx, t, SessionConfig{})
+}
+
+// SessionConfig holds the parameters of the session establishment.
+type SessionConfig struct {
+	// ClientCapabilities are the capabilities advertised in the client hello,
+	// DefaultCapabilities if empty. base:1.0 is always advertised and
+	// duplicates are dropped. Leaving out base:1.1 forces the end-of-message
+	// framing, for devices with a broken chunked framing.
+	ClientCapabilities []string
+	// HelloTimeout bounds the hello exchange when set. A server not sending
+	// its hello in time, such as a service which isn't NETCONF, fails the
+	// session with ErrHelloTimeout and the transport is closed.
+	HelloTimeout time.Duration
+	// AllowNoCommonBase accepts servers not advertising base:1.0 nor a base
+	// version advertised by the client, for non-conformant devices. Otherwise
+	// the session fails with a *NoCommonBaseError.
+	AllowNoCommonBase bool
+	// IdleTimeout sets Session.IdleTimeout and starts its countdown once the
+	// session is established, so a session never used is closed as well.
+	IdleTimeout time.Duration
+	// VendorDatastores sets Session.VendorDatastores.
+	VendorDatastores []Datastore
+}
+
+// helloCapabilities returns the capabilities of the client hello, base:1.0
+// first.
+func (c SessionConfig) helloCapabilities() []string {
+	caps := c.ClientCapabilities
+	if len(caps) == 0 {
+		caps = DefaultCapabilities
+	}
+
+	hello := []string{capBase10}
+	for _, capability := range caps {
+		if !contains(hello, capability) {
+			hello = append(hello, capability)
+		}
+	}
+	return hello
+}
+
+// NewSessionWithConfig is like NewSessionContext, establishing the session
+// according to config. The capabilities advertised are available from
+// ClientCapabilities.
+func NewSessionWithConfig(ctx context.Context, t Transport, config SessionConfig) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	helloCtx := ctx
+	if config.HelloTimeout > 0 {
+		var cancel context.CancelFunc
+		helloCtx, cancel = context.WithTimeout(ctx, config.HelloTimeout)
+		defer cancel()
+	}
+
+	stop := closeOnDone(helloCtx, t)
+	s, err := newSessionWithConfig(t, config)
+	if stop() {
+		if ctx.Err() == nil {
+			return nil, ErrHelloTimeout
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSession(t Transport) (*Session, error) {
+	return newSessionWithConfig(t, SessionConfig{})
+}
+
+func newSessionWithConfig(t Transport, config SessionConfig) (*Session, error) {
 	s := new(Session)
 	s.Transport = t
+	s.VendorDatastores = config.VendorDatastores
 
 	// Receive Servers Hello message
-	serverHello, _ := t.ReceiveHello()
-	s.SessionID = serverHello.SessionID
-	s.ServerCapabilities = serverHello.Capabilities
+	serverHello, err := t.ReceiveHello()
+	if serverHello != nil {
+		s.sessionID = serverHello.SessionID
+		s.serverCapabilities = serverHello.Capabilities
+	}
 
-	// Send our hello using default capabilities.
-	t.SendHello(&HelloMessage{Capabilities: DefaultCapabilities})
+	s.clientCapabilities = config.helloCapabilities()
+	if herr := t.SendHello(&HelloMessage{Capabilities: s.clientCapabilities}); err == nil {
+		err = herr
+	}
 
-	// Set Transport version
-	t.SetVersion("v1.0")
-	for _, capability := range s.ServerCapabilities {
-		if strings.Contains(capability, "urn:ietf:params:netconf:base:1.1") {
-			t.SetVersion("v1.1")
-			break
+	s.negotiateFraming()
+
+	if err == nil && !config.AllowNoCommonBase {
+		err = s.checkCommonBase()
+	}
+	if err == nil && config.IdleTimeout > 0 {
+		s.IdleTimeout = config.IdleTimeout
+		s.idleActivity()
+	}
+	return s, err
+}
+
+// ErrNoCommonBase is returned when the peers don't advertise a common base
+// capability, see NoCommonBaseError.
+var ErrNoCommonBase = errors.New("no common base capability")
+
+// NoCommonBaseError holds the capabilities of a hello exchange without common
+// base capability. It matches ErrNoCommonBase with errors.Is.
+type NoCommonBaseError struct {
+	ServerCapabilities []string
+	ClientCapabilities []string
+}
+
+func (e *NoCommonBaseError) Error() string {
+	return fmt.Sprintf("%v: server advertised %s, client advertised %s", ErrNoCommonBase,
+		strings.Join(e.ServerCapabilities, " "), strings.Join(e.ClientCapabilities, " "))
+}
+
+// Unwrap returns ErrNoCommonBase.
+func (e *NoCommonBaseError) Unwrap() error {
+	return ErrNoCommonBase
+}
+
+// checkCommonBase checks the peers share base:1.0 or base:1.1 as RFC 6241
+// requires.
+func (s *Session) checkCommonBase() error {
+	for _, base := range []string{capBase10, capBase11} {
+		if hasCapability(s.serverCapabilities, base) && hasCapability(s.clientCapabilities, base) {
+			return nil
 		}
 	}
+	return &NoCommonBaseError{
+		ServerCapabilities: s.ServerCapabilities(),
+		ClientCapabilities: s.ClientCapabilities(),
+	}
+}
 
-	return s
+// SessionID returns the session-id the server assigned in its hello, or zero
+// if it didn't send one.
+func (s *Session) SessionID() uint32 {
+	return s.sessionID
+}
+
+// ServerCapabilities returns the capabilities the server advertised in its
+// hello.
+func (s *Session) ServerCapabilities() []string {
+	return append([]string(nil), s.serverCapabilities...)
+}
+
+// ClientCapabilities returns the capabilities sent in the client hello, see
+// SessionConfig.
+func (s *Session) ClientCapabilities() []string {
+	return append([]string(nil), s.clientCapabilities...)
+}
+
+// HasCapability reports whether the server advertised the capability uri.
+// Query parameters of the advertised capabilities are ignored, so the base
+// URI of a capability such as with-defaults matches.
+func (s *Session) HasCapability(uri string) bool {
+	return hasCapability(s.serverCapabilities, uri)
+}
+
+// negotiateFraming selects chunked framing when both peers advertise
+// base:1.1 and falls back to end-of-message framing otherwise. It must be run
+// once right after the hello exchange and before any RPC is sent.
+func (s *Session) negotiateFraming() {
+	s.framing = FramingV10
+	if hasCapability(s.clientCapabilities, capBase11) && hasCapability(s.serverCapabilities, capBase11) {
+		s.framing = FramingV11
+	}
+	s.Transport.SetVersion(s.framing.String())
+}
+
+// CapabilityParams returns the query parameters of the capability base
+// advertised by the server, e.g. basic-mode and also-supported for
+// with-defaults, and whether it was advertised. See ParseCapability.
+func (s *Session) CapabilityParams(base string) (map[string]string, bool) {
+	return capabilityParams(s.serverCapabilities, base)
+}
+
+// ParseCapability splits a capability URI into its base URI and its query
+// parameters, which are never nil. List values such as also-supported are
+// kept comma separated, the values of a repeated parameter are joined with
+// commas. Parameters may be separated by & or its XML escape &amp;.
+func ParseCapability(uri string) (base string, params map[string]string) {
+	params = make(map[string]string)
+	parts := strings.SplitN(uri, "?", 2)
+	if len(parts) == 1 {
+		return parts[0], params
+	}
+
+	for _, param := range strings.Split(strings.Replace(parts[1], "&amp;", "&", -1), "&") {
+		if param == "" {
+			continue
+		}
+		kv := strings.SplitN(param, "=", 2)
+		key, err := url.QueryUnescape(kv[0])
+		if err != nil {
+			key = kv[0]
+		}
+		var value string
+		if len(kv) == 2 {
+			if value, err = url.QueryUnescape(kv[1]); err != nil {
+				value = kv[1]
+			}
+		}
+		if prev, ok := params[key]; ok && prev != "" {
+			value = prev + "," + value
+		}
+		params[key] = value
+	}
+	return parts[0], params
+}
+
+// capabilityParams returns the query parameters of the capability uri in caps
+// and whether it is present.
+func capabilityParams(caps []string, uri string) (map[string]string, bool) {
+	for _, c := range caps {
+		if base, params := ParseCapability(c); base == uri {
+			return params, true
+		}
+	}
+	return nil, false
+}
+
+// hasCapability reports whether the capability uri is present in caps,
+// ignoring any query parameters.
+func hasCapability(caps []string, uri string) bool {
+	for _, c := range caps {
+		if strings.SplitN(c, "?", 2)[0] == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// closeOnDone closes c when ctx is done before the returned stop function is
+// called. Closing is the only portable way to unblock a pending read on the
+// transports. stop reports whether c was closed because of ctx.
+func closeOnDone(ctx context.Context, c io.Closer) (stop func() bool) {
+	if ctx.Done() == nil {
+		return func() bool { return false }
+	}
+
+	done := make(chan struct{})
+	closed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+			closed <- true
+		case <-done:
+			closed <- false
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		return <-closed
+	}
 }
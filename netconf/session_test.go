@@ -0,0 +1,481 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNegotiateFraming(t *testing.T) {
+	tt := []struct {
+		name     string
+		hello    string
+		expected FramingVersion
+	}{
+		{
+			name: "base10",
+			hello: `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities>
+<session-id>1</session-id>
+</hello>]]>]]>`,
+			expected: FramingV10,
+		},
+		{
+			name: "base11",
+			hello: `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<capabilities><capability>urn:ietf:params:netconf:base:1.0</capability><capability>urn:ietf:params:netconf:base:1.1</capability></capabilities>
+<session-id>1</session-id>
+</hello>]]>]]>`,
+			expected: FramingV11,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.hello)
+			s := NewSession(trans)
+
+			if s.FramingVersion() != tc.expected {
+				t.Errorf("unexpected framing (want %s, got %s)", tc.expected, s.FramingVersion())
+			}
+			if trans.version != tc.expected.String() {
+				t.Errorf("transport version not set (want %s, got %s)", tc.expected, trans.version)
+			}
+		})
+	}
+}
+
+func TestNewSessionContextTimeout(t *testing.T) {
+	trans, _, _ := newPipeTransportTest()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := NewSessionContext(ctx, trans)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestCloseSession(t *testing.T) {
+	trans, out := newTransportTest(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>]]>]]>`)
+	s := &Session{Transport: trans}
+
+	reply, err := s.CloseSession(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reply.Ok {
+		t.Errorf("expected ok reply")
+	}
+	if !strings.Contains(out.String(), "<close-session/>") {
+		t.Errorf("close-session not sent: %q", out.String())
+	}
+
+	if _, err := s.CloseSession(context.Background()); err != ErrSessionClosed {
+		t.Errorf("expected ErrSessionClosed on second call, got %v", err)
+	}
+	if err := s.Close(); err != ErrSessionClosed {
+		t.Errorf("expected ErrSessionClosed on close, got %v", err)
+	}
+	if _, err := s.Exec(MethodGetConfig("running")); err != ErrSessionClosed {
+		t.Errorf("expected ErrSessionClosed on exec, got %v", err)
+	}
+}
+
+func TestSessionCapabilities(t *testing.T) {
+	trans, _ := newTransportTest(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<capabilities>
+<capability>urn:ietf:params:netconf:base:1.0</capability>
+<capability>urn:ietf:params:netconf:capability:candidate:1.0</capability>
+<capability>urn:ietf:params:netconf:capability:with-defaults:1.0?basic-mode=explicit</capability>
+</capabilities>
+<session-id>1</session-id>
+</hello>]]>]]>`)
+	s := NewSession(trans)
+
+	if len(s.ServerCapabilities()) != 3 {
+		t.Errorf("unexpected server capabilities: %v", s.ServerCapabilities())
+	}
+	if diff := cmp.Diff(DefaultCapabilities, s.ClientCapabilities()); diff != "" {
+		t.Errorf("unexpected client capabilities (-want +got):\n%s", diff)
+	}
+
+	tt := []struct {
+		uri      string
+		expected bool
+	}{
+		{"urn:ietf:params:netconf:capability:candidate:1.0", true},
+		{"urn:ietf:params:netconf:capability:with-defaults:1.0", true},
+		{"urn:ietf:params:netconf:capability:startup:1.0", false},
+	}
+	for _, tc := range tt {
+		if got := s.HasCapability(tc.uri); got != tc.expected {
+			t.Errorf("HasCapability(%q): got %v, expected %v", tc.uri, got, tc.expected)
+		}
+	}
+}
+
+func TestSessionID(t *testing.T) {
+	tt := []struct {
+		name     string
+		hello    string
+		expected uint32
+	}{
+		{
+			name: "present",
+			hello: `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities>
+<session-id>4294967295</session-id>
+</hello>]]>]]>`,
+			expected: 4294967295,
+		},
+		{
+			name: "omitted",
+			hello: `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities>
+</hello>]]>]]>`,
+			expected: 0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.hello)
+			s, err := newSession(trans)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s.SessionID() != tc.expected {
+				t.Errorf("unexpected session-id (want %d, got %d)", tc.expected, s.SessionID())
+			}
+		})
+	}
+}
+
+func TestSetMessageIDGenerator(t *testing.T) {
+	trans, out := newTransportTest(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="req-1"><ok/></rpc-reply>]]>]]>`)
+	s := &Session{Transport: trans}
+	s.SetMessageIDGenerator(func() string { return "req-1" })
+
+	reply, err := s.Exec(MethodLock("running"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reply.MessageID != "req-1" {
+		t.Errorf("unexpected message-id (want %s, got %s)", "req-1", reply.MessageID)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<rpc message-id="req-1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><lock><target><running/></target></lock></rpc>]]>]]>`
+	if out.String() != expected {
+		t.Errorf("got %s, expected %s", out, expected)
+	}
+}
+
+func TestSetTracer(t *testing.T) {
+	trans, _ := newTransportTest(`<rpc-reply message-id="101"><data>&bogus;</data></rpc-reply>]]>]]>`)
+	s := &Session{Transport: trans}
+	s.SetMessageIDGenerator(func() string { return "101" })
+
+	var traced []string
+	s.SetTracer(func(direction string, data []byte) {
+		traced = append(traced, direction+": "+string(data))
+	})
+
+	if _, err := s.Exec(MethodGetConfig("running")); err == nil {
+		t.Fatalf("expected error for malformed reply")
+	}
+
+	expected := []string{
+		`sent: <?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+			`<rpc message-id="101" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get-config><source><running/></source></get-config></rpc>`,
+		`received: <rpc-reply message-id="101"><data>&bogus;</data></rpc-reply>`,
+	}
+	if diff := cmp.Diff(expected, traced); diff != "" {
+		t.Errorf("unexpected trace (-want +got):\n%s", diff)
+	}
+}
+
+func TestSessionConfigClientCapabilities(t *testing.T) {
+	tt := []struct {
+		name     string
+		caps     []string
+		expected []string
+		framing  FramingVersion
+	}{
+		{
+			name:     "default",
+			expected: DefaultCapabilities,
+			framing:  FramingV11,
+		},
+		{
+			name:     "legacy framing",
+			caps:     []string{"urn:ietf:params:netconf:capability:with-defaults:1.0?basic-mode=explicit"},
+			expected: []string{"urn:ietf:params:netconf:base:1.0", "urn:ietf:params:netconf:capability:with-defaults:1.0?basic-mode=explicit"},
+			framing:  FramingV10,
+		},
+		{
+			name:     "dedupe",
+			caps:     []string{"urn:ietf:params:netconf:base:1.1", "urn:example:vendor", "urn:ietf:params:netconf:base:1.0", "urn:example:vendor"},
+			expected: []string{"urn:ietf:params:netconf:base:1.0", "urn:ietf:params:netconf:base:1.1", "urn:example:vendor"},
+			framing:  FramingV11,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans := NewMemoryTransport([]byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability><capability>urn:ietf:params:netconf:base:1.1</capability></capabilities><session-id>1</session-id></hello>`))
+
+			s, err := NewSessionWithConfig(context.Background(), trans, SessionConfig{ClientCapabilities: tc.caps})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, s.ClientCapabilities()); diff != "" {
+				t.Errorf("unexpected client capabilities (-want +got):\n%s", diff)
+			}
+			if s.FramingVersion() != tc.framing {
+				t.Errorf("got framing %s, expected %s", s.FramingVersion(), tc.framing)
+			}
+
+			var hello HelloMessage
+			if err := xml.Unmarshal(trans.Sent()[0][len(xml.Header):], &hello); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, hello.Capabilities); diff != "" {
+				t.Errorf("unexpected hello capabilities (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSessionHelloTimeout(t *testing.T) {
+	trans, _, _ := newPipeTransportTest()
+
+	start := time.Now()
+	_, err := NewSessionWithConfig(context.Background(), trans, SessionConfig{HelloTimeout: 20 * time.Millisecond})
+	if err != ErrHelloTimeout {
+		t.Fatalf("got %v, expected %v", err, ErrHelloTimeout)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("hello timeout took %s", d)
+	}
+
+	// the deadline of the context is reported as such
+	trans, _, _ = newPipeTransportTest()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := NewSessionWithConfig(ctx, trans, SessionConfig{HelloTimeout: time.Minute}); err != context.DeadlineExceeded {
+		t.Errorf("got %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSessionNoCommonBase(t *testing.T) {
+	hello := []byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.1</capability></capabilities><session-id>1</session-id></hello>`)
+
+	// base:1.1 alone is enough when the client advertises it
+	if _, err := NewSessionWithConfig(context.Background(), NewMemoryTransport(hello), SessionConfig{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	config := SessionConfig{ClientCapabilities: []string{"urn:ietf:params:netconf:base:1.0"}}
+	_, err := NewSessionWithConfig(context.Background(), NewMemoryTransport(hello), config)
+	if !errors.Is(err, ErrNoCommonBase) {
+		t.Fatalf("got %v, expected %v", err, ErrNoCommonBase)
+	}
+	var baseErr *NoCommonBaseError
+	if !errors.As(err, &baseErr) {
+		t.Fatalf("expected *NoCommonBaseError, got %T", err)
+	}
+	if diff := cmp.Diff([]string{"urn:ietf:params:netconf:base:1.1"}, baseErr.ServerCapabilities); diff != "" {
+		t.Errorf("unexpected server capabilities (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"urn:ietf:params:netconf:base:1.0"}, baseErr.ClientCapabilities); diff != "" {
+		t.Errorf("unexpected client capabilities (-want +got):\n%s", diff)
+	}
+
+	config.AllowNoCommonBase = true
+	if _, err := NewSessionWithConfig(context.Background(), NewMemoryTransport(hello), config); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSessionErrorKinds(t *testing.T) {
+	// the peer closed the connection
+	s, _ := newMemorySession(t)
+	if _, err := s.Exec(MethodUnlock(Running)); !errors.Is(err, ErrTransportClosed) {
+		t.Errorf("got %v, expected %v", err, ErrTransportClosed)
+	}
+
+	trans, _ := newTransportTest(`<rpc-reply><ok/>`)
+	s = &Session{Transport: trans}
+	if _, err := s.Exec(MethodUnlock(Running)); !errors.Is(err, ErrTransportClosed) || !errors.Is(err, io.EOF) {
+		t.Errorf("got %v, expected %v", err, ErrTransportClosed)
+	}
+
+	// the reply isn't XML
+	s, _ = newMemorySession(t, `<rpc-reply>&bogus;</rpc-reply>`)
+	_, err := s.Exec(MethodUnlock(Running))
+	if !errors.Is(err, ErrMalformedReply) {
+		t.Errorf("got %v, expected %v", err, ErrMalformedReply)
+	}
+	if errors.Is(err, ErrTransportClosed) {
+		t.Errorf("malformed reply reported as closed transport: %v", err)
+	}
+
+	// rpc-error
+	s, _ = newMemorySession(t, testLockDeniedReply)
+	_, err = s.Exec(MethodLock(Running))
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || errors.Is(err, ErrTransportClosed) || errors.Is(err, ErrMalformedReply) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	s, trans := newMemorySession(t, testOkReply, testOkReply, testOkReply)
+	s.IdleTimeout = 50 * time.Millisecond
+
+	// activity within the window keeps the session open
+	for i := 0; i < 2; i++ {
+		if _, err := s.Exec(MethodLock(Candidate)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := s.Exec(MethodLock(Candidate)); !errors.Is(err, ErrSessionIdle) {
+		t.Errorf("got error %v, expected %v", err, ErrSessionIdle)
+	}
+	if err := trans.Send(nil); err == nil {
+		t.Errorf("expected transport to be closed")
+	}
+	if len(trans.Sent()) != 3 {
+		t.Errorf("got %d messages sent, expected 3", len(trans.Sent()))
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("unexpected error closing idle session: %v", err)
+	}
+}
+
+func TestIdleTimeoutSlowReply(t *testing.T) {
+	trans, pw, _ := newPipeTransportTest()
+	s := &Session{Transport: trans, IdleTimeout: 30 * time.Millisecond}
+
+	// the countdown is suspended while the reply is outstanding
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		pw.Write([]byte(testOkReply + "]]>]]>"))
+	}()
+	if _, err := s.Exec(MethodLock(Candidate)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := s.Exec(MethodLock(Candidate)); !errors.Is(err, ErrSessionIdle) {
+		t.Errorf("got error %v, expected %v", err, ErrSessionIdle)
+	}
+}
+
+func TestIdleTimeoutUnused(t *testing.T) {
+	trans := NewMemoryTransport([]byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities><session-id>1</session-id></hello>`))
+	s, err := newSessionWithConfig(trans, SessionConfig{IdleTimeout: 30 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.IdleTimeout != 30*time.Millisecond {
+		t.Errorf("got idle timeout %v, expected %v", s.IdleTimeout, 30*time.Millisecond)
+	}
+
+	// the countdown starts with the session, not the first request
+	time.Sleep(100 * time.Millisecond)
+	if _, err := s.Exec(MethodLock(Candidate)); !errors.Is(err, ErrSessionIdle) {
+		t.Errorf("got error %v, expected %v", err, ErrSessionIdle)
+	}
+}
+
+func TestParseCapability(t *testing.T) {
+	tt := []struct {
+		uri    string
+		base   string
+		params map[string]string
+	}{
+		{
+			uri:    "urn:ietf:params:netconf:capability:candidate:1.0",
+			base:   "urn:ietf:params:netconf:capability:candidate:1.0",
+			params: map[string]string{},
+		},
+		{
+			uri:  "urn:ietf:params:netconf:capability:with-defaults:1.0?basic-mode=explicit&also-supported=report-all,report-all-tagged",
+			base: "urn:ietf:params:netconf:capability:with-defaults:1.0",
+			params: map[string]string{
+				"basic-mode":     "explicit",
+				"also-supported": "report-all,report-all-tagged",
+			},
+		},
+		{
+			uri:    "urn:ietf:params:netconf:capability:url:1.0?scheme=file%2Chttps",
+			base:   "urn:ietf:params:netconf:capability:url:1.0",
+			params: map[string]string{"scheme": "file,https"},
+		},
+		{
+			uri:  "urn:example:module?module=example&amp;revision=2021-01-01&amp;features=a&amp;features=b",
+			base: "urn:example:module",
+			params: map[string]string{
+				"module":   "example",
+				"revision": "2021-01-01",
+				"features": "a,b",
+			},
+		},
+		{
+			uri:    "urn:example:flag?enabled",
+			base:   "urn:example:flag",
+			params: map[string]string{"enabled": ""},
+		},
+	}
+
+	for _, tc := range tt {
+		base, params := ParseCapability(tc.uri)
+		if base != tc.base {
+			t.Errorf("got %s, expected %s", base, tc.base)
+		}
+		if diff := cmp.Diff(tc.params, params); diff != "" {
+			t.Errorf("%s: unexpected params (-want +got):\n%s", tc.uri, diff)
+		}
+	}
+}
+
+func TestSessionCapabilityParams(t *testing.T) {
+	s := &Session{serverCapabilities: []string{
+		capBase10,
+		capWithDefaults + "?basic-mode=trim&amp;also-supported=report-all",
+	}}
+
+	params, ok := s.CapabilityParams(capWithDefaults)
+	if !ok {
+		t.Fatalf("expected with-defaults capability")
+	}
+	if diff := cmp.Diff(map[string]string{"basic-mode": "trim", "also-supported": "report-all"}, params); diff != "" {
+		t.Errorf("unexpected params (-want +got):\n%s", diff)
+	}
+
+	if params, ok := s.CapabilityParams(capBase10); !ok || len(params) != 0 {
+		t.Errorf("got %v, %t, expected no params", params, ok)
+	}
+	if _, ok := s.CapabilityParams(capCandidate); ok {
+		t.Errorf("unexpected candidate capability")
+	}
+}
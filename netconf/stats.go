@@ -0,0 +1,56 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import "sync/atomic"
+
+// SessionStats are the counters of a session, see Session.Stats.
+type SessionStats struct {
+	// RPCs is the number of requests completed, Errors those which failed
+	RPCs   uint64
+	Errors uint64
+	// Notifications is the number of notifications received
+	Notifications uint64
+	// BytesSent and BytesReceived count the messages exchanged after the
+	// hello, without framing
+	BytesSent     uint64
+	BytesReceived uint64
+}
+
+// sessionStats holds the counters of a session, updated atomically.
+type sessionStats struct {
+	rpcs          uint64
+	errors        uint64
+	notifications uint64
+	bytesSent     uint64
+	bytesReceived uint64
+}
+
+// Stats returns the counters of the session since it was established or
+// since the last ResetStats, e.g. to track the data volume of each session.
+// It is safe for concurrent use.
+func (s *Session) Stats() SessionStats {
+	return SessionStats{
+		RPCs:          atomic.LoadUint64(&s.stats.rpcs),
+		Errors:        atomic.LoadUint64(&s.stats.errors),
+		Notifications: atomic.LoadUint64(&s.stats.notifications),
+		BytesSent:     atomic.LoadUint64(&s.stats.bytesSent),
+		BytesReceived: atomic.LoadUint64(&s.stats.bytesReceived),
+	}
+}
+
+// ResetStats sets the counters of the session to zero and returns their
+// values before, for instance to report them per interval.
+func (s *Session) ResetStats() SessionStats {
+	return SessionStats{
+		RPCs:          atomic.SwapUint64(&s.stats.rpcs, 0),
+		Errors:        atomic.SwapUint64(&s.stats.errors, 0),
+		Notifications: atomic.SwapUint64(&s.stats.notifications, 0),
+		BytesSent:     atomic.SwapUint64(&s.stats.bytesSent, 0),
+		BytesReceived: atomic.SwapUint64(&s.stats.bytesReceived, 0),
+	}
+}
@@ -0,0 +1,42 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSessionStats(t *testing.T) {
+	s, trans := newMemorySession(t, testOkReply, testLockDeniedReply)
+
+	s.ExecContext(context.Background(), MethodLock(Candidate))
+	s.ExecContext(context.Background(), MethodLock(Candidate))
+
+	var sent uint64
+	for _, msg := range trans.Sent()[1:] {
+		sent += uint64(len(msg))
+	}
+	expected := SessionStats{
+		RPCs:          2,
+		Errors:        1,
+		BytesSent:     sent,
+		BytesReceived: uint64(len(testOkReply) + len(testLockDeniedReply)),
+	}
+	if diff := cmp.Diff(expected, s.Stats()); diff != "" {
+		t.Errorf("unexpected stats (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(expected, s.ResetStats()); diff != "" {
+		t.Errorf("unexpected stats before reset (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(SessionStats{}, s.Stats()); diff != "" {
+		t.Errorf("unexpected stats after reset (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,204 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamReceiver is implemented by transports able to return a message as it
+// arrives instead of buffering it, see Session.ExecStream.
+type StreamReceiver interface {
+	// ReceiveStream returns a reader yielding the next message without
+	// framing. The reader must be closed before receiving the next message.
+	ReceiveStream() (io.ReadCloser, error)
+}
+
+// ExecStream sends the message and returns a reader yielding the rpc-reply as
+// it arrives, without buffering it, so large replies such as full get-config
+// dumps can be decoded or written to a file progressively. The framing is
+// stripped but the reply is neither parsed nor checked: rpc-errors and the
+// message-id are up to the caller.
+//
+// The reply streams when the transport implements StreamReceiver, like the
+// SSH and TLS transports with chunked framing, and is buffered otherwise. The
+// session can't be used until the reader is closed, closing it early discards
+// the rest of the reply. Streamed replies are not traced, transport read
+// timeouts don't apply to them, and pipelined sessions can't stream.
+func (s *Session) ExecStream(m *RPCMessage) (io.ReadCloser, error) {
+	if s.isClosed() {
+		return nil, ErrSessionClosed
+	}
+	if s.activePipeline() != nil {
+		return nil, fmt.Errorf("replies of a pipelined session can't be streamed")
+	}
+
+	request, err := s.marshalRequest(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.send(request); err != nil {
+		return nil, err
+	}
+
+	if sr, ok := s.Transport.(StreamReceiver); ok {
+		r, err := sr.ReceiveStream()
+		if err != nil {
+			s.idleEnd()
+			return nil, err
+		}
+		return &idleReadCloser{ReadCloser: r, s: s}, nil
+	}
+	data, err := s.receive()
+	s.idleEnd()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// idleReadCloser reports the end of a streamed reply to the IdleTimeout
+// countdown once closed.
+type idleReadCloser struct {
+	io.ReadCloser
+	s    *Session
+	once sync.Once
+}
+
+func (r *idleReadCloser) Close() error {
+	r.once.Do(r.s.idleEnd)
+	return r.ReadCloser.Close()
+}
+
+// ExecDecode sends the message and decodes the first element inside the data
+// of the reply into v using xml.Unmarshal rules, or the first element of the
+// reply if it has no data element. The reply is streamed, see ExecStream, and
+// decoded without building a document, which saves most of the memory for
+// bulk data. The rpc-errors of the reply are returned as by Exec.
+func (s *Session) ExecDecode(m *RPCMessage, v interface{}) (err error) {
+	defer s.observeRPC(m, time.Now(), &err)
+
+	r, err := s.ExecStream(m)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	return s.decodeReply(xml.NewDecoder(r), m.MessageID, v)
+}
+
+// decodeReply decodes the rpc-reply read by d as described by ExecDecode.
+func (s *Session) decodeReply(d *xml.Decoder, messageID string, v interface{}) error {
+	var rpcErrs []RPCError
+	decoded := false
+	depth := 0
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1:
+				if tok.Name.Local != "rpc-reply" {
+					return fmt.Errorf("unexpected %s element instead of rpc-reply", tok.Name.Local)
+				}
+				if id := attrValue(tok, "message-id"); id != "" && !s.IgnoreMessageID && id != messageID {
+					return fmt.Errorf("%w: expected %q, got %q", ErrMessageIDMismatch, messageID, id)
+				}
+			case tok.Name.Local == "rpc-error":
+				rpcErr, err := decodeRPCError(d, &tok)
+				if err != nil {
+					return err
+				}
+				rpcErrs = append(rpcErrs, rpcErr)
+				depth--
+			case depth == 2 && tok.Name.Local == "data", depth == 2 && tok.Name.Local == "ok":
+				// decode the content of data
+			case !decoded && (depth == 2 || depth == 3):
+				if err := d.DecodeElement(v, &tok); err != nil {
+					return err
+				}
+				decoded = true
+				depth--
+			default:
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				depth--
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	for _, rpcErr := range rpcErrs {
+		if rpcErr.Severity == "warning" && s.WarningHandler != nil {
+			s.WarningHandler(rpcErr)
+		}
+	}
+	if err := replyError(rpcErrs, s.ErrOnWarning); err != nil {
+		return err
+	}
+	if !decoded {
+		return fmt.Errorf("no data in reply")
+	}
+	return nil
+}
+
+// decodeRPCError decodes the rpc-error element started by start.
+func decodeRPCError(d *xml.Decoder, start *xml.StartElement) (RPCError, error) {
+	var e struct {
+		RPCError
+		Info struct {
+			Elements []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"error-info"`
+	}
+	if err := d.DecodeElement(&e, start); err != nil {
+		return RPCError{}, err
+	}
+
+	rpcErr := e.RPCError
+	if len(e.Info.Elements) > 0 {
+		rpcErr.Info = make(map[string]string)
+		for _, el := range e.Info.Elements {
+			rpcErr.Info[el.XMLName.Local] = strings.TrimSpace(el.Value)
+		}
+	}
+	return rpcErr, nil
+}
+
+// attrValue returns the value of the attribute name of start.
+func attrValue(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name && attr.Name.Space == "" {
+			return attr.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestChunkedReader(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		expected string
+		err      error
+	}{
+		{
+			name:     "chunks",
+			input:    "\n#4\n<rpc\n#24\n-reply><ok/></rpc-reply>\n##\n",
+			expected: "<rpc-reply><ok/></rpc-reply>",
+		},
+		{
+			name:  "no chunks",
+			input: "\n##\n",
+			err:   errNoChunks,
+		},
+		{
+			name:     "truncated",
+			input:    "\n#10\n<rpc-",
+			expected: "<rpc-",
+			err:      io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.input)
+			trans.SetVersion("v1.1")
+
+			r, err := trans.ReceiveStream()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != tc.err {
+				t.Errorf("got error %v, expected %v", err, tc.err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestExecStream(t *testing.T) {
+	trans, out := newTransportTest("\n#13\n<rpc-reply><d\n#26\nata>big</data></rpc-reply>\n##\n" +
+		"\n#10\n<rpc-reply\n#23\n><data>big</data><!-- x\n##\n" +
+		"\n#28\n<rpc-reply><ok/></rpc-reply>\n##\n")
+	trans.SetVersion("v1.1")
+	s := &Session{Transport: trans}
+
+	r, err := s.ExecStream(s.newRPCMessage([]RPCMethod{MethodGetConfig(Running)}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "<rpc-reply><data>big</data></rpc-reply>"; string(got) != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+	r.Close()
+	if !strings.Contains(out.String(), "<get-config>") {
+		t.Errorf("request not sent: %s", out)
+	}
+
+	// closing early discards the rest of the reply
+	r, err = s.ExecStream(s.newRPCMessage([]RPCMethod{MethodGetConfig(Running)}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := r.Read(make([]byte, 4)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reply, err := s.Exec(MethodUnlock(Running))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reply.Ok {
+		t.Errorf("expected ok reply")
+	}
+}
+
+func TestExecStreamBuffered(t *testing.T) {
+	s, _ := newMemorySession(t, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data/></rpc-reply>`)
+
+	r, err := s.ExecStream(s.newRPCMessage([]RPCMethod{MethodGetConfig(Running)}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer r.Close()
+
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(got), "<data/>") {
+		t.Errorf("unexpected reply %s", got)
+	}
+}
+
+func TestExecDecode(t *testing.T) {
+	type Interfaces struct {
+		XMLName xml.Name `xml:"urn:ietf:params:xml:ns:yang:ietf-interfaces interfaces"`
+		Names   []string `xml:"interface>name"`
+	}
+
+	tt := []struct {
+		name     string
+		reply    string
+		expected []string
+		errTag   string
+		err      bool
+	}{
+		{
+			name: "data",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" message-id="1"><data>` +
+				`<if:interfaces><if:interface><if:name>eth0</if:name></if:interface><if:interface><if:name>eth1</if:name></if:interface></if:interfaces>` +
+				`<system xmlns="urn:sys"/></data></rpc-reply>`,
+			expected: []string{"eth0", "eth1"},
+		},
+		{
+			name:   "rpc-error",
+			reply:  `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag><error-severity>error</error-severity><error-info><bad-element>interfaces</bad-element></error-info></rpc-error></rpc-reply>`,
+			errTag: "invalid-value",
+			err:    true,
+		},
+		{
+			name:  "no data",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1"><ok/></rpc-reply>`,
+			err:   true,
+		},
+		{
+			name:  "message-id mismatch",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="7"><data/></rpc-reply>`,
+			err:   true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newMemorySession(t, tc.reply)
+			s.SetMessageIDGenerator(MonotonicMessageID())
+
+			var v Interfaces
+			err := s.ExecDecode(s.newRPCMessage([]RPCMethod{MethodGet("subtree", "")}), &v)
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.errTag != "" {
+				var rpcErr *RPCError
+				if !errors.As(err, &rpcErr) || rpcErr.Tag != tc.errTag || rpcErr.Info["bad-element"] != "interfaces" {
+					t.Errorf("unexpected error: %#v", err)
+				}
+			}
+			if diff := cmp.Diff(tc.expected, v.Names); diff != "" {
+				t.Errorf("unexpected names (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
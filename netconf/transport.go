@@ -7,17 +7,30 @@
 package netconf
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"regexp"
+	"strconv"
 )
 
 const (
 	// msgSeperator is used to separate sent messages via NETCONF
 	msgSeperator     = "]]>]]>"
 	msgSeperator_v11 = "\n##\n"
+
+	// maxChunkSizeDigits is the length of the largest allowed chunk-size
+	// (4294967295) in RFC 6242
+	maxChunkSizeDigits = 10
+
+	// defaultMaxReplyBytes is the size limit of the received messages unless
+	// set with SetMaxReplyBytes
+	defaultMaxReplyBytes = 32 << 20
 )
 
 // DefaultCapabilities sets the default capabilities of the client library
@@ -26,11 +39,58 @@ var DefaultCapabilities = []string{
 	"urn:ietf:params:netconf:base:1.1",
 }
 
+// ErrTransportClosed is matched by the errors of sessions whose transport was
+// closed, by the peer or locally, which wrap the error of the transport.
+var ErrTransportClosed = errors.New("transport closed")
+
+// transportClosedError is an error of a closed transport.
+type transportClosedError struct {
+	err error
+}
+
+func (e *transportClosedError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrTransportClosed, e.err)
+}
+
+func (e *transportClosedError) Is(target error) bool {
+	return target == ErrTransportClosed
+}
+
+func (e *transportClosedError) Unwrap() error {
+	return e.err
+}
+
+// wrapTransportError marks the errors caused by a closed transport as
+// ErrTransportClosed.
+func wrapTransportError(err error) error {
+	if err == nil || errors.Is(err, ErrTransportClosed) {
+		return err
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) {
+		return &transportClosedError{err}
+	}
+	return err
+}
+
+// ErrReplyTooLarge is returned when receiving a message larger than the limit
+// of the transport, see ReplyLimiter. The rest of the message is left unread
+// so the transport can't be used anymore.
+var ErrReplyTooLarge = errors.New("reply too large")
+
+// ReplyLimiter is implemented by transports limiting the size of the messages
+// they receive, see Session.SetMaxReplyBytes.
+type ReplyLimiter interface {
+	// SetMaxReplyBytes sets the size limit of the received messages, zero
+	// for no limit.
+	SetMaxReplyBytes(n int64)
+}
+
 // HelloMessage is used when bringing up a NETCONF session
 type HelloMessage struct {
 	XMLName      xml.Name `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 hello"`
 	Capabilities []string `xml:"capabilities>capability"`
-	SessionID    int      `xml:"session-id,omitempty"`
+	SessionID    uint32   `xml:"session-id,omitempty"`
 }
 
 // Transport interface defines what characterisitics make up a NETCONF transport
@@ -46,47 +106,278 @@ type Transport interface {
 
 type transportBasicIO struct {
 	io.ReadWriteCloser
-	//new add
 	version string
+	reader  *bufio.Reader
+
+	// maxReplyBytes is the size limit of the received messages when
+	// maxReplySet, defaultMaxReplyBytes otherwise
+	maxReplyBytes int64
+	maxReplySet   bool
 }
 
 func (t *transportBasicIO) SetVersion(version string) {
 	t.version = version
 }
 
+// SetMaxReplyBytes sets the size limit of the received messages, 32 MiB by
+// default, zero for no limit. With chunked framing the size is the sum of the
+// chunk sizes. Messages streamed by ReceiveStream are not limited as they are
+// not buffered.
+func (t *transportBasicIO) SetMaxReplyBytes(n int64) {
+	t.maxReplyBytes = n
+	t.maxReplySet = true
+}
+
+// checkReplySize returns ErrReplyTooLarge if a message of size bytes exceeds
+// the limit.
+func (t *transportBasicIO) checkReplySize(size int64) error {
+	limit := int64(defaultMaxReplyBytes)
+	if t.maxReplySet {
+		limit = t.maxReplyBytes
+	}
+	if limit > 0 && size > limit {
+		return fmt.Errorf("%w: more than %d bytes", ErrReplyTooLarge, limit)
+	}
+	return nil
+}
+
 // Sends a well formated NETCONF rpc message as a slice of bytes adding on the
 // nessisary framining messages.
 func (t *transportBasicIO) Send(data []byte) error {
-	var seperator []byte
 	var dataInfo []byte
-	//headlen := 0
 	if t.version == "v1.1" {
-		seperator = append(seperator, []byte(msgSeperator_v11)...)
-	} else {
-		seperator = append(seperator, []byte(msgSeperator)...)
-	}
-
-	if t.version == "v1.1" {
-		header := fmt.Sprintf("\n#%d\n", len(string(data)))
+		// RFC 6242 4.2: a single chunk followed by the end-of-chunks marker
+		header := fmt.Sprintf("\n#%d\n", len(data))
 		dataInfo = append(dataInfo, header...)
-		//t.Write([]byte(header))
-		//headlen = len([]byte(header))
+		dataInfo = append(dataInfo, data...)
+		dataInfo = append(dataInfo, msgSeperator_v11...)
+	} else {
+		dataInfo = append(dataInfo, data...)
+		dataInfo = append(dataInfo, msgSeperator...)
 	}
-	dataInfo = append(dataInfo, data...)
-	dataInfo = append(dataInfo, seperator...)
 	_, err := t.Write(dataInfo)
 
 	return err
 }
 
+// Receive reads the next NETCONF message from the transport stripping the
+// framing according to the negotiated version.
 func (t *transportBasicIO) Receive() ([]byte, error) {
-	var seperator []byte
 	if t.version == "v1.1" {
-		seperator = append(seperator, []byte(msgSeperator_v11)...)
-	} else {
-		seperator = append(seperator, []byte(msgSeperator)...)
+		return t.receiveChunked()
+	}
+	return t.receiveDelimited()
+}
+
+// bufReader returns the buffered reader used to receive the messages, wrapping
+// the underlying transport on first use. Bytes read past the end of a message
+// stay buffered for the next one.
+func (t *transportBasicIO) bufReader() *bufio.Reader {
+	if t.reader == nil {
+		t.reader = bufio.NewReader(t.ReadWriteCloser)
+	}
+	return t.reader
+}
+
+// receiveChunked decodes a chunked framed message as defined by RFC 6242
+// section 4.2 and returns the concatenated chunk data.
+func (t *transportBasicIO) receiveChunked() ([]byte, error) {
+	r := t.bufReader()
+	var out bytes.Buffer
+
+	for {
+		size, end, err := readChunkHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			if out.Len() == 0 {
+				return nil, errNoChunks
+			}
+			return out.Bytes(), nil
+		}
+
+		if err := t.checkReplySize(int64(out.Len()) + int64(size)); err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(&out, r, int64(size)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// receiveDelimited reads an end-of-message framed message as defined by RFC
+// 6242 section 4.3 and returns it without the delimiter.
+func (t *transportBasicIO) receiveDelimited() ([]byte, error) {
+	r := t.bufReader()
+	sep := []byte(msgSeperator)
+	var out bytes.Buffer
+
+	for {
+		data, err := r.ReadSlice(sep[len(sep)-1])
+		if err := t.checkReplySize(int64(out.Len() + len(data) - len(sep))); err != nil {
+			return nil, err
+		}
+		out.Write(data)
+		if bytes.HasSuffix(out.Bytes(), sep) {
+			return out.Bytes()[:out.Len()-len(sep)], nil
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+		case err == io.EOF:
+			// the stream ended before the end of the message
+			return nil, fmt.Errorf("end-of-message not found: %w", io.EOF)
+		case err != nil:
+			return nil, err
+		}
 	}
-	return t.WaitForBytes([]byte(seperator))
+}
+
+// errNoChunks is returned for an end-of-chunks marker without chunks before
+var errNoChunks = errors.New("malformed chunked message: no chunks before end-of-chunks")
+
+// readChunkHeader reads a chunk header and returns the chunk-size, or end set
+// for the end-of-chunks marker.
+func readChunkHeader(r *bufio.Reader) (size uint64, end bool, err error) {
+	if err := expectByte(r, '\n'); err != nil {
+		return 0, false, err
+	}
+	if err := expectByte(r, '#'); err != nil {
+		return 0, false, err
+	}
+
+	next, err := r.Peek(1)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// end-of-chunks: LF HASH HASH LF
+	if next[0] == '#' {
+		r.ReadByte()
+		if err := expectByte(r, '\n'); err != nil {
+			return 0, false, err
+		}
+		return 0, true, nil
+	}
+
+	size, err = readChunkSize(r)
+	return size, false, err
+}
+
+// ReceiveStream returns a reader yielding the next message as it arrives with
+// chunked framing. With end-of-message framing the message is received before
+// being returned. Closing the reader discards the rest of the message, it must
+// be closed before receiving the next one.
+func (t *transportBasicIO) ReceiveStream() (io.ReadCloser, error) {
+	if t.version != "v1.1" {
+		data, err := t.Receive()
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return &chunkedReader{r: t.bufReader()}, nil
+}
+
+// chunkedReader reads the data of a chunked framed message, reading the chunk
+// headers as they come.
+type chunkedReader struct {
+	r *bufio.Reader
+	// remaining is the number of bytes left in the current chunk
+	remaining uint64
+	chunks    int
+	// err is returned by any further read, io.EOF after end-of-chunks
+	err error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	for c.remaining == 0 {
+		size, end, err := readChunkHeader(c.r)
+		switch {
+		case err == io.EOF:
+			c.err = io.ErrUnexpectedEOF
+		case err != nil:
+			c.err = err
+		case end && c.chunks == 0:
+			c.err = errNoChunks
+		case end:
+			c.err = io.EOF
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.remaining = size
+		c.chunks++
+	}
+
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= uint64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	c.err = err
+	return n, err
+}
+
+// Close reads the rest of the message so the next one can be received.
+func (c *chunkedReader) Close() error {
+	_, err := io.Copy(ioutil.Discard, c)
+	return err
+}
+
+// readChunkSize reads the chunk-size and the terminating LF of a chunk header.
+// The size must be a decimal number between 1 and 4294967295 without leading
+// zeros.
+func readChunkSize(r *bufio.Reader) (uint64, error) {
+	var digits []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		if b == '\n' {
+			break
+		}
+
+		if b < '0' || b > '9' || (len(digits) == 0 && b == '0') {
+			return 0, fmt.Errorf("malformed chunk header: unexpected character %q in chunk-size", b)
+		}
+
+		digits = append(digits, b)
+		if len(digits) > maxChunkSizeDigits {
+			return 0, fmt.Errorf("malformed chunk header: chunk-size too long")
+		}
+	}
+
+	if len(digits) == 0 {
+		return 0, fmt.Errorf("malformed chunk header: missing chunk-size")
+	}
+
+	size, err := strconv.ParseUint(string(digits), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("malformed chunk header: invalid chunk-size %q", digits)
+	}
+	return size, nil
+}
+
+func expectByte(r *bufio.Reader, want byte) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b != want {
+		return fmt.Errorf("malformed chunk header: expected %q, got %q", want, b)
+	}
+	return nil
 }
 
 func (t *transportBasicIO) SendHello(hello *HelloMessage) error {
@@ -140,9 +431,15 @@ func (t *transportBasicIO) WaitForFunc(f func([]byte) (int, error)) ([]byte, err
 			}
 
 			if end > -1 {
+				if err := t.checkReplySize(int64(out.Len() + end)); err != nil {
+					return nil, err
+				}
 				out.Write(buf[0:end])
 				return out.Bytes(), nil
 			}
+			if err := t.checkReplySize(int64(out.Len() + pos + n)); err != nil {
+				return nil, err
+			}
 
 			if pos > 0 {
 				out.Write(buf[0:pos])
@@ -153,7 +450,8 @@ func (t *transportBasicIO) WaitForFunc(f func([]byte) (int, error)) ([]byte, err
 		}
 	}
 
-	return nil, fmt.Errorf("WaitForFunc failed")
+	// the stream ended before the end of the message
+	return nil, fmt.Errorf("WaitForFunc failed: %w", io.EOF)
 }
 
 func (t *transportBasicIO) WaitForBytes(b []byte) ([]byte, error) {
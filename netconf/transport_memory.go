@@ -0,0 +1,119 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"encoding/xml"
+	"io"
+	"sync"
+)
+
+// MemoryTransport is a Transport backed by queued messages, to script the
+// behavior of a device in tests. Messages are exchanged without framing:
+// Receive returns the queued messages in order, starting with the hello, and
+// io.EOF once the queue is empty, and Send records the messages sent.
+type MemoryTransport struct {
+	mu      sync.Mutex
+	queue   [][]byte
+	sent    [][]byte
+	version string
+	closed  bool
+}
+
+// NewMemoryTransport returns a transport receiving messages, the first one
+// being the hello of the server.
+func NewMemoryTransport(messages ...[]byte) *MemoryTransport {
+	t := &MemoryTransport{}
+	t.Enqueue(messages...)
+	return t
+}
+
+// Enqueue adds messages to be received.
+func (t *MemoryTransport) Enqueue(messages ...[]byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queue = append(t.queue, messages...)
+}
+
+// Sent returns the messages sent so far, including the hello.
+func (t *MemoryTransport) Sent() [][]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([][]byte(nil), t.sent...)
+}
+
+// Version returns the framing version set by the session.
+func (t *MemoryTransport) Version() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.version
+}
+
+// Send records data.
+func (t *MemoryTransport) Send(data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return io.ErrClosedPipe
+	}
+	t.sent = append(t.sent, append([]byte(nil), data...))
+	return nil
+}
+
+// Receive returns the next queued message.
+func (t *MemoryTransport) Receive() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, io.ErrClosedPipe
+	}
+	if len(t.queue) == 0 {
+		return nil, io.EOF
+	}
+	data := t.queue[0]
+	t.queue = t.queue[1:]
+	return data, nil
+}
+
+// Close closes the transport, sending and receiving fail afterwards.
+func (t *MemoryTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return nil
+}
+
+// ReceiveHello decodes the next queued message as the hello of the server.
+func (t *MemoryTransport) ReceiveHello() (*HelloMessage, error) {
+	hello := new(HelloMessage)
+
+	val, err := t.Receive()
+	if err != nil {
+		return hello, err
+	}
+
+	err = xml.Unmarshal(val, hello)
+	return hello, err
+}
+
+// SendHello records the hello of the client.
+func (t *MemoryTransport) SendHello(hello *HelloMessage) error {
+	val, err := xml.Marshal(hello)
+	if err != nil {
+		return err
+	}
+	return t.Send(append([]byte(xml.Header), val...))
+}
+
+// SetVersion records the framing version, which doesn't affect the messages.
+func (t *MemoryTransport) SetVersion(version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.version = version
+}
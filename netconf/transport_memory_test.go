@@ -0,0 +1,45 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"io"
+	"testing"
+)
+
+func TestMemoryTransport(t *testing.T) {
+	trans := NewMemoryTransport([]byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities><session-id>3</session-id></hello>`))
+
+	hello, err := trans.ReceiveHello()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hello.SessionID != 3 {
+		t.Errorf("unexpected session-id (want %d, got %d)", 3, hello.SessionID)
+	}
+
+	if _, err := trans.Receive(); err != io.EOF {
+		t.Errorf("got %v, expected %v", err, io.EOF)
+	}
+
+	trans.Enqueue([]byte("<rpc-reply/>"))
+	if data, err := trans.Receive(); err != nil || string(data) != "<rpc-reply/>" {
+		t.Errorf("unexpected message %q, %v", data, err)
+	}
+
+	if err := trans.Send([]byte("<rpc/>")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if sent := trans.Sent(); len(sent) != 1 || string(sent[0]) != "<rpc/>" {
+		t.Errorf("unexpected sent messages %q", sent)
+	}
+
+	trans.Close()
+	if err := trans.Send([]byte("<rpc/>")); err == nil {
+		t.Errorf("expected error after close")
+	}
+}
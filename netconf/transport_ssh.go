@@ -7,11 +7,16 @@
 package netconf
 
 import (
+	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -32,6 +37,47 @@ type TransportSSH struct {
 	transportBasicIO
 	sshClient  *ssh.Client
 	sshSession *ssh.Session
+
+	// conn is the connection the deadlines are set on, only when dialed with
+	// options
+	conn         net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	// stopKeepalive stops the keepalive goroutine if any
+	stopKeepalive     chan struct{}
+	stopKeepaliveOnce sync.Once
+}
+
+// ErrTimeout is returned when a message isn't received or sent within the
+// timeout of the transport. The transport is closed as the stream is left in
+// an unknown state.
+var ErrTimeout = errors.New("timeout")
+
+// SSHOptions holds the optional settings of an SSH transport, zero values
+// disable the corresponding timeout.
+type SSHOptions struct {
+	// DialTimeout bounds the TCP connection and the SSH handshake
+	DialTimeout time.Duration
+	// ReadTimeout bounds the wait for each incoming message
+	ReadTimeout time.Duration
+	// WriteTimeout bounds the sending of each message
+	WriteTimeout time.Duration
+	// Keepalive enables SSH keepalives when its Interval is set
+	Keepalive SSHKeepalive
+	// Session configures the NETCONF session established by
+	// DialSSHWithOptions
+	Session SessionConfig
+}
+
+// SSHKeepalive configures the keepalive requests detecting dead connections
+// on long-lived sessions, such as ones waiting for notifications.
+type SSHKeepalive struct {
+	// Interval is the time between keepalive requests
+	Interval time.Duration
+	// CountMax is the number of consecutive keepalives left unanswered after
+	// which the transport is closed, 3 if zero
+	CountMax int
 }
 
 // Close closes an existing SSH session and socket if they exist.
@@ -41,6 +87,10 @@ func (t *TransportSSH) Close() error {
 		return nil
 	}
 
+	if t.stopKeepalive != nil {
+		t.stopKeepaliveOnce.Do(func() { close(t.stopKeepalive) })
+	}
+
 	// Close the SSH Session if we have one
 	if t.sshSession != nil {
 		if err := t.sshSession.Close(); err != nil {
@@ -83,6 +133,151 @@ func (t *TransportSSH) Dial(target string, config *ssh.ClientConfig) error {
 	return err
 }
 
+// DialWithOptions is Dial applying the timeouts of opts. See SSHOptions.
+func (t *TransportSSH) DialWithOptions(target string, config *ssh.ClientConfig, opts SSHOptions) error {
+	if !strings.Contains(target, ":") {
+		target = fmt.Sprintf("%s:%d", target, sshDefaultPort)
+	}
+
+	conn, err := net.DialTimeout("tcp", target, opts.DialTimeout)
+	if err != nil {
+		return err
+	}
+
+	if opts.DialTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(opts.DialTimeout))
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, target, config)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	t.sshClient = ssh.NewClient(c, chans, reqs)
+	t.conn = conn
+	t.readTimeout = opts.ReadTimeout
+	t.writeTimeout = opts.WriteTimeout
+	if err := t.setupSession(); err != nil {
+		return err
+	}
+
+	if opts.Keepalive.Interval > 0 {
+		t.stopKeepalive = make(chan struct{})
+		go t.keepalive(opts.Keepalive)
+	}
+	return nil
+}
+
+// keepalive sends a keepalive request every interval and closes the transport
+// once CountMax of them in a row failed or went unanswered for an interval.
+func (t *TransportSSH) keepalive(k SSHKeepalive) {
+	countMax := k.CountMax
+	if countMax <= 0 {
+		countMax = 3
+	}
+
+	ticker := time.NewTicker(k.Interval)
+	defer ticker.Stop()
+
+	replies := make(chan error, 1)
+	pending := false
+	missed := 0
+	for {
+		select {
+		case <-t.stopKeepalive:
+			return
+		case err := <-replies:
+			pending = false
+			if err != nil {
+				missed++
+			} else {
+				missed = 0
+			}
+		case <-ticker.C:
+			if pending {
+				missed++
+			} else {
+				pending = true
+				go func() {
+					// any reply, even a failure, shows the server is alive
+					_, _, err := t.sshClient.SendRequest("keepalive@openssh.com", true, nil)
+					replies <- err
+				}()
+			}
+		}
+
+		if missed >= countMax {
+			t.Close()
+			return
+		}
+	}
+}
+
+// Send sends data, failing with ErrTimeout after the write timeout.
+func (t *TransportSSH) Send(data []byte) error {
+	return t.withDeadline(t.writeTimeout, true, func() error {
+		return t.transportBasicIO.Send(data)
+	})
+}
+
+// Receive receives the next message, failing with ErrTimeout after the read
+// timeout.
+func (t *TransportSSH) Receive() ([]byte, error) {
+	var data []byte
+	err := t.withDeadline(t.readTimeout, false, func() error {
+		var err error
+		data, err = t.transportBasicIO.Receive()
+		return err
+	})
+	return data, err
+}
+
+// ReceiveHello receives the hello of the server, failing with ErrTimeout
+// after the read timeout.
+func (t *TransportSSH) ReceiveHello() (*HelloMessage, error) {
+	var hello *HelloMessage
+	err := t.withDeadline(t.readTimeout, false, func() error {
+		var err error
+		hello, err = t.transportBasicIO.ReceiveHello()
+		return err
+	})
+	return hello, err
+}
+
+// SendHello sends the hello of the client, failing with ErrTimeout after the
+// write timeout.
+func (t *TransportSSH) SendHello(hello *HelloMessage) error {
+	return t.withDeadline(t.writeTimeout, true, func() error {
+		return t.transportBasicIO.SendHello(hello)
+	})
+}
+
+// withDeadline runs f with a read or write deadline timeout from now set on
+// the connection. Hitting the deadline breaks the SSH connection, which is
+// then closed and ErrTimeout returned.
+func (t *TransportSSH) withDeadline(timeout time.Duration, write bool, f func() error) error {
+	if timeout <= 0 || t.conn == nil {
+		return f()
+	}
+
+	set := t.conn.SetReadDeadline
+	if write {
+		set = t.conn.SetWriteDeadline
+	}
+
+	deadline := time.Now().Add(timeout)
+	set(deadline)
+	err := f()
+	set(time.Time{})
+
+	if err != nil && !time.Now().Before(deadline) {
+		t.Close()
+		return ErrTimeout
+	}
+	return err
+}
+
 func (t *TransportSSH) setupSession() error {
 	var err error
 
@@ -105,14 +300,24 @@ func (t *TransportSSH) setupSession() error {
 	return t.sshSession.RequestSubsystem(sshNetconfSubsystem)
 }
 
-// NewSSHSession creates a new NETCONF session using an existing net.Conn.
+// NewSSHSession creates a new NETCONF session using an existing net.Conn,
+// running the SSH and NETCONF handshakes over it. conn may be any established
+// connection such as a serial console, a connection through a TLS-terminating
+// proxy or one end of net.Pipe in tests. conn is closed on failure, and by
+// closing the session otherwise.
 func NewSSHSession(conn net.Conn, config *ssh.ClientConfig) (*Session, error) {
 	t, err := connToTransport(conn, config)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
-	return NewSession(t), nil
+	s, err := NewSessionContext(context.Background(), t)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return s, nil
 }
 
 // DialSSH creates a new NETCONF session using a SSH Transport.
@@ -127,6 +332,116 @@ func DialSSH(target string, config *ssh.ClientConfig) (*Session, error) {
 	return NewSession(&t), nil
 }
 
+// DialSSHContext creates a new NETCONF session using a SSH Transport.
+// See TransportSSH.Dial for arguments.
+// ctx bounds connection establishment, the SSH handshake and the hello exchange.
+func DialSSHContext(ctx context.Context, target string, config *ssh.ClientConfig) (*Session, error) {
+	if !strings.Contains(target, ":") {
+		target = fmt.Sprintf("%s:%d", target, sshDefaultPort)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := closeOnDone(ctx, conn)
+	t, err := connToTransport(conn, config)
+	if stop() {
+		if t != nil {
+			t.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s, err := NewSessionContext(ctx, t)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// DialSSHWithOptions creates a new NETCONF session using a SSH Transport
+// applying the timeouts of opts. See TransportSSH.Dial for the other
+// arguments.
+func DialSSHWithOptions(target string, config *ssh.ClientConfig, opts SSHOptions) (*Session, error) {
+	var t TransportSSH
+	if err := t.DialWithOptions(target, config, opts); err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	s, err := NewSessionWithConfig(context.Background(), &t, opts.Session)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// DialJumpHost connects to the SSH server at addr through the jump host
+// client via, or directly if via is nil, and returns a client to use as the
+// jump host of the next hop. addr can omit the port in which case the SSH
+// port of 22 is used. The returned client must be closed by the caller, after
+// the clients and sessions using it.
+//
+//	bastion, err := DialJumpHost(nil, "bastion1", bastionConfig)
+//	inner, err := DialJumpHost(bastion, "bastion2", bastionConfig)
+//	s, err := DialThroughProxy(inner, "10.0.0.1", deviceConfig)
+func DialJumpHost(via *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if !strings.Contains(addr, ":") {
+		addr = net.JoinHostPort(addr, sshStandardPort)
+	}
+	if via == nil {
+		return ssh.Dial("tcp", addr, config)
+	}
+
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// DialThroughProxy creates a new NETCONF session using a SSH Transport
+// tunneled through the jump host client bastion, see DialJumpHost to chain
+// several of them. See TransportSSH.Dial for the other arguments. Closing the
+// session doesn't close bastion.
+func DialThroughProxy(bastion *ssh.Client, addr string, config *ssh.ClientConfig) (*Session, error) {
+	if !strings.Contains(addr, ":") {
+		addr = fmt.Sprintf("%s:%d", addr, sshDefaultPort)
+	}
+
+	conn, err := bastion.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := addrConnToTransport(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s, err := NewSessionContext(context.Background(), t)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
 // DialSSHTimeout creates a new NETCONF session using a SSH Transport with timeout.
 // See TransportSSH.Dial for arguments.
 // The timeout value is used for both connection establishment and Read/Write operations.
@@ -145,6 +460,12 @@ func DialSSHTimeout(target string, config *ssh.ClientConfig, timeout time.Durati
 		return nil, err
 	}
 
+	s, err := NewSessionContext(context.Background(), t)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+
 	go func() {
 		ticker := time.NewTicker(timeout / 2)
 		defer ticker.Stop()
@@ -156,7 +477,7 @@ func DialSSHTimeout(target string, config *ssh.ClientConfig, timeout time.Durati
 		}
 	}()
 
-	return NewSession(t), nil
+	return s, nil
 }
 
 // SSHConfigPassword is a convenience function that takes a username and password
@@ -175,15 +496,65 @@ func SSHConfigPassword(user string, pass string) *ssh.ClientConfig {
 // SSHConfigPubKeyFile is a convenience function that takes a username and private key
 // and returns a new ssh.ClientConfig setup to pass credentials to DialSSH
 func SSHConfigPubKeyFile(user string, file string) (*ssh.ClientConfig, error) {
+	return SSHConfigPubKeyFileWithPassphrase(user, file, "")
+}
+
+// SSHConfigPubKeyFileWithPassphrase is SSHConfigPubKeyFile for a private key
+// encrypted with passphrase, either in the OpenSSH or in the legacy PEM
+// format. An unencrypted key is accepted whatever the passphrase.
+//
+// A file that can't be read is reported as a *KeyFileError, a wrong
+// passphrase as ErrIncorrectPassphrase and a missing one as an
+// *ssh.PassphraseMissingError.
+func SSHConfigPubKeyFileWithPassphrase(user, file, passphrase string) (*ssh.ClientConfig, error) {
 	buf, err := ioutil.ReadFile(file)
 	if err != nil {
-		return nil, err
+		return nil, &KeyFileError{File: file, Err: err}
 	}
-	if len(buf) == 0 {
+	return sshConfigPubKey(user, buf, passphrase)
+}
+
+// SSHConfigPubKeyBytes is SSHConfigPubKeyFileWithPassphrase for a PEM encoded
+// private key held in memory, the passphrase is only used if the key is
+// encrypted.
+func SSHConfigPubKeyBytes(user string, pemBytes []byte, passphrase string) (*ssh.ClientConfig, error) {
+	return sshConfigPubKey(user, pemBytes, passphrase)
+}
+
+// ErrIncorrectPassphrase is returned when a private key can't be decrypted
+// with the given passphrase.
+var ErrIncorrectPassphrase = errors.New("incorrect private key passphrase")
+
+// KeyFileError is returned when a private key file can't be read.
+type KeyFileError struct {
+	File string
+	Err  error
+}
+
+func (e *KeyFileError) Error() string {
+	return fmt.Sprintf("can't read key file %s: %v", e.File, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *KeyFileError) Unwrap() error {
+	return e.Err
+}
+
+// sshConfigPubKey returns a config authenticating user with the PEM encoded
+// private key, decrypted with passphrase if encrypted.
+func sshConfigPubKey(user string, pemBytes []byte, passphrase string) (*ssh.ClientConfig, error) {
+	if len(pemBytes) == 0 {
 		return nil, fmt.Errorf("no key")
 	}
 
-	parsedKey, err := ssh.ParsePrivateKey(buf)
+	parsedKey, err := ssh.ParsePrivateKey(pemBytes)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && passphrase != "" {
+		parsedKey, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+		if err == x509.IncorrectPasswordError {
+			err = ErrIncorrectPassphrase
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -194,27 +565,104 @@ func SSHConfigPubKeyFile(user string, file string) (*ssh.ClientConfig, error) {
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}, nil
-
 }
 
 // SSHConfigPubKeyAgent is a convience function that takes a username and
 // returns a new ssh.Clientconfig setup to pass credentials received from
-// an ssh agent
+// an ssh agent listening on SSH_AUTH_SOCK. The agent is only connected to
+// while listing the keys and signing, so the config holds no connection. The
+// HostKeyCallback is left to the caller.
 func SSHConfigPubKeyAgent(user string) (*ssh.ClientConfig, error) {
-	c, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("no ssh-agent: SSH_AUTH_SOCK is not set")
+	}
+
+	var keys []*agent.Key
+	err := withAgent(sock, func(a agent.ExtendedAgent) (err error) {
+		keys, err = a.List()
+		if err != nil {
+			return fmt.Errorf("can't list ssh-agent keys: %v", err)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("ssh-agent has no keys")
+	}
+
+	signers := make([]ssh.Signer, len(keys))
+	for i, key := range keys {
+		signers[i] = &agentSigner{sock: sock, key: key}
+	}
 	return &ssh.ClientConfig{
 		User: user,
 		Auth: []ssh.AuthMethod{
-			ssh.PublicKeysCallback(agent.NewClient(c).Signers),
+			ssh.PublicKeys(signers...),
 		},
 	}, nil
 }
 
+// withAgent calls fn with a client of the ssh-agent listening on sock,
+// connected for the duration of the call.
+func withAgent(sock string, fn func(agent.ExtendedAgent) error) error {
+	c, err := net.Dial("unix", sock)
+	if err != nil {
+		return fmt.Errorf("can't connect to ssh-agent: %v", err)
+	}
+	defer c.Close()
+	return fn(agent.NewClient(c))
+}
+
+// agentSigner signs with a key of the ssh-agent listening on sock, connecting
+// to it for each signature.
+type agentSigner struct {
+	sock string
+	key  ssh.PublicKey
+}
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+// SignWithAlgorithm asks the agent for a rsa-sha2 signature when algorithm
+// is one, the agent has its own entropy source.
+func (s *agentSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	var flags agent.SignatureFlags
+	switch algorithm {
+	case ssh.SigAlgoRSASHA2256:
+		flags = agent.SignatureFlagRsaSha256
+	case ssh.SigAlgoRSASHA2512:
+		flags = agent.SignatureFlagRsaSha512
+	}
+
+	var sig *ssh.Signature
+	err := withAgent(s.sock, func(a agent.ExtendedAgent) (err error) {
+		sig, err = a.SignWithFlags(s.key, data, flags)
+		return err
+	})
+	return sig, err
+}
+
 func connToTransport(conn net.Conn, config *ssh.ClientConfig) (*TransportSSH, error) {
-	c, chans, reqs, err := ssh.NewClientConn(conn, conn.RemoteAddr().String(), config)
+	// connections which aren't network ones may have no remote address
+	addr := "netconf"
+	if remote := conn.RemoteAddr(); remote != nil {
+		addr = remote.String()
+	}
+	return addrConnToTransport(conn, addr, config)
+}
+
+// addrConnToTransport is connToTransport for a connection to addr, which is
+// passed to the host key callback instead of the remote address of conn.
+func addrConnToTransport(conn net.Conn, addr string, config *ssh.ClientConfig) (*TransportSSH, error) {
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
 	if err != nil {
 		return nil, err
 	}
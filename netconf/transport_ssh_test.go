@@ -7,12 +7,94 @@
 package netconf
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"reflect"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
+const sshTestHello = `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities>
+<session-id>7</session-id>
+</hello>]]>]]>`
+
+// newSSHTestHostKey generates a host key for a test SSH server.
+func newSSHTestHostKey(t *testing.T) ssh.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	return signer
+}
+
+// serveSSHTestDevice runs the server side of an SSH connection on conn acting
+// as a NETCONF device: it accepts the netconf subsystem, sends a hello and
+// discards everything it receives.
+func serveSSHTestDevice(conn net.Conn, hostKey ssh.Signer) error {
+	return serveSSHTestDeviceRequests(conn, hostKey, sshTestHello, ssh.DiscardRequests)
+}
+
+// serveSSHTestDeviceRequests is serveSSHTestDevice sending hello and handling
+// the global requests with handle.
+func serveSSHTestDeviceRequests(conn net.Conn, hostKey ssh.Signer, hello string, handle func(<-chan *ssh.Request)) error {
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(hostKey)
+
+	sc, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+	go handle(reqs)
+
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			for req := range chReqs {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == sshNetconfSubsystem
+				req.Reply(ok, nil)
+				if ok {
+					ch.Write([]byte(hello))
+				}
+			}
+		}()
+
+		go func() {
+			defer ch.Close()
+			buf := make([]byte, 4096)
+			for {
+				if _, err := ch.Read(buf); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
 func TestSSHConfigPassword(t *testing.T) {
 	user := "test"
 	password := "testPass"
@@ -44,3 +126,305 @@ func TestSSHConfigPassword(t *testing.T) {
 		t.Errorf("host key method of %s does not contain expected InsecureIgnoreHostKey", hostKeyMethod)
 	}
 }
+
+// listenSSHTestDevice serves SSH test devices (see serveSSHTestDevice) and
+// returns the address to connect to.
+func listenSSHTestDevice(t *testing.T) string {
+	return listenSSHTestDeviceRequests(t, sshTestHello, ssh.DiscardRequests)
+}
+
+// listenSSHTestDeviceRequests is listenSSHTestDevice sending hello and
+// handling the global requests with handle.
+func listenSSHTestDeviceRequests(t *testing.T, hello string, handle func(<-chan *ssh.Request)) string {
+	hostKey := newSSHTestHostKey(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSHTestDeviceRequests(conn, hostKey, hello, handle)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDialSSHWithOptionsReadTimeout(t *testing.T) {
+	addr := listenSSHTestDevice(t)
+
+	s, err := DialSSHWithOptions(addr, SSHConfigPassword("admin", "secret"), SSHOptions{
+		DialTimeout: 5 * time.Second,
+		ReadTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.SessionID() != 7 {
+		t.Errorf("unexpected session-id (want %d, got %d)", 7, s.SessionID())
+	}
+
+	// the test device never replies
+	start := time.Now()
+	if _, err := s.Exec(MethodGetConfig("running")); !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, expected %v", err, ErrTimeout)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("timeout took %s", d)
+	}
+
+	// the transport is closed after a timeout
+	if _, err := s.Exec(MethodGetConfig("running")); err != ErrSessionClosed {
+		t.Errorf("got %v, expected %v", err, ErrSessionClosed)
+	}
+}
+
+func TestDialSSHWithOptionsDialTimeout(t *testing.T) {
+	// a listener that never completes the SSH handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	_, err = DialSSHWithOptions(ln.Addr().String(), SSHConfigPassword("admin", "secret"), SSHOptions{
+		DialTimeout: 100 * time.Millisecond,
+	})
+	if err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestSSHKeepalive(t *testing.T) {
+	tt := []struct {
+		name   string
+		handle func(<-chan *ssh.Request)
+		closed bool
+	}{
+		{"answered", ssh.DiscardRequests, false},
+		{"unanswered", func(reqs <-chan *ssh.Request) {
+			for range reqs {
+				// never reply, as a device behind a dropped connection
+			}
+		}, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := listenSSHTestDeviceRequests(t, sshTestHello, tc.handle)
+
+			var trans TransportSSH
+			err := trans.DialWithOptions(addr, SSHConfigPassword("admin", "secret"), SSHOptions{
+				Keepalive: SSHKeepalive{Interval: 20 * time.Millisecond, CountMax: 2},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer trans.Close()
+
+			time.Sleep(200 * time.Millisecond)
+
+			_, err = trans.sshClient.NewSession()
+			if (err != nil) != tc.closed {
+				t.Errorf("unexpected connection state: %v", err)
+			}
+		})
+	}
+}
+
+// listenSSHTestJumpHost serves an SSH server forwarding direct-tcpip channels
+// and returns its address.
+func listenSSHTestJumpHost(t *testing.T) string {
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(newSSHTestHostKey(t))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				sc, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				defer sc.Close()
+				go ssh.DiscardRequests(reqs)
+
+				for newCh := range chans {
+					var target struct {
+						Host       string
+						Port       uint32
+						OriginHost string
+						OriginPort uint32
+					}
+					if newCh.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newCh.ExtraData(), &target) != nil {
+						newCh.Reject(ssh.UnknownChannelType, "unsupported channel")
+						continue
+					}
+
+					dst, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+					if err != nil {
+						newCh.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, chReqs, err := newCh.Accept()
+					if err != nil {
+						dst.Close()
+						continue
+					}
+					go ssh.DiscardRequests(chReqs)
+					go func() {
+						io.Copy(ch, dst)
+						ch.Close()
+					}()
+					go func() {
+						io.Copy(dst, ch)
+						dst.Close()
+					}()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDialThroughProxy(t *testing.T) {
+	device := listenSSHTestDevice(t)
+	config := SSHConfigPassword("admin", "secret")
+
+	// the host key callback sees the target address, not the tunnel one
+	var hostnames []string
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostnames = append(hostnames, hostname)
+		return nil
+	}
+
+	outer, err := DialJumpHost(nil, listenSSHTestJumpHost(t), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer outer.Close()
+
+	inner, err := DialJumpHost(outer, listenSSHTestJumpHost(t), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer inner.Close()
+
+	s, err := DialThroughProxy(inner, device, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	if s.SessionID() != 7 {
+		t.Errorf("unexpected session-id (want %d, got %d)", 7, s.SessionID())
+	}
+	if len(hostnames) != 3 || hostnames[2] != device {
+		t.Errorf("unexpected host key callback hostnames %v", hostnames)
+	}
+}
+
+// sshTestBadHello is the hello of a device advertising no base capability.
+const sshTestBadHello = `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:example</capability></capabilities><session-id>7</session-id></hello>]]>]]>`
+
+func TestDialThroughProxyHelloError(t *testing.T) {
+	device := listenSSHTestDeviceRequests(t, sshTestBadHello, ssh.DiscardRequests)
+	config := SSHConfigPassword("admin", "secret")
+
+	bastion, err := DialJumpHost(nil, listenSSHTestJumpHost(t), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bastion.Close()
+
+	if _, err := DialThroughProxy(bastion, device, config); !errors.Is(err, ErrNoCommonBase) {
+		t.Errorf("got %v, expected %v", err, ErrNoCommonBase)
+	}
+}
+
+func TestDialSSHTimeoutHelloError(t *testing.T) {
+	device := listenSSHTestDeviceRequests(t, sshTestBadHello, ssh.DiscardRequests)
+
+	if _, err := DialSSHTimeout(device, SSHConfigPassword("admin", "secret"), 5*time.Second); !errors.Is(err, ErrNoCommonBase) {
+		t.Errorf("got %v, expected %v", err, ErrNoCommonBase)
+	}
+}
+
+// noAddrConn is a connection without remote address, like a serial console.
+type noAddrConn struct {
+	net.Conn
+}
+
+func (c noAddrConn) RemoteAddr() net.Addr {
+	return nil
+}
+
+func TestNewSSHSession(t *testing.T) {
+	addr := listenSSHTestDevice(t)
+
+	tests := []struct {
+		name string
+		wrap func(net.Conn) net.Conn
+	}{
+		{"tcp", func(c net.Conn) net.Conn { return c }},
+		{"no remote address", func(c net.Conn) net.Conn { return noAddrConn{c} }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+
+			s, err := NewSSHSession(tc.wrap(conn), SSHConfigPassword("admin", "secret"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer s.Close()
+
+			if s.SessionID() != 7 {
+				t.Errorf("got session-id %d, expected %d", s.SessionID(), 7)
+			}
+		})
+	}
+}
+
+// closeTrackingConn records whether it was closed.
+type closeTrackingConn struct {
+	net.Conn
+	closed bool
+}
+
+func (c *closeTrackingConn) Close() error {
+	c.closed = true
+	return c.Conn.Close()
+}
+
+func TestNewSSHSessionHandshakeError(t *testing.T) {
+	client, server := net.Pipe()
+	// the peer goes away before the SSH handshake
+	server.Close()
+
+	conn := &closeTrackingConn{Conn: client}
+	if _, err := NewSSHSession(conn, SSHConfigPassword("admin", "secret")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if !conn.closed {
+		t.Error("expected the connection to be closed")
+	}
+}
@@ -9,9 +9,12 @@ package netconf
 import (
 	"bytes"
 	"encoding/xml"
+	"errors"
 	"io"
 	"regexp"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -42,6 +45,22 @@ func newTransportTest(input string) (*transportTest, *bytes.Buffer) {
 	return &t, testWriter
 }
 
+type pipeCloser struct {
+	*io.PipeReader
+	io.Writer
+}
+
+// newPipeTransportTest returns a transport whose reads block until data is
+// written to the returned pipe or the transport is closed.
+func newPipeTransportTest() (*transportTest, *io.PipeWriter, *bytes.Buffer) {
+	pr, pw := io.Pipe()
+	testWriter := new(bytes.Buffer)
+
+	var t transportTest
+	t.ReadWriteCloser = &pipeCloser{pr, testWriter}
+	return &t, pw, testWriter
+}
+
 func TestReceiveHello(t *testing.T) {
 	tt := []struct {
 		name     string
@@ -206,3 +225,177 @@ func TestWaitForBytesEmpty(t *testing.T) {
 		t.Errorf("WaitForBytes should error on empty input!")
 	}
 }
+
+func TestSendChunked(t *testing.T) {
+	trans, out := newTransportTest("")
+	trans.SetVersion("v1.1")
+
+	if err := trans.Send([]byte("<rpc/>")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "\n#6\n<rpc/>\n##\n"
+	if out.String() != expected {
+		t.Errorf("unexpected result: (want %q, got %q)", expected, out.String())
+	}
+}
+
+func TestReceiveChunked(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			name:     "single",
+			input:    "\n#6\n<rpc/>\n##\n",
+			expected: "<rpc/>",
+		},
+		{
+			name:     "multiple",
+			input:    "\n#4\n<rpc\n#17\n message-id=\"102\"\n#2\n/>\n##\n",
+			expected: `<rpc message-id="102"/>`,
+		},
+		{
+			name:  "leadingZero",
+			input: "\n#06\n<rpc/>\n##\n",
+			err:   "malformed chunk header",
+		},
+		{
+			name:  "badSize",
+			input: "\n#6a\n<rpc/>\n##\n",
+			err:   "malformed chunk header",
+		},
+		{
+			name:  "missingSize",
+			input: "\n#\n<rpc/>\n##\n",
+			err:   "malformed chunk header",
+		},
+		{
+			name:  "sizeTooLarge",
+			input: "\n#4294967296\n<rpc/>\n##\n",
+			err:   "malformed chunk header",
+		},
+		{
+			name:  "noChunks",
+			input: "\n##\n",
+			err:   "malformed chunked message",
+		},
+		{
+			name:  "truncated",
+			input: "\n#10\n<rpc/>",
+			err:   "EOF",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// read one byte at a time so chunk headers and the end-of-chunks
+			// marker always land on a read boundary
+			var trans transportTest
+			trans.ReadWriteCloser = newNilCloser(iotest.OneByteReader(strings.NewReader(tc.input)), new(bytes.Buffer))
+			trans.SetVersion("v1.1")
+
+			out, err := trans.Receive()
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if string(out) != tc.expected {
+				t.Errorf("unexpected result: (want %q, got %q)", tc.expected, out)
+			}
+		})
+	}
+}
+
+func TestReceiveChunkedConsecutive(t *testing.T) {
+	trans, _ := newTransportTest("\n#5\n<one>\n##\n\n#5\n<two>\n##\n")
+	trans.SetVersion("v1.1")
+
+	for _, expected := range []string{"<one>", "<two>"} {
+		out, err := trans.Receive()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(out) != expected {
+			t.Errorf("unexpected result: (want %q, got %q)", expected, out)
+		}
+	}
+}
+
+func TestReceiveConsecutive(t *testing.T) {
+	trans, _ := newTransportTest("<one>]]>]]><two>]]>]]>")
+
+	for _, expected := range []string{"<one>", "<two>"} {
+		out, err := trans.Receive()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(out) != expected {
+			t.Errorf("unexpected result: (want %q, got %q)", expected, out)
+		}
+	}
+	if _, err := trans.Receive(); !errors.Is(err, io.EOF) {
+		t.Errorf("got %v, expected %v", err, io.EOF)
+	}
+}
+
+func TestMaxReplyBytes(t *testing.T) {
+	tt := []struct {
+		name    string
+		version string
+		input   string
+		limit   int64
+		tooBig  bool
+	}{
+		{name: "chunkedWithin", version: "v1.1", input: "\n#3\n<a>\n#4\n</a>\n##\n", limit: 7},
+		{name: "chunkedSum", version: "v1.1", input: "\n#3\n<a>\n#4\n</a>\n##\n", limit: 6, tooBig: true},
+		// the chunk is rejected from its header, without reading it
+		{name: "chunkedDefault", version: "v1.1", input: "\n#40000000\n", limit: -1, tooBig: true},
+		{name: "chunkedUnlimited", version: "v1.1", input: "\n#7\n<a></a>\n##\n", limit: 0},
+		{name: "eomWithin", version: "v1.0", input: "<a></a>]]>]]>", limit: 7},
+		{name: "eomExceeded", version: "v1.0", input: "<a></a>]]>]]>", limit: 6, tooBig: true},
+		{name: "eomUnterminated", version: "v1.0", input: strings.Repeat("<a></a>", 4096), limit: 8192, tooBig: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.input)
+			trans.SetVersion(tc.version)
+			if tc.limit >= 0 {
+				trans.SetMaxReplyBytes(tc.limit)
+			}
+
+			_, err := trans.Receive()
+			if tc.tooBig != errors.Is(err, ErrReplyTooLarge) {
+				t.Errorf("got %v, expected too large %t", err, tc.tooBig)
+			}
+			if !tc.tooBig && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionSetMaxReplyBytes(t *testing.T) {
+	trans, _ := newTransportTest("")
+	s := &Session{Transport: trans}
+	if err := s.SetMaxReplyBytes(1024); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !trans.maxReplySet || trans.maxReplyBytes != 1024 {
+		t.Errorf("got limit %d, expected %d", trans.maxReplyBytes, 1024)
+	}
+
+	s = &Session{Transport: NewMemoryTransport()}
+	if err := s.SetMaxReplyBytes(1024); err == nil {
+		t.Error("expected an error for a transport without limit")
+	}
+}
@@ -0,0 +1,128 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// tlsDefaultPort is the default port used for NETCONF over TLS (RFC 7589)
+	tlsDefaultPort = 6513
+)
+
+// TransportTLS maintains the information necessary to communicate with the
+// remote device over TLS
+type TransportTLS struct {
+	transportBasicIO
+	tlsConn *tls.Conn
+}
+
+// Close closes an existing TLS connection if it exists.
+func (t *TransportTLS) Close() error {
+	// If TransportTLS is nil ignore closing the connection
+	if t == nil {
+		return nil
+	}
+
+	if t.tlsConn != nil {
+		return t.tlsConn.Close()
+	}
+	return fmt.Errorf("no connection to close")
+}
+
+// Dial connects and performs the TLS handshake
+//
+// target can be an IP address (e.g.) 172.16.1.1 which utlizes the default
+// NETCONF over TLS port of 6513.  Target can also specify a port with the
+// following format <host>:<port (e.g 172.16.1.1:6514)
+//
+// config takes a tls.Config used for the handshake. Client certificates for
+// mutual authentication go in config.Certificates and the server certificate
+// is verified against config.RootCAs. The timeout bounds both connection
+// establishment and the handshake, a zero timeout means no timeout.
+func (t *TransportTLS) Dial(target string, config *tls.Config, timeout time.Duration) error {
+	if !strings.Contains(target, ":") {
+		target = fmt.Sprintf("%s:%d", target, tlsDefaultPort)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", target, config)
+	if err != nil {
+		return err
+	}
+
+	t.tlsConn = conn
+	t.ReadWriteCloser = conn
+	return nil
+}
+
+// DialTLS creates a new NETCONF session using a TLS Transport.
+// See TransportTLS.Dial for arguments.
+func DialTLS(target string, config *tls.Config, timeout time.Duration) (*Session, error) {
+	var t TransportTLS
+	err := t.Dial(target, config, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewSessionContext(context.Background(), &t)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// TLSConfigPinned returns a copy of config that additionally requires the
+// server leaf certificate to match the SHA-256 fingerprint. The fingerprint
+// is hex encoded and may contain colons (e.g. "ab:cd:...").
+func TLSConfigPinned(config *tls.Config, fingerprint string) (*tls.Config, error) {
+	want, err := hex.DecodeString(strings.Replace(fingerprint, ":", "", -1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid fingerprint: %v", err)
+	}
+	if len(want) != sha256.Size {
+		return nil, fmt.Errorf("invalid fingerprint: expected %d bytes, got %d", sha256.Size, len(want))
+	}
+
+	var cfg *tls.Config
+	if config != nil {
+		cfg = config.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+
+	verify := cfg.VerifyPeerCertificate
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+		if verify != nil {
+			if err := verify(rawCerts, chains); err != nil {
+				return err
+			}
+		}
+
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("no server certificate presented")
+		}
+
+		got := sha256.Sum256(rawCerts[0])
+		if !bytes.Equal(got[:], want) {
+			return fmt.Errorf("server certificate fingerprint mismatch: got %x", got)
+		}
+		return nil
+	}
+	return cfg, nil
+}
@@ -0,0 +1,163 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+const tlsTestHello = `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities>
+<session-id>42</session-id>
+</hello>]]>]]>`
+
+// newTLSTestServer starts a TLS listener that sends a hello message to every
+// client and returns its address, certificate and root pool.
+func newTLSTestServer(t *testing.T) (string, tls.Certificate, *x509.CertPool) {
+	return newTLSTestServerHello(t, tlsTestHello)
+}
+
+// newTLSTestServerHello is newTLSTestServer sending hello.
+func newTLSTestServerHello(t *testing.T, hello string) (string, tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "netconf"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte(hello))
+				buf := make([]byte, 4096)
+				for {
+					if _, err := conn.Read(buf); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), cert, roots
+}
+
+func TestDialTLS(t *testing.T) {
+	addr, _, roots := newTLSTestServer(t)
+
+	s, err := DialTLS(addr, &tls.Config{RootCAs: roots}, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	if s.SessionID() != 42 {
+		t.Errorf("unexpected session-id (want %d, got %d)", 42, s.SessionID())
+	}
+}
+
+func TestDialTLSHelloError(t *testing.T) {
+	// a server advertising no base capability
+	addr, _, roots := newTLSTestServerHello(t, `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:example</capability></capabilities><session-id>42</session-id></hello>]]>]]>`)
+
+	if _, err := DialTLS(addr, &tls.Config{RootCAs: roots}, time.Second); !errors.Is(err, ErrNoCommonBase) {
+		t.Errorf("got %v, expected %v", err, ErrNoCommonBase)
+	}
+}
+
+func TestTLSConfigPinned(t *testing.T) {
+	addr, cert, roots := newTLSTestServer(t)
+	sum := sha256.Sum256(cert.Certificate[0])
+
+	tt := []struct {
+		name        string
+		fingerprint string
+		ok          bool
+	}{
+		{
+			name:        "match",
+			fingerprint: fmt.Sprintf("%x", sum),
+			ok:          true,
+		},
+		{
+			name:        "mismatch",
+			fingerprint: fmt.Sprintf("%x", sha256.Sum256([]byte("other"))),
+			ok:          false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := TLSConfigPinned(&tls.Config{RootCAs: roots}, tc.fingerprint)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var trans TransportTLS
+			err = trans.Dial(addr, cfg, time.Second)
+			if err == nil {
+				trans.Close()
+			}
+			if (err == nil) != tc.ok {
+				t.Errorf("unexpected dial result (want ok %v, got %v)", tc.ok, err)
+			}
+		})
+	}
+}
+
+func TestTLSConfigPinnedInvalid(t *testing.T) {
+	if _, err := TLSConfigPinned(nil, "zz"); err == nil {
+		t.Errorf("expected error for invalid fingerprint")
+	}
+	if _, err := TLSConfigPinned(nil, "abcd"); err == nil {
+		t.Errorf("expected error for short fingerprint")
+	}
+}
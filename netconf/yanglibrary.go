@@ -0,0 +1,181 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// yangLibraryNS is the ietf-yang-library namespace, shared by RFC 7895
+	// and RFC 8525
+	yangLibraryNS = "urn:ietf:params:xml:ns:yang:ietf-yang-library"
+
+	// capYangLibrary10 is advertised by servers with the RFC 7895
+	// modules-state, capYangLibrary11 by those with the RFC 8525 yang-library
+	capYangLibrary10 = "urn:ietf:params:netconf:capability:yang-library:1.0"
+	capYangLibrary11 = "urn:ietf:params:netconf:capability:yang-library:1.1"
+)
+
+// YangLibrary lists the YANG modules implemented by the server.
+type YangLibrary struct {
+	// ContentID identifies the content of the library, it is the
+	// module-set-id of the RFC 7895 modules-state
+	ContentID string
+	// Modules are the modules of all the module sets, both implemented and
+	// import-only
+	Modules []YangModule
+	// Legacy is true when the library was read from the RFC 7895
+	// modules-state instead of the RFC 8525 yang-library
+	Legacy bool
+}
+
+// YangModule describes a module of the YANG library.
+type YangModule struct {
+	Name      string
+	Revision  string
+	Namespace string
+	// Features are the features of the module supported by the server
+	Features []string
+	// Deviations are the names of the modules deviating this module
+	Deviations []string
+	// Location are the URLs the module can be retrieved from
+	Location   []string
+	Submodules []YangSubmodule
+	// ImportOnly is true for modules only present for their definitions
+	ImportOnly bool
+	// ModuleSet is the module set holding the module, empty for the RFC 7895
+	// modules-state
+	ModuleSet string
+}
+
+// YangSubmodule describes a submodule of a module of the YANG library.
+type YangSubmodule struct {
+	Name     string   `xml:"name"`
+	Revision string   `xml:"revision"`
+	Location []string `xml:"location"`
+}
+
+// yangLibraryModule is a module of the RFC 8525 yang-library.
+type yangLibraryModule struct {
+	Name       string          `xml:"name"`
+	Revision   string          `xml:"revision"`
+	Namespace  string          `xml:"namespace"`
+	Location   []string        `xml:"location"`
+	Features   []string        `xml:"feature"`
+	Deviations []string        `xml:"deviation"`
+	Submodules []YangSubmodule `xml:"submodule"`
+}
+
+// yangLibrary is the RFC 8525 yang-library container.
+type yangLibrary struct {
+	ContentID  string `xml:"content-id"`
+	ModuleSets []struct {
+		Name              string              `xml:"name"`
+		Modules           []yangLibraryModule `xml:"module"`
+		ImportOnlyModules []yangLibraryModule `xml:"import-only-module"`
+	} `xml:"module-set"`
+}
+
+// modulesState is the RFC 7895 modules-state container.
+type modulesState struct {
+	ModuleSetID string `xml:"module-set-id"`
+	Modules     []struct {
+		Name            string   `xml:"name"`
+		Revision        string   `xml:"revision"`
+		Schema          string   `xml:"schema"`
+		Namespace       string   `xml:"namespace"`
+		Features        []string `xml:"feature"`
+		ConformanceType string   `xml:"conformance-type"`
+		Deviations      []struct {
+			Name string `xml:"name"`
+		} `xml:"deviation"`
+		Submodules []struct {
+			Name     string `xml:"name"`
+			Revision string `xml:"revision"`
+			Schema   string `xml:"schema"`
+		} `xml:"submodule"`
+	} `xml:"module"`
+}
+
+// YangLibrary retrieves the YANG library of the server, from the RFC 8525
+// yang-library when the server advertises :yang-library:1.1, from the RFC 7895
+// modules-state when it advertises :yang-library:1.0.
+func (s *Session) YangLibrary(ctx context.Context) (*YangLibrary, error) {
+	switch {
+	case hasCapability(s.serverCapabilities, capYangLibrary11):
+		var v yangLibrary
+		if err := s.getState(ctx, fmt.Sprintf(`<yang-library xmlns="%s"/>`, yangLibraryNS), &v); err != nil {
+			return nil, err
+		}
+		return v.library(), nil
+
+	case hasCapability(s.serverCapabilities, capYangLibrary10):
+		var v modulesState
+		if err := s.getState(ctx, fmt.Sprintf(`<modules-state xmlns="%s"/>`, yangLibraryNS), &v); err != nil {
+			return nil, err
+		}
+		return v.library(), nil
+	}
+	return nil, fmt.Errorf("yang library requires the :yang-library capability")
+}
+
+func (v *yangLibrary) library() *YangLibrary {
+	lib := &YangLibrary{ContentID: v.ContentID}
+	for _, set := range v.ModuleSets {
+		for _, m := range set.Modules {
+			lib.Modules = append(lib.Modules, m.module(set.Name, false))
+		}
+		for _, m := range set.ImportOnlyModules {
+			lib.Modules = append(lib.Modules, m.module(set.Name, true))
+		}
+	}
+	return lib
+}
+
+func (m *yangLibraryModule) module(set string, importOnly bool) YangModule {
+	return YangModule{
+		Name:       m.Name,
+		Revision:   m.Revision,
+		Namespace:  m.Namespace,
+		Features:   m.Features,
+		Deviations: m.Deviations,
+		Location:   m.Location,
+		Submodules: m.Submodules,
+		ImportOnly: importOnly,
+		ModuleSet:  set,
+	}
+}
+
+func (v *modulesState) library() *YangLibrary {
+	lib := &YangLibrary{ContentID: v.ModuleSetID, Legacy: true}
+	for _, m := range v.Modules {
+		module := YangModule{
+			Name:       m.Name,
+			Revision:   m.Revision,
+			Namespace:  m.Namespace,
+			Features:   m.Features,
+			ImportOnly: m.ConformanceType == "import",
+		}
+		if m.Schema != "" {
+			module.Location = []string{m.Schema}
+		}
+		for _, d := range m.Deviations {
+			module.Deviations = append(module.Deviations, d.Name)
+		}
+		for _, sub := range m.Submodules {
+			submodule := YangSubmodule{Name: sub.Name, Revision: sub.Revision}
+			if sub.Schema != "" {
+				submodule.Location = []string{sub.Schema}
+			}
+			module.Submodules = append(module.Submodules, submodule)
+		}
+		lib.Modules = append(lib.Modules, module)
+	}
+	return lib
+}
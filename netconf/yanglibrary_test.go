@@ -0,0 +1,127 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestYangLibrary(t *testing.T) {
+	tt := []struct {
+		name     string
+		cap      string
+		reply    string
+		request  string
+		expected *YangLibrary
+	}{
+		{
+			name: "rfc8525",
+			cap:  capYangLibrary11 + "?revision=2019-01-04&content-id=42",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>
+<yang-library xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-library">
+<module-set><name>complete</name>
+<module><name>ietf-interfaces</name><revision>2018-02-20</revision><namespace>urn:ietf:params:xml:ns:yang:ietf-interfaces</namespace><feature>arbitrary-names</feature><feature>pre-provisioning</feature><deviation>acme-deviations</deviation></module>
+<module><name>acme-system</name><namespace>http://example.com/acme</namespace><location>https://example.com/acme-system.yang</location><submodule><name>acme-types</name><revision>2021-01-01</revision></submodule></module>
+<import-only-module><name>ietf-inet-types</name><revision>2013-07-15</revision><namespace>urn:ietf:params:xml:ns:yang:ietf-inet-types</namespace></import-only-module>
+</module-set>
+<schema><name>complete</name><module-set>complete</module-set></schema>
+<content-id>42</content-id>
+</yang-library>
+</data></rpc-reply>`,
+			request: "<yang-library ",
+			expected: &YangLibrary{
+				ContentID: "42",
+				Modules: []YangModule{
+					{
+						Name:       "ietf-interfaces",
+						Revision:   "2018-02-20",
+						Namespace:  "urn:ietf:params:xml:ns:yang:ietf-interfaces",
+						Features:   []string{"arbitrary-names", "pre-provisioning"},
+						Deviations: []string{"acme-deviations"},
+						ModuleSet:  "complete",
+					},
+					{
+						Name:       "acme-system",
+						Namespace:  "http://example.com/acme",
+						Location:   []string{"https://example.com/acme-system.yang"},
+						Submodules: []YangSubmodule{{Name: "acme-types", Revision: "2021-01-01"}},
+						ModuleSet:  "complete",
+					},
+					{
+						Name:       "ietf-inet-types",
+						Revision:   "2013-07-15",
+						Namespace:  "urn:ietf:params:xml:ns:yang:ietf-inet-types",
+						ImportOnly: true,
+						ModuleSet:  "complete",
+					},
+				},
+			},
+		},
+		{
+			name: "rfc7895",
+			cap:  capYangLibrary10 + "?revision=2016-06-21&module-set-id=abc",
+			reply: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>
+<modules-state xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-library">
+<module-set-id>abc</module-set-id>
+<module><name>ietf-interfaces</name><revision>2014-05-08</revision><schema>https://example.com/ietf-interfaces.yang</schema><namespace>urn:ietf:params:xml:ns:yang:ietf-interfaces</namespace><feature>if-mib</feature><deviation><name>acme-deviations</name><revision>2021-01-01</revision></deviation><conformance-type>implement</conformance-type><submodule><name>ietf-interfaces-sub</name><revision>2014-05-08</revision><schema>https://example.com/sub.yang</schema></submodule></module>
+<module><name>ietf-yang-types</name><revision>2013-07-15</revision><namespace>urn:ietf:params:xml:ns:yang:ietf-yang-types</namespace><conformance-type>import</conformance-type></module>
+</modules-state>
+</data></rpc-reply>`,
+			request: "<modules-state ",
+			expected: &YangLibrary{
+				ContentID: "abc",
+				Legacy:    true,
+				Modules: []YangModule{
+					{
+						Name:       "ietf-interfaces",
+						Revision:   "2014-05-08",
+						Namespace:  "urn:ietf:params:xml:ns:yang:ietf-interfaces",
+						Features:   []string{"if-mib"},
+						Deviations: []string{"acme-deviations"},
+						Location:   []string{"https://example.com/ietf-interfaces.yang"},
+						Submodules: []YangSubmodule{{Name: "ietf-interfaces-sub", Revision: "2014-05-08", Location: []string{"https://example.com/sub.yang"}}},
+					},
+					{
+						Name:       "ietf-yang-types",
+						Revision:   "2013-07-15",
+						Namespace:  "urn:ietf:params:xml:ns:yang:ietf-yang-types",
+						ImportOnly: true,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, trans := newMemorySession(t, tc.reply)
+			s.serverCapabilities = append(s.serverCapabilities, tc.cap)
+
+			lib, err := s.YangLibrary(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, lib); diff != "" {
+				t.Errorf("unexpected library (-want +got):\n%s", diff)
+			}
+			if !strings.Contains(string(trans.Sent()[1]), tc.request) {
+				t.Errorf("unexpected request %s", trans.Sent()[1])
+			}
+		})
+	}
+}
+
+func TestYangLibraryCapability(t *testing.T) {
+	s := &Session{serverCapabilities: []string{capBase10}}
+	if _, err := s.YangLibrary(context.Background()); err == nil {
+		t.Errorf("expected error without :yang-library capability")
+	}
+}
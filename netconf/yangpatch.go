@@ -0,0 +1,148 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// yangPatchNS is the ietf-yang-patch (RFC 8072) namespace
+const yangPatchNS = "urn:ietf:params:xml:ns:yang:ietf-yang-patch"
+
+// PatchOperation is the operation of a YANG patch edit.
+type PatchOperation string
+
+// Edit operations defined by RFC 8072.
+const (
+	PatchCreate  PatchOperation = "create"
+	PatchDelete  PatchOperation = "delete"
+	PatchInsert  PatchOperation = "insert"
+	PatchMerge   PatchOperation = "merge"
+	PatchMove    PatchOperation = "move"
+	PatchReplace PatchOperation = "replace"
+	PatchRemove  PatchOperation = "remove"
+)
+
+// YangPatch is an ordered list of edits (RFC 8072), as sent by YANG-push for
+// on-change subscriptions.
+type YangPatch struct {
+	PatchID string
+	Comment string
+	Edits   []YangPatchEdit
+}
+
+// YangPatchEdit is an edit of a YangPatch, to be applied in order.
+type YangPatchEdit struct {
+	EditID    string
+	Operation PatchOperation
+	// Target is the path of the data node the edit applies to, relative to
+	// the target of the patch, e.g. /ietf-interfaces:interfaces/interface=eth0
+	Target string
+	// Point and Where position the entry of an ordered list or leaf-list for
+	// insert and move: Where is before, after, first or last, the default,
+	// Point the path of the entry referred to by before and after
+	Point string
+	Where string
+	// Value holds the new data of create, insert, merge and replace, with
+	// the namespace declarations of the patch
+	Value []*etree.Element
+}
+
+// ParseYangPatch decodes the yang-patch element el and checks each edit
+// carries what its operation requires: a value for create, insert, merge and
+// replace, none for delete, move and remove, and a valid position for insert
+// and move. el is in the ietf-yang-patch namespace, or the ietf-yang-push one
+// within a push-change-update.
+func ParseYangPatch(el *etree.Element) (*YangPatch, error) {
+	if el == nil || el.Tag != "yang-patch" {
+		return nil, fmt.Errorf("not a yang-patch")
+	}
+	if ns := el.NamespaceURI(); ns != yangPatchNS && ns != yangPushNS {
+		return nil, fmt.Errorf("yang-patch in unexpected namespace %q", ns)
+	}
+
+	patch := &YangPatch{
+		PatchID: childText(el, "patch-id"),
+		Comment: childText(el, "comment"),
+	}
+	for _, editEl := range el.SelectElements("edit") {
+		edit := YangPatchEdit{
+			EditID:    childText(editEl, "edit-id"),
+			Operation: PatchOperation(childText(editEl, "operation")),
+			Target:    childText(editEl, "target"),
+			Point:     childText(editEl, "point"),
+			Where:     childText(editEl, "where"),
+		}
+		if edit.Where == "" && (edit.Operation == PatchInsert || edit.Operation == PatchMove) {
+			edit.Where = "last"
+		}
+		if value := editEl.SelectElement("value"); value != nil {
+			for _, child := range value.ChildElements() {
+				c := child.Copy()
+				inheritNamespaces(c, child)
+				edit.Value = append(edit.Value, c)
+			}
+		}
+		if err := edit.validate(); err != nil {
+			return nil, fmt.Errorf("yang-patch %s edit %s: %w", patch.PatchID, edit.EditID, err)
+		}
+		patch.Edits = append(patch.Edits, edit)
+	}
+	return patch, nil
+}
+
+// validate checks the fields of e against its operation.
+func (e YangPatchEdit) validate() error {
+	if e.Target == "" {
+		return fmt.Errorf("missing target")
+	}
+
+	var needsValue, positioned bool
+	switch e.Operation {
+	case PatchCreate, PatchMerge, PatchReplace:
+		needsValue = true
+	case PatchInsert:
+		needsValue, positioned = true, true
+	case PatchMove:
+		positioned = true
+	case PatchDelete, PatchRemove:
+	default:
+		return fmt.Errorf("unknown operation %q", e.Operation)
+	}
+
+	if needsValue && len(e.Value) == 0 {
+		return fmt.Errorf("%s without value", e.Operation)
+	}
+	if !needsValue && len(e.Value) > 0 {
+		return fmt.Errorf("%s with a value", e.Operation)
+	}
+	if !positioned {
+		return nil
+	}
+	switch e.Where {
+	case "before", "after":
+		if e.Point == "" {
+			return fmt.Errorf("%s %s without point", e.Operation, e.Where)
+		}
+	case "first", "last":
+	default:
+		return fmt.Errorf("%s with invalid where %q", e.Operation, e.Where)
+	}
+	return nil
+}
+
+// childText returns the trimmed text of the child tag of el, empty if there is
+// none.
+func childText(el *etree.Element, tag string) string {
+	if child := el.SelectElement(tag); child != nil {
+		return strings.TrimSpace(child.Text())
+	}
+	return ""
+}
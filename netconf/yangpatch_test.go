@@ -0,0 +1,133 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseYangPatch(t *testing.T) {
+	const value = `<value><interface xmlns="urn:if"><name>eth0</name></interface></value>`
+
+	tt := []struct {
+		name string
+		edit string
+		err  bool
+	}{
+		{"create", `<operation>create</operation><target>/if:interfaces/interface=eth0</target>` + value, false},
+		{"merge", `<operation>merge</operation><target>/if:interfaces/interface=eth0</target>` + value, false},
+		{"replace", `<operation>replace</operation><target>/if:interfaces/interface=eth0</target>` + value, false},
+		{"delete", `<operation>delete</operation><target>/if:interfaces/interface=eth0</target>`, false},
+		{"remove", `<operation>remove</operation><target>/if:interfaces/interface=eth0</target>`, false},
+		{"insert first", `<operation>insert</operation><target>/if:interfaces/interface=eth0</target><where>first</where>` + value, false},
+		{"insert after", `<operation>insert</operation><target>/if:interfaces/interface=eth0</target><point>/if:interfaces/interface=eth1</point><where>after</where>` + value, false},
+		{"move before", `<operation>move</operation><target>/if:interfaces/interface=eth0</target><point>/if:interfaces/interface=eth1</point><where>before</where>`, false},
+		{"unknown operation", `<operation>patch</operation><target>/if:interfaces</target>`, true},
+		{"missing target", `<operation>delete</operation>`, true},
+		{"merge without value", `<operation>merge</operation><target>/if:interfaces</target>`, true},
+		{"delete with value", `<operation>delete</operation><target>/if:interfaces/interface=eth0</target>` + value, true},
+		{"insert without where", `<operation>insert</operation><target>/if:interfaces/interface=eth0</target>` + value, false},
+		{"move without where", `<operation>move</operation><target>/if:interfaces/interface=eth0</target>`, false},
+		{"insert invalid where", `<operation>insert</operation><target>/if:interfaces/interface=eth0</target><where>middle</where>` + value, true},
+		{"move after without point", `<operation>move</operation><target>/if:interfaces/interface=eth0</target><where>after</where>`, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := etree.NewDocument()
+			if err := doc.ReadFromString(fmt.Sprintf(`<yang-patch xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-patch"><patch-id>p1</patch-id><edit><edit-id>e1</edit-id>%s</edit></yang-patch>`, tc.edit)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			patch, err := ParseYangPatch(doc.Root())
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if patch.PatchID != "p1" || len(patch.Edits) != 1 {
+				t.Fatalf("unexpected patch %+v", patch)
+			}
+			if e := patch.Edits[0]; e.EditID != "e1" || string(e.Operation) != tc.name[:len(e.Operation)] {
+				t.Errorf("unexpected edit %+v", e)
+			}
+		})
+	}
+}
+
+func TestParseYangPatchDefaults(t *testing.T) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(`<yang-patch xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push"><patch-id>p1</patch-id>` +
+		`<edit><edit-id>e1</edit-id><operation>move</operation><target>/if:interfaces/interface=eth0</target></edit>` +
+		`<edit><edit-id>e2</edit-id><operation>delete</operation><target>/if:interfaces/interface=eth1</target></edit></yang-patch>`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	patch, err := ParseYangPatch(doc.Root())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// where defaults to last for insert and move only
+	var where []string
+	for _, e := range patch.Edits {
+		where = append(where, e.Where)
+	}
+	if diff := cmp.Diff([]string{"last", ""}, where); diff != "" {
+		t.Errorf("unexpected where (-want +got):\n%s", diff)
+	}
+
+	doc = etree.NewDocument()
+	if err := doc.ReadFromString(`<yang-patch xmlns="urn:example"><patch-id>p1</patch-id></yang-patch>`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ParseYangPatch(doc.Root()); err == nil {
+		t.Errorf("expected an error for a yang-patch in another namespace")
+	}
+}
+
+func TestParseYangPatchValue(t *testing.T) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(`<yang-patch xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-patch" xmlns:ip="urn:ip"><patch-id>p1</patch-id><comment> rename </comment>` +
+		`<edit><edit-id>e1</edit-id><operation>replace</operation><target>/if:interfaces/interface=eth0</target><value><interface xmlns="urn:if"><name>eth0</name><ip:mtu>1500</ip:mtu></interface></value></edit></yang-patch>`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	patch, err := ParseYangPatch(doc.Root())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if patch.Comment != "rename" {
+		t.Errorf("got comment %q, expected %q", patch.Comment, "rename")
+	}
+
+	value := patch.Edits[0].Value
+	if len(value) != 1 {
+		t.Fatalf("got %d value elements, expected 1", len(value))
+	}
+	// the value is detached from the patch but keeps its namespaces
+	if value[0].Parent() != nil {
+		t.Errorf("value still attached to the patch")
+	}
+	out := etree.NewDocument()
+	out.SetRoot(value[0])
+	got, err := out.WriteToString()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `<interface xmlns="urn:if" xmlns:ip="urn:ip"><name>eth0</name><ip:mtu>1500</ip:mtu></interface>`
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("unexpected value (-want +got):\n%s", diff)
+	}
+}
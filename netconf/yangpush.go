@@ -0,0 +1,423 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	// subscribedNotificationsNS is the ietf-subscribed-notifications (RFC
+	// 8639) namespace
+	subscribedNotificationsNS = "urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications"
+	// yangPushNS is the ietf-yang-push (RFC 8641) namespace
+	yangPushNS = "urn:ietf:params:xml:ns:yang:ietf-yang-push"
+)
+
+// ErrSubscriptionTerminated is returned by Subscription.Err when the server
+// terminated a dynamic subscription, the error includes the reason.
+var ErrSubscriptionTerminated = errors.New("subscription terminated")
+
+// SubscriptionOptions describes a dynamic subscription (RFC 8639), either to
+// an event stream or, with YANG-push (RFC 8641), to the updates of a
+// datastore.
+type SubscriptionOptions struct {
+	// Stream is the event stream subscribed to, exclusive with Datastore
+	Stream string
+	// Datastore is the datastore subscribed to, such as Operational
+	Datastore Datastore
+	// XPath selects the events of the stream or the data of the datastore,
+	// everything when empty. Namespaces maps the prefixes it uses to their
+	// namespace.
+	XPath      string
+	Namespaces map[string]string
+	// Period requests the whole selected data periodically, rounded down to
+	// the centisecond. Otherwise OnChange requests the changes, at most once
+	// per DampeningPeriod when set.
+	Period          time.Duration
+	OnChange        bool
+	DampeningPeriod time.Duration
+	// StopTime ends the subscription when set
+	StopTime time.Time
+}
+
+// validate checks the options describe a single kind of subscription.
+func (o SubscriptionOptions) validate() error {
+	switch {
+	case o.Stream == "" && o.Datastore == "":
+		return fmt.Errorf("subscription requires a stream or a datastore")
+	case o.Stream != "" && o.Datastore != "":
+		return fmt.Errorf("subscription to both stream %s and datastore %s", o.Stream, o.Datastore)
+	case o.Stream != "" && (o.Period != 0 || o.OnChange):
+		return fmt.Errorf("periodic and on-change triggers require a datastore")
+	case o.Datastore != "" && (o.Period > 0) == o.OnChange:
+		return fmt.Errorf("datastore subscription requires either a period or on-change")
+	case o.Period < 0 || (o.Period > 0 && o.Period < 10*time.Millisecond):
+		return fmt.Errorf("invalid period %s", o.Period)
+	}
+	return nil
+}
+
+// MethodEstablishSubscription files an establish-subscription request (RFC
+// 8639) with the remote host. See SubscriptionOptions.
+func MethodEstablishSubscription(opts SubscriptionOptions) RawMethod {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<establish-subscription xmlns="%s" xmlns:yp="%s">`, subscribedNotificationsNS, yangPushNS)
+	if opts.Stream != "" {
+		fmt.Fprintf(&buf, "<stream>%s</stream>", escapeText(opts.Stream))
+		if opts.XPath != "" {
+			fmt.Fprintf(&buf, "<stream-xpath-filter%s>%s</stream-xpath-filter>", xmlnsAttrs(opts.Namespaces), escapeText(opts.XPath))
+		}
+	}
+	if opts.Datastore != "" {
+		fmt.Fprintf(&buf, `<yp:datastore xmlns:ds="%s">%s</yp:datastore>`, datastoresNS, datastoreIdentity(opts.Datastore))
+		if opts.XPath != "" {
+			fmt.Fprintf(&buf, "<yp:datastore-xpath-filter%s>%s</yp:datastore-xpath-filter>", xmlnsAttrs(opts.Namespaces), escapeText(opts.XPath))
+		}
+	}
+	if !opts.StopTime.IsZero() {
+		fmt.Fprintf(&buf, "<stop-time>%s</stop-time>", formatDateTime(opts.StopTime))
+	}
+	writeTrigger(&buf, opts)
+	buf.WriteString("</establish-subscription>")
+	return RawMethod(buf.String())
+}
+
+// writeTrigger writes the YANG-push periodic or on-change trigger of opts.
+func writeTrigger(buf *bytes.Buffer, opts SubscriptionOptions) {
+	switch {
+	case opts.Period > 0:
+		fmt.Fprintf(buf, "<yp:periodic><yp:period>%d</yp:period></yp:periodic>", centiseconds(opts.Period))
+	case opts.OnChange:
+		buf.WriteString("<yp:on-change>")
+		if opts.DampeningPeriod > 0 {
+			fmt.Fprintf(buf, "<yp:dampening-period>%d</yp:dampening-period>", centiseconds(opts.DampeningPeriod))
+		}
+		buf.WriteString("</yp:on-change>")
+	}
+}
+
+// centiseconds returns d in the centiseconds used by YANG-push.
+func centiseconds(d time.Duration) int64 {
+	return int64(d / (10 * time.Millisecond))
+}
+
+// xmlnsAttrs returns the declarations of namespaces, sorted by prefix.
+func xmlnsAttrs(namespaces map[string]string) string {
+	prefixes := make([]string, 0, len(namespaces))
+	for prefix := range namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var b strings.Builder
+	for _, prefix := range prefixes {
+		fmt.Fprintf(&b, ` xmlns:%s="%s"`, prefix, escapeText(namespaces[prefix]))
+	}
+	return b.String()
+}
+
+// EstablishSubscription establishes the dynamic subscription described by
+// opts and returns it with a channel receiving its notifications: the events
+// of a stream or, for a datastore, the push-update and push-change-update
+// notifications of YANG-push. The channel is closed when the subscription
+// completes, when the server terminates it, see ErrSubscriptionTerminated, or
+// when the session ends, see Subscription.Err.
+//
+// Dynamic subscriptions require the ietf-subscribed-notifications capability,
+// and ietf-yang-push for datastores. Servers without it get an RFC 5277
+// subscription to the stream instead, see Subscribe, which supports neither
+// filters nor stop times without replay.
+//
+// The session is switched to pipelined mode (see ExecAsync) and stays usable
+// for other requests and subscriptions, but only one subscription to a stream
+// as the events don't carry the subscription id. As for Subscribe the channel
+// must be drained.
+func (s *Session) EstablishSubscription(ctx context.Context, opts SubscriptionOptions) (*Subscription, <-chan *Notification, error) {
+	if err := opts.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if !hasCapability(s.serverCapabilities, subscribedNotificationsNS) {
+		if opts.Datastore != "" || opts.XPath != "" || !opts.StopTime.IsZero() {
+			return nil, nil, fmt.Errorf("server does not support ietf-subscribed-notifications")
+		}
+		sub := &Subscription{Stream: opts.Stream}
+		ch, err := s.Subscribe(ctx, sub)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sub, ch, nil
+	}
+	if opts.Datastore != "" && !hasCapability(s.serverCapabilities, yangPushNS) {
+		return nil, nil, fmt.Errorf("server does not support ietf-yang-push")
+	}
+
+	m := s.newRPCMessage([]RPCMethod{MethodEstablishSubscription(opts)})
+	sub := &Subscription{Stream: opts.Stream, StopTime: opts.StopTime, session: s, opts: &opts, messageID: m.MessageID}
+
+	// The subscription is registered by the reader goroutine as it receives
+	// the reply, before any notification of the subscription.
+	p := s.startPipeline()
+	if err := p.establish(sub, m.MessageID); err != nil {
+		return nil, nil, err
+	}
+	sent := time.Now()
+	_, err := s.execPipelined(ctx, p, m)
+	s.observeRPC(m, sent, &err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil && !sub.established {
+		err = fmt.Errorf("no subscription id in establish-subscription reply")
+	}
+	if err != nil {
+		p.endSubscription(sub, err)
+		return nil, nil, err
+	}
+	return sub, sub.ch, nil
+}
+
+// MethodModifySubscription files a modify-subscription request (RFC 8639)
+// with the remote host changing the subscription id. The XPath filter, the
+// period or dampening period and the stop time of opts are sent when set.
+// opts.Stream or opts.Datastore tell whether the filter is a stream or a
+// datastore one, they can't be modified and are not sent.
+func MethodModifySubscription(id uint32, opts SubscriptionOptions) RawMethod {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<modify-subscription xmlns="%s" xmlns:yp="%s"><id>%d</id>`, subscribedNotificationsNS, yangPushNS, id)
+	if opts.XPath != "" {
+		if opts.Datastore != "" {
+			fmt.Fprintf(&buf, "<yp:datastore-xpath-filter%s>%s</yp:datastore-xpath-filter>", xmlnsAttrs(opts.Namespaces), escapeText(opts.XPath))
+		} else {
+			fmt.Fprintf(&buf, "<stream-xpath-filter%s>%s</stream-xpath-filter>", xmlnsAttrs(opts.Namespaces), escapeText(opts.XPath))
+		}
+	}
+	if !opts.StopTime.IsZero() {
+		fmt.Fprintf(&buf, "<stop-time>%s</stop-time>", formatDateTime(opts.StopTime))
+	}
+	writeTrigger(&buf, opts)
+	buf.WriteString("</modify-subscription>")
+	return RawMethod(buf.String())
+}
+
+// MethodDeleteSubscription files a delete-subscription request (RFC 8639)
+// with the remote host ending the subscription id.
+func MethodDeleteSubscription(id uint32) RawMethod {
+	return RawMethod(fmt.Sprintf(`<delete-subscription xmlns="%s"><id>%d</id></delete-subscription>`, subscribedNotificationsNS, id))
+}
+
+// ModifySubscription changes the filter, trigger period or stop time of the
+// dynamic subscription id established on the session, see
+// MethodModifySubscription. The stream or datastore of opts are ignored and
+// the kind of trigger can't change. The subscription keeps its channel.
+func (s *Session) ModifySubscription(ctx context.Context, id uint32, opts SubscriptionOptions) error {
+	p, sub, err := s.dynamicSubscription(id)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	current := *sub.opts
+	p.mu.Unlock()
+
+	opts.Stream, opts.Datastore = current.Stream, current.Datastore
+	if opts.Stream != "" && (opts.Period != 0 || opts.OnChange) {
+		return fmt.Errorf("periodic and on-change triggers require a datastore")
+	}
+	if (opts.Period != 0 && current.OnChange) || (opts.OnChange && current.Period > 0) {
+		return fmt.Errorf("subscription %d trigger can't change", id)
+	}
+
+	reply, err := s.ExecContext(ctx, MethodModifySubscription(id, opts))
+	if err == nil && !reply.Ok {
+		err = fmt.Errorf("modify-subscription not acknowledged")
+	}
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if opts.XPath != "" {
+		sub.opts.XPath, sub.opts.Namespaces = opts.XPath, opts.Namespaces
+	}
+	if opts.Period > 0 {
+		sub.opts.Period = opts.Period
+	}
+	if opts.DampeningPeriod > 0 {
+		sub.opts.DampeningPeriod = opts.DampeningPeriod
+	}
+	if !opts.StopTime.IsZero() {
+		sub.opts.StopTime, sub.StopTime = opts.StopTime, opts.StopTime
+	}
+	return nil
+}
+
+// DeleteSubscription ends the dynamic subscription id established on the
+// session. Once the server confirms it the channel of the subscription is
+// closed, Subscription.Err returning nil, and notifications still received
+// for it are dropped.
+func (s *Session) DeleteSubscription(ctx context.Context, id uint32) error {
+	p, sub, err := s.dynamicSubscription(id)
+	if err != nil {
+		return err
+	}
+	// The subscription ends as the reply is received, so that the following
+	// notifications aren't delivered.
+	m := s.newRPCMessage([]RPCMethod{MethodDeleteSubscription(id)})
+	p.mu.Lock()
+	p.addReplyHook(m.MessageID, func(reply *RPCReply) {
+		if reply.Ok {
+			p.endSubscription(sub, nil)
+		}
+	})
+	p.mu.Unlock()
+
+	sent := time.Now()
+	reply, err := s.execPipelined(ctx, p, m)
+	s.observeRPC(m, sent, &err)
+	if err == nil && !reply.Ok {
+		err = fmt.Errorf("delete-subscription not acknowledged")
+	}
+	return err
+}
+
+// dynamicSubscription returns the active dynamic subscription id and the
+// pipeline of the session.
+func (s *Session) dynamicSubscription(id uint32) (*pipeline, *Subscription, error) {
+	p := s.activePipeline()
+	if p == nil {
+		return nil, nil, fmt.Errorf("no subscription %d on session", id)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sub, ok := p.subs[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("no subscription %d on session", id)
+	}
+	return p, sub, nil
+}
+
+// subscriptionID returns the subscription id of the content of a
+// notification of a dynamic subscription.
+func subscriptionID(el *etree.Element) (uint32, bool) {
+	if el == nil {
+		return 0, false
+	}
+	if ns := el.NamespaceURI(); ns != subscribedNotificationsNS && ns != yangPushNS {
+		return 0, false
+	}
+	return parseSubscriptionID(el.SelectElement("id"))
+}
+
+// parseSubscriptionID parses the text of the id element el.
+func parseSubscriptionID(el *etree.Element) (uint32, bool) {
+	if el == nil {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(el.Text()), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+// subscriptionEnd reports whether the content of a notification ends its
+// dynamic subscription and the error ending it, nil if it completed.
+func subscriptionEnd(el *etree.Element) (bool, error) {
+	if el == nil || el.NamespaceURI() != subscribedNotificationsNS {
+		return false, nil
+	}
+	switch el.Tag {
+	case "subscription-completed":
+		return true, nil
+	case "subscription-terminated":
+		reason := "unknown reason"
+		if r := el.SelectElement("reason"); r != nil {
+			reason = strings.TrimSpace(r.Text())
+			if i := strings.Index(reason, ":"); i >= 0 {
+				reason = reason[i+1:]
+			}
+		}
+		return true, fmt.Errorf("%w: %s", ErrSubscriptionTerminated, reason)
+	}
+	return false, nil
+}
+
+// DatastoreUpdate is a YANG-push update of a datastore subscription. Periodic
+// subscriptions, and on-change ones when they start or resynchronize, send a
+// full Snapshot (push-update), on-change subscriptions otherwise send the
+// changes as a Patch (push-change-update).
+type DatastoreUpdate struct {
+	SubscriptionID uint32
+	Time           time.Time
+	Patch          *YangPatch
+	// Snapshot holds the top-level data nodes of the datastore-contents,
+	// with the namespace declarations of the notification
+	Snapshot []*etree.Element
+	// Incomplete is set when the server could not include all data, e.g. some
+	// nodes were not readable
+	Incomplete bool
+}
+
+// parseDatastoreUpdate decodes the content el of a push-update or
+// push-change-update notification sent at eventTime. It returns nil for any
+// other content.
+func parseDatastoreUpdate(el *etree.Element, eventTime time.Time) (*DatastoreUpdate, error) {
+	if el == nil || el.NamespaceURI() != yangPushNS {
+		return nil, nil
+	}
+	if el.Tag != "push-update" && el.Tag != "push-change-update" {
+		return nil, nil
+	}
+
+	id, ok := parseSubscriptionID(el.SelectElement("id"))
+	if !ok {
+		return nil, fmt.Errorf("%s without subscription id", el.Tag)
+	}
+	u := &DatastoreUpdate{
+		SubscriptionID: id,
+		Time:           eventTime,
+		Incomplete:     el.SelectElement("incomplete-update") != nil,
+	}
+
+	if el.Tag == "push-update" {
+		if contents := el.SelectElement("datastore-contents"); contents != nil {
+			for _, child := range contents.ChildElements() {
+				c := child.Copy()
+				inheritNamespaces(c, child)
+				u.Snapshot = append(u.Snapshot, c)
+			}
+		}
+		return u, nil
+	}
+
+	var patchEl *etree.Element
+	if changes := el.SelectElement("datastore-changes"); changes != nil {
+		patchEl = changes.SelectElement("yang-patch")
+	}
+	if patchEl == nil {
+		return nil, fmt.Errorf("push-change-update %d without yang-patch", id)
+	}
+	patch, err := ParseYangPatch(patchEl)
+	if err != nil {
+		return nil, fmt.Errorf("push-change-update %d: %w", id, err)
+	}
+	u.Patch = patch
+	return u, nil
+}
@@ -0,0 +1,341 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMethodEstablishSubscription(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		{
+			MethodEstablishSubscription(SubscriptionOptions{
+				Datastore:  Operational,
+				XPath:      "/if:interfaces",
+				Namespaces: map[string]string{"if": "urn:ietf:params:xml:ns:yang:ietf-interfaces"},
+				Period:     5 * time.Second,
+			}),
+			`<establish-subscription xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications" xmlns:yp="urn:ietf:params:xml:ns:yang:ietf-yang-push">` +
+				`<yp:datastore xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">ds:operational</yp:datastore>` +
+				`<yp:datastore-xpath-filter xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces">/if:interfaces</yp:datastore-xpath-filter>` +
+				`<yp:periodic><yp:period>500</yp:period></yp:periodic></establish-subscription>`,
+		},
+		{
+			MethodEstablishSubscription(SubscriptionOptions{
+				Datastore:       Running,
+				OnChange:        true,
+				DampeningPeriod: time.Second,
+				StopTime:        time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+			}),
+			`<establish-subscription xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications" xmlns:yp="urn:ietf:params:xml:ns:yang:ietf-yang-push">` +
+				`<yp:datastore xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">ds:running</yp:datastore>` +
+				`<stop-time>2018-01-01T00:00:00Z</stop-time>` +
+				`<yp:on-change><yp:dampening-period>100</yp:dampening-period></yp:on-change></establish-subscription>`,
+		},
+		{
+			MethodEstablishSubscription(SubscriptionOptions{Stream: "NETCONF", XPath: "/ev:event[severity='major']", Namespaces: map[string]string{"ev": "urn:event"}}),
+			`<establish-subscription xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications" xmlns:yp="urn:ietf:params:xml:ns:yang:ietf-yang-push">` +
+				`<stream>NETCONF</stream><stream-xpath-filter xmlns:ev="urn:event">/ev:event[severity=&#39;major&#39;]</stream-xpath-filter></establish-subscription>`,
+		},
+	}
+
+	for _, tc := range tt {
+		if tc.method.MarshalMethod() != tc.expected {
+			t.Errorf("got %s, expected %s", tc.method, tc.expected)
+		}
+	}
+}
+
+func TestSubscriptionOptionsValidate(t *testing.T) {
+	tt := []struct {
+		name string
+		opts SubscriptionOptions
+		ok   bool
+	}{
+		{"stream", SubscriptionOptions{Stream: "NETCONF"}, true},
+		{"periodic", SubscriptionOptions{Datastore: Operational, Period: time.Second}, true},
+		{"on-change", SubscriptionOptions{Datastore: Operational, OnChange: true}, true},
+		{"no target", SubscriptionOptions{Period: time.Second}, false},
+		{"both targets", SubscriptionOptions{Stream: "NETCONF", Datastore: Operational, OnChange: true}, false},
+		{"stream trigger", SubscriptionOptions{Stream: "NETCONF", OnChange: true}, false},
+		{"no trigger", SubscriptionOptions{Datastore: Operational}, false},
+		{"both triggers", SubscriptionOptions{Datastore: Operational, Period: time.Second, OnChange: true}, false},
+		{"short period", SubscriptionOptions{Datastore: Operational, Period: time.Millisecond}, false},
+	}
+
+	for _, tc := range tt {
+		if err := tc.opts.validate(); (err == nil) != tc.ok {
+			t.Errorf("%s: unexpected result %v", tc.name, err)
+		}
+	}
+}
+
+// testPushUpdate returns a push-update notification of subscription id.
+func testPushUpdate(id int, contents string) []byte {
+	return testNotification("2018-01-01T00:00:00Z", fmt.Sprintf(`<push-update xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push"><id>%d</id><datastore-contents>%s</datastore-contents></push-update>`, id, contents))
+}
+
+func TestEstablishSubscription(t *testing.T) {
+	s := newServerTest(func(server *transportTest) {
+		req, err := server.Receive()
+		if err != nil {
+			return
+		}
+		id := messageIDRE.FindSubmatch(req)[1]
+
+		server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><id xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications">52</id></rpc-reply>`, id)))
+		server.Send(testPushUpdate(52, `<interfaces xmlns="urn:if"/>`))
+		// another subscription
+		server.Send(testPushUpdate(53, `<system xmlns="urn:sys"/>`))
+		server.Send(testNotification("2018-01-01T00:00:01Z", `<subscription-terminated xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications" xmlns:sn="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications"><id>52</id><reason>sn:suspension-timeout</reason></subscription-terminated>`))
+		server.Receive()
+	})
+	s.serverCapabilities = []string{subscribedNotificationsNS, yangPushNS}
+	defer s.Close()
+
+	sub, ch, err := s.EstablishSubscription(context.Background(), SubscriptionOptions{Datastore: Operational, Period: time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sub.ID != 52 {
+		t.Errorf("got subscription id %d, expected %d", sub.ID, 52)
+	}
+
+	var updates []string
+	for n := range ch {
+		if n.Update == nil || len(n.Update.Snapshot) == 0 {
+			t.Fatalf("unexpected notification %v", n.Data.Root().Tag)
+		}
+		updates = append(updates, n.Update.Snapshot[0].Tag)
+	}
+	if fmt.Sprint(updates) != "[interfaces]" {
+		t.Errorf("unexpected updates %v", updates)
+	}
+	if err := sub.Err(); !errors.Is(err, ErrSubscriptionTerminated) {
+		t.Errorf("got %v, expected %v", err, ErrSubscriptionTerminated)
+	}
+}
+
+func TestEstablishSubscriptionFallback(t *testing.T) {
+	var request []byte
+	s := newServerTest(func(server *transportTest) {
+		req, err := server.Receive()
+		if err != nil {
+			return
+		}
+		request = req
+		id := messageIDRE.FindSubmatch(req)[1]
+
+		server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s"><ok/></rpc-reply>`, id)))
+		server.Send(testNotification("2018-01-01T00:00:00Z", `<notificationComplete/>`))
+		server.Receive()
+	})
+	s.serverCapabilities = []string{capNotification}
+	defer s.Close()
+
+	if _, _, err := s.EstablishSubscription(context.Background(), SubscriptionOptions{Datastore: Operational, OnChange: true}); err == nil {
+		t.Errorf("expected an error for a datastore subscription")
+	}
+
+	sub, ch, err := s.EstablishSubscription(context.Background(), SubscriptionOptions{Stream: "audit"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range ch {
+	}
+	if sub.ID != 0 || sub.Stream != "audit" {
+		t.Errorf("unexpected subscription %+v", sub)
+	}
+	if !bytes.Contains(request, []byte("<create-subscription")) {
+		t.Errorf("expected create-subscription, got %s", request)
+	}
+}
+
+func TestMethodModifyDeleteSubscription(t *testing.T) {
+	tt := []struct {
+		method   RawMethod
+		expected string
+	}{
+		{
+			MethodModifySubscription(7, SubscriptionOptions{Datastore: Operational, XPath: "/if:interfaces", Namespaces: map[string]string{"if": "urn:if"}, Period: 10 * time.Second}),
+			`<modify-subscription xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications" xmlns:yp="urn:ietf:params:xml:ns:yang:ietf-yang-push"><id>7</id>` +
+				`<yp:datastore-xpath-filter xmlns:if="urn:if">/if:interfaces</yp:datastore-xpath-filter><yp:periodic><yp:period>1000</yp:period></yp:periodic></modify-subscription>`,
+		},
+		{
+			MethodModifySubscription(8, SubscriptionOptions{Stream: "NETCONF", XPath: "/event", StopTime: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}),
+			`<modify-subscription xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications" xmlns:yp="urn:ietf:params:xml:ns:yang:ietf-yang-push"><id>8</id>` +
+				`<stream-xpath-filter>/event</stream-xpath-filter><stop-time>2018-01-01T00:00:00Z</stop-time></modify-subscription>`,
+		},
+		{
+			MethodDeleteSubscription(7),
+			`<delete-subscription xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications"><id>7</id></delete-subscription>`,
+		},
+	}
+
+	for _, tc := range tt {
+		if tc.method.MarshalMethod() != tc.expected {
+			t.Errorf("got %s, expected %s", tc.method, tc.expected)
+		}
+	}
+}
+
+func TestModifyDeleteSubscription(t *testing.T) {
+	requests := make(chan []byte, 3)
+	s := newServerTest(func(server *transportTest) {
+		for i := 0; i < 3; i++ {
+			req, err := server.Receive()
+			if err != nil {
+				return
+			}
+			requests <- req
+			id := messageIDRE.FindSubmatch(req)[1]
+
+			reply := "<ok/>"
+			if i == 0 {
+				reply = `<id xmlns="urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications">7</id>`
+			}
+			server.Send([]byte(fmt.Sprintf(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="%s">%s</rpc-reply>`, id, reply)))
+		}
+		// the subscription is deleted by now
+		server.Send(testPushUpdate(7, `<interfaces xmlns="urn:if"/>`))
+		server.Receive()
+	})
+	s.serverCapabilities = []string{subscribedNotificationsNS, yangPushNS}
+	defer s.Close()
+
+	ctx := context.Background()
+	sub, ch, err := s.EstablishSubscription(ctx, SubscriptionOptions{Datastore: Operational, Period: time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-requests
+
+	if err := s.ModifySubscription(ctx, 8, SubscriptionOptions{Period: 10 * time.Second}); err == nil {
+		t.Errorf("expected an error for an unknown subscription")
+	}
+	if err := s.ModifySubscription(ctx, 7, SubscriptionOptions{OnChange: true}); err == nil {
+		t.Errorf("expected an error changing the trigger")
+	}
+	if err := s.ModifySubscription(ctx, 7, SubscriptionOptions{Period: 10 * time.Second}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req := <-requests; !bytes.Contains(req, []byte("<yp:period>1000</yp:period>")) {
+		t.Errorf("unexpected request %s", req)
+	}
+
+	if err := s.DeleteSubscription(ctx, 7); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req := <-requests; !bytes.Contains(req, []byte("<delete-subscription")) {
+		t.Errorf("unexpected request %s", req)
+	}
+	for n := range ch {
+		t.Errorf("unexpected notification %s", n.Data.Root().Tag)
+	}
+	if err := sub.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := s.DeleteSubscription(ctx, 7); err == nil {
+		t.Errorf("expected an error for a deleted subscription")
+	}
+}
+
+func TestParseDatastoreUpdate(t *testing.T) {
+	const changeUpdate = `<push-change-update xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push"><id>7</id><datastore-changes><yang-patch xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-patch"><patch-id>p1</patch-id>%s</yang-patch></datastore-changes></push-change-update>`
+	const mergeEdit = `<edit><edit-id>e1</edit-id><operation>merge</operation><target>/if:interfaces</target><value><interfaces xmlns="urn:if"/></value></edit>`
+
+	tt := []struct {
+		name       string
+		content    string
+		snapshot   []string
+		edits      []string
+		incomplete bool
+		err        bool
+	}{
+		{"other event", `<event xmlns="urn:event"/>`, nil, nil, false, false},
+		{"push-update", `<push-update xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push"><id>7</id><datastore-contents><interfaces xmlns="urn:if"/><system xmlns="urn:sys"/></datastore-contents></push-update>`, []string{"interfaces", "system"}, nil, false, false},
+		{"empty push-update", `<push-update xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push"><id>7</id><incomplete-update/></push-update>`, []string{}, nil, true, false},
+		{"push-change-update", fmt.Sprintf(changeUpdate, mergeEdit+`<edit><edit-id>e2</edit-id><operation>delete</operation><target>/if:interfaces/interface=eth0</target></edit>`), nil, []string{"e1 merge", "e2 delete"}, false, false},
+		{"missing id", `<push-update xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push"/>`, nil, nil, false, true},
+		{"missing patch", `<push-change-update xmlns="urn:ietf:params:xml:ns:yang:ietf-yang-push"><id>7</id></push-change-update>`, nil, nil, false, true},
+		{"invalid edit", fmt.Sprintf(changeUpdate, `<edit><edit-id>e1</edit-id><operation>merge</operation><target>/if:interfaces</target></edit>`), nil, nil, false, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := parseNotification(testNotification("2018-01-01T00:00:00Z", tc.content))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// an update that can't be decoded is still delivered
+			if tc.err {
+				if n.UpdateErr == nil || n.Update != nil {
+					t.Fatalf("expected an update error, got %+v", n.Update)
+				}
+				return
+			}
+			if n.UpdateErr != nil {
+				t.Fatalf("unexpected update error: %v", n.UpdateErr)
+			}
+
+			u := n.Update
+			if tc.snapshot == nil && tc.edits == nil {
+				if u != nil {
+					t.Errorf("unexpected update %+v", u)
+				}
+				return
+			}
+			if u == nil {
+				t.Fatalf("expected an update")
+			}
+			if u.SubscriptionID != 7 {
+				t.Errorf("got subscription id %d, expected %d", u.SubscriptionID, 7)
+			}
+			if !u.Time.Equal(n.EventTime) {
+				t.Errorf("got time %v, expected %v", u.Time, n.EventTime)
+			}
+			if u.Incomplete != tc.incomplete {
+				t.Errorf("got incomplete %v, expected %v", u.Incomplete, tc.incomplete)
+			}
+
+			if tc.snapshot != nil {
+				if u.Patch != nil {
+					t.Fatalf("expected a snapshot, got %+v", u)
+				}
+				got := []string{}
+				for _, el := range u.Snapshot {
+					got = append(got, el.Tag)
+				}
+				if diff := cmp.Diff(tc.snapshot, got); diff != "" {
+					t.Errorf("unexpected snapshot (-want +got):\n%s", diff)
+				}
+				return
+			}
+
+			if u.Patch == nil || u.Snapshot != nil {
+				t.Fatalf("expected a patch, got %+v", u)
+			}
+			var got []string
+			for _, e := range u.Patch.Edits {
+				got = append(got, fmt.Sprintf("%s %s", e.EditID, e.Operation))
+			}
+			if diff := cmp.Diff(tc.edits, got); diff != "" {
+				t.Errorf("unexpected edits (-want +got):\n%s", diff)
+			}
+		})
+	}
+}